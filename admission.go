@@ -0,0 +1,129 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/tgulacsi/agostle/converter"
+)
+
+// errQueueFull is returned when the admission queue is full, or the wait timed out.
+var errQueueFull = errors.New("server is busy")
+
+// admission limits the number of concurrently running conversions,
+// and lets a bounded number of requests wait for a free slot.
+type admission struct {
+	slots   chan struct{}
+	queued  atomic.Int64
+	depth   int64
+	timeout time.Duration
+
+	mWait     *metrics.Histogram
+	mRejected *metrics.Counter
+}
+
+var getAdmission = sync.OnceValue(func() *admission {
+	n := *converter.ConfAdmissionConcurrency
+	if n <= 0 {
+		n = converter.Concurrency
+	}
+	a := &admission{
+		slots:     make(chan struct{}, n),
+		depth:     int64(*converter.ConfAdmissionQueueDepth),
+		timeout:   *converter.ConfAdmissionTimeout,
+		mWait:     metrics.GetOrCreateHistogram("admission_wait_seconds"),
+		mRejected: metrics.GetOrCreateCounter("admission_rejected_total"),
+	}
+	metrics.GetOrCreateGauge("admission_queue_length", func() float64 { return float64(a.queued.Load()) })
+	metrics.GetOrCreateGauge("admission_running", func() float64 { return float64(len(a.slots)) })
+	return a
+})
+
+// full reports whether a new request would be rejected.
+func (a *admission) full() bool {
+	return len(a.slots) == cap(a.slots) && a.queued.Load() >= a.depth
+}
+
+// acquire waits for a free slot, at most timeout long.
+// A non-positive timeout waits as long as ctx allows, ignoring the queue depth
+// (for the already accepted jobs).
+// The returned function releases the slot.
+func (a *admission) acquire(ctx context.Context, timeout time.Duration) (func(), error) {
+	release := func() { <-a.slots }
+	select {
+	case a.slots <- struct{}{}:
+		a.mWait.Update(0)
+		return release, nil
+	default:
+	}
+	if a.queued.Add(1) > a.depth && timeout > 0 {
+		a.queued.Add(-1)
+		a.mRejected.Inc()
+		return nil, errQueueFull
+	}
+	defer a.queued.Add(-1)
+	start := time.Now()
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+	select {
+	case a.slots <- struct{}{}:
+		a.mWait.UpdateDuration(start)
+		return release, nil
+	case <-timeoutC:
+		a.mWait.UpdateDuration(start)
+		a.mRejected.Inc()
+		return nil, errQueueFull
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// reject responds with 429 Too Many Requests.
+func (a *admission) reject(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(max(a.timeout, time.Second).Seconds()))))
+	http.Error(w, errQueueFull.Error(), http.StatusTooManyRequests)
+}
+
+// limit admits the request to handleFunc only when a slot is free
+// (after waiting in the queue, at most the configured timeout).
+func (a *admission) limit(handleFunc http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, err := a.acquire(r.Context(), a.timeout)
+		if err != nil {
+			if errors.Is(err, errQueueFull) {
+				getLogger(r.Context()).Warn("admission", "path", r.URL.Path, "error", err)
+				a.reject(w)
+			}
+			return
+		}
+		defer release()
+		handleFunc(w, r)
+	}
+}
+
+// check rejects the request if the queue is full, without occupying a slot.
+func (a *admission) check(handleFunc http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && a.full() {
+			a.mRejected.Inc()
+			a.reject(w)
+			return
+		}
+		handleFunc(w, r)
+	}
+}
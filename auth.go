@@ -0,0 +1,196 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/tgulacsi/agostle/converter"
+)
+
+// Scopes of the endpoints.
+const (
+	scopeConvert = "convert"
+	scopeAdmin   = "admin"
+)
+
+type authKey struct {
+	Name, Secret string
+	Scopes       []string
+}
+
+// authConfig holds the accepted credentials, as read from the config.
+type authConfig struct {
+	keys       []authKey
+	certScopes map[string][]string
+	clientCAs  *x509.CertPool
+}
+
+// loadAuth reads the authentication configuration.
+// It returns nil if authentication is not configured.
+func loadAuth() (*authConfig, error) {
+	if *converter.ConfAuthKeys == "" && *converter.ConfAuthClientCA == "" {
+		return nil, nil
+	}
+	var a authConfig
+	for _, s := range splitAuthList(*converter.ConfAuthKeys) {
+		name, rest, ok := strings.Cut(s, ":")
+		scopes, secret, ok2 := strings.Cut(rest, ":")
+		if !ok || !ok2 || name == "" || secret == "" {
+			return nil, fmt.Errorf("auth.keys: %q is not name:scope+scope:secret", s)
+		}
+		a.keys = append(a.keys, authKey{Name: name, Secret: secret, Scopes: strings.Split(scopes, "+")})
+	}
+	if fn := *converter.ConfAuthClientCA; fn != "" {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, fmt.Errorf("auth.client-ca: %w", err)
+		}
+		a.clientCAs = x509.NewCertPool()
+		if !a.clientCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("auth.client-ca: no certificate found in %q", fn)
+		}
+		if *converter.ConfTLSCert == "" {
+			return nil, errors.New("auth.client-ca needs tls.cert and tls.key")
+		}
+		a.certScopes = make(map[string][]string)
+		for _, s := range splitAuthList(*converter.ConfAuthCertScopes) {
+			cn, scopes, ok := strings.Cut(s, ":")
+			if !ok || cn == "" {
+				return nil, fmt.Errorf("auth.cert-scopes: %q is not CN:scope+scope", s)
+			}
+			a.certScopes[cn] = strings.Split(scopes, "+")
+		}
+	}
+	return &a, nil
+}
+
+func splitAuthList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' })
+}
+
+// tlsConfig returns the TLS config asking for client certificates - or nil, if not needed.
+func (a *authConfig) tlsConfig() *tls.Config {
+	if a == nil || a.clientCAs == nil {
+		return nil
+	}
+	return &tls.Config{ClientCAs: a.clientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+}
+
+// authenticate returns the identity and its scopes, or an empty name.
+func (a *authConfig) authenticate(r *http.Request) (string, []string) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) != 0 && a.certScopes != nil {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		scopes, ok := a.certScopes[cn]
+		if !ok {
+			scopes = a.certScopes["*"]
+		}
+		return "cert:" + cn, scopes
+	}
+	secret := r.Header.Get("X-API-Key")
+	if secret == "" {
+		if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+			secret = strings.TrimSpace(auth[7:])
+		}
+	}
+	if secret == "" {
+		return "", nil
+	}
+	var found *authKey
+	for i, k := range a.keys {
+		// check all, to not leak the position with timing
+		if subtle.ConstantTimeCompare([]byte(k.Secret), []byte(secret)) == 1 && found == nil {
+			found = &a.keys[i]
+		}
+	}
+	if found == nil {
+		return "", nil
+	}
+	return found.Name, found.Scopes
+}
+
+// endpointScope returns the scope needed for the path ("" for public ones).
+func endpointScope(path string) string {
+	switch path {
+	case "/openapi.json":
+		return ""
+	case "/email/convert", "/email/thread", "/convert", "/outlook", "/jobs", "/stem":
+		return scopeConvert
+	}
+	if strings.HasPrefix(path, "/pdf/") || strings.HasPrefix(path, "/jobs/") {
+		return scopeConvert
+	}
+	// /_admin/stop, /debug/pprof, /metrics and the status page
+	return scopeAdmin
+}
+
+// authHandler checks the credentials and the scope needed for the path,
+// and stores the identity in the request's context.
+func (a *authConfig) authHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := endpointScope(r.URL.Path)
+		if scope == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name, scopes := a.authenticate(r)
+		if name == "" {
+			logger.Warn("unauthenticated", "path", r.URL.Path, "from", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="agostle"`)
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			logger.Warn("forbidden", "identity", name, "path", r.URL.Path, "scope", scope, "from", r.RemoteAddr)
+			http.Error(w, "scope "+scope+" is required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), name)))
+	})
+}
+
+// authErrorHandler refuses everything, as the authentication config is bad.
+func authErrorHandler(err error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad authentication config: "+err.Error(), http.StatusInternalServerError)
+	})
+}
+
+type ctxKeyIdentity struct{}
+
+func withIdentity(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, ctxKeyIdentity{}, name)
+}
+
+// getIdentity returns the authenticated identity - empty if authentication is off.
+func getIdentity(ctx context.Context) string {
+	s, _ := ctx.Value(ctxKeyIdentity{}).(string)
+	return s
+}
+
+// serveHTTP serves on l (or s.Addr if l is nil), with TLS if tls.cert is configured.
+func serveHTTP(s *http.Server, l net.Listener) error {
+	cert, key := *converter.ConfTLSCert, *converter.ConfTLSKey
+	if cert == "" {
+		if l == nil {
+			return s.ListenAndServe()
+		}
+		return s.Serve(l)
+	}
+	if l == nil {
+		return s.ListenAndServeTLS(cert, key)
+	}
+	return s.ServeTLS(l, cert, key)
+}
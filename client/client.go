@@ -0,0 +1,524 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package client is a client for the agostle HTTP API.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the agostle server at URL.
+type Client struct {
+	HTTPClient *http.Client
+	URL        string
+	// Token is sent as bearer token, if not empty.
+	Token string
+}
+
+// New returns a new Client for the server at baseURL (such as http://localhost:9500).
+// The http.DefaultClient is used if httpClient is nil.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{URL: strings.TrimSuffix(baseURL, "/"), HTTPClient: httpClient}
+}
+
+// File is an input file.
+type File struct {
+	Body        io.Reader
+	Name        string
+	ContentType string
+}
+
+// Error is returned for non-2xx responses.
+type Error struct {
+	Message    string
+	StatusCode int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// ConvertOptions are the options of EmailConvert, Convert and SubmitJob.
+type ConvertOptions struct {
+	// OutImg is the mime type of the page images (image/gif, image/png...) to render.
+	OutImg string
+	// ImgSize is the size of the page images, as WxH.
+	ImgSize string
+	// Pages to return (implies Splitted).
+	Pages []uint16
+	// Splitted splits the PDFs into pages.
+	Splitted bool
+	// Merged returns one merged PDF instead of a ZIP.
+	Merged bool
+	// Cover adds a cover page listing the parts of the mail, with their page ranges and states.
+	Cover bool
+	// RawHeaders appends the raw headers of the top-level message ("top"), or of the nested ones, too ("all").
+	RawHeaders string
+	// NoHeader switches off the header block printed before the mail body.
+	NoHeader bool
+	// Headers to print in the header block (From, To, Reply-To, Message-ID, Attachments...).
+	Headers []string
+	// Lang is the language of the header labels (en, hu, de).
+	Lang string
+	// Passwords to try on the encrypted (ZIP, 7z, RAR) archives - sent as form fields.
+	Passwords []string
+}
+
+func (o ConvertOptions) values() url.Values {
+	v := make(url.Values)
+	if o.OutImg != "" {
+		v.Set("outimg", o.OutImg)
+	}
+	if o.ImgSize != "" {
+		v.Set("imgsize", o.ImgSize)
+	}
+	for _, p := range o.Pages {
+		v.Add("page", strconv.FormatUint(uint64(p), 10))
+	}
+	if o.Splitted {
+		v.Set("splitted", "1")
+	}
+	if o.Merged {
+		v.Set("merged", "1")
+	}
+	if o.Cover {
+		v.Set("cover", "1")
+	}
+	if o.RawHeaders != "" {
+		v.Set("rawheaders", o.RawHeaders)
+	}
+	if o.NoHeader {
+		v.Set("header", "0")
+	}
+	if len(o.Headers) != 0 {
+		v.Set("headers", strings.Join(o.Headers, ","))
+	}
+	if o.Lang != "" {
+		v.Set("lang", o.Lang)
+	}
+	return v
+}
+
+// form returns the options sent as form fields (not in the URL).
+func (o ConvertOptions) form() url.Values {
+	if len(o.Passwords) == 0 {
+		return nil
+	}
+	return url.Values{"password": o.Passwords}
+}
+
+// EmailConvert converts the mail (message/rfc822 by default) to a ZIP of PDFs,
+// or a merged PDF if opts.Merged.
+func (c *Client) EmailConvert(ctx context.Context, f File, opts ConvertOptions) (io.ReadCloser, error) {
+	return c.postFiles(ctx, "/email/convert", opts.values(), opts.form(), f)
+}
+
+// EmailConvertStream converts the mail as EmailConvert, but receives the results as
+// multipart/mixed, calling each for every PDF (or page image) as soon as the server sends it.
+// The errors (ZZZ-errors.txt) and the manifest.json come last.
+//
+// opts.Merged is ignored.
+func (c *Client) EmailConvertStream(ctx context.Context, f File, opts ConvertOptions, each func(name, contentType string, r io.Reader) error) error {
+	return c.stream(ctx, "/email/convert", f, opts, each)
+}
+
+// ConvertStream is EmailConvertStream for any document.
+func (c *Client) ConvertStream(ctx context.Context, f File, opts ConvertOptions, each func(name, contentType string, r io.Reader) error) error {
+	return c.stream(ctx, "/convert", f, opts, each)
+}
+
+func (c *Client) stream(ctx context.Context, path string, f File, opts ConvertOptions, each func(name, contentType string, r io.Reader) error) error {
+	opts.Merged = false
+	req, err := c.newPostRequest(ctx, path, opts.values(), opts.form(), f)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "multipart/mixed")
+	resp, err := c.doResponse(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		err = each(part.FileName(), part.Header.Get("Content-Type"), part)
+		_ = part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Convert converts any document to a ZIP of PDFs, or a merged PDF if opts.Merged.
+func (c *Client) Convert(ctx context.Context, f File, opts ConvertOptions) (io.ReadCloser, error) {
+	return c.postFiles(ctx, "/convert", opts.values(), opts.form(), f)
+}
+
+// ConvertFiles converts each document to PDF, and returns them in a ZIP
+// (with a manifest.json listing the per-file errors),
+// or merged into one PDF if opts.Merged.
+func (c *Client) ConvertFiles(ctx context.Context, files []File, opts ConvertOptions, sort SortMode) (io.ReadCloser, error) {
+	v := opts.values()
+	sort.set(v)
+	return c.postFiles(ctx, "/convert", v, opts.form(), files...)
+}
+
+// SortMode tells whether the files shall be sorted by name before merging or converting.
+type SortMode uint8
+
+const (
+	// SortDefault uses the server's configuration.
+	SortDefault = SortMode(iota)
+	// SortNo keeps the order of the files.
+	SortNo
+	// SortYes sorts the files by name.
+	SortYes
+)
+
+func (s SortMode) set(v url.Values) {
+	switch s {
+	case SortNo:
+		v.Set("sort", "0")
+	case SortYes:
+		v.Set("sort", "1")
+	}
+}
+
+// MergeOptions are the options of PdfMerge.
+type MergeOptions struct {
+	Sort SortMode
+}
+
+// PdfMerge merges the PDFs into one.
+func (c *Client) PdfMerge(ctx context.Context, files []File, opts MergeOptions) (io.ReadCloser, error) {
+	v := make(url.Values)
+	opts.Sort.set(v)
+	return c.postFiles(ctx, "/pdf/merge", v, nil, files...)
+}
+
+// ThreadOptions are the options of EmailThread.
+type ThreadOptions struct {
+	// Collapse replaces the quoted text repeating the previous message with a short note.
+	Collapse bool
+	// NoHeader switches off the header block printed before the mail bodies.
+	NoHeader bool
+	// Headers to print in the header block (From,To,Subject...).
+	Headers []string
+	// Lang is the language of the header block's labels (en, hu, de).
+	Lang string
+}
+
+// EmailThread converts the mails (or mbox files) of a conversation into one PDF,
+// in chronological order, with a bookmark for each message.
+func (c *Client) EmailThread(ctx context.Context, files []File, opts ThreadOptions) (io.ReadCloser, error) {
+	v := ConvertOptions{NoHeader: opts.NoHeader, Headers: opts.Headers, Lang: opts.Lang}.values()
+	if opts.Collapse {
+		v.Set("collapse", "1")
+	}
+	return c.postFiles(ctx, "/email/thread", v, nil, files...)
+}
+
+// SplitOptions are the options of PdfSplit.
+type SplitOptions struct {
+	// OutImg is the mime type of the page images to render besides the pages.
+	OutImg string
+	// ImgSize is the size of the page images, as WxH.
+	ImgSize string
+	// Pages to return - all if empty.
+	Pages []uint16
+}
+
+// PdfSplit splits the PDF into a ZIP of one-page PDFs (and page images).
+func (c *Client) PdfSplit(ctx context.Context, f File, opts SplitOptions) (io.ReadCloser, error) {
+	v := ConvertOptions{OutImg: opts.OutImg, ImgSize: opts.ImgSize, Pages: opts.Pages}.values()
+	return c.postFiles(ctx, "/pdf/split", v, nil, f)
+}
+
+// Field is a PDF form field.
+type Field struct {
+	Name    string
+	Type    string   `json:",omitempty"`
+	AltName string   `json:",omitempty"`
+	Value   string   `json:",omitempty"`
+	Default string   `json:",omitempty"`
+	Options []string `json:",omitempty"`
+	Flags   int      `json:",omitempty"`
+	MaxLen  int      `json:",omitempty"`
+}
+
+// PdfFields returns the form fields of the PDF.
+func (c *Client) PdfFields(ctx context.Context, f File) ([]Field, error) {
+	rc, err := c.postFiles(ctx, "/pdf/fields", nil, nil, f)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var fields []Field
+	err = json.NewDecoder(rc).Decode(&fields)
+	return fields, err
+}
+
+// FillOptions are the options of PdfFill.
+type FillOptions struct {
+	Flatten bool
+}
+
+// PdfFill fills the form of the PDF with the values (string, number or bool for checkboxes).
+func (c *Client) PdfFill(ctx context.Context, f File, values map[string]any, opts FillOptions) (io.ReadCloser, error) {
+	v := make(url.Values)
+	if opts.Flatten {
+		v.Set("flatten", "1")
+	}
+	form := make(url.Values, 1)
+	if len(values) != 0 {
+		b, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		form.Set("values", string(b))
+	}
+	return c.postFiles(ctx, "/pdf/fill", v, form, f)
+}
+
+// Outlook converts the Outlook .msg file to an email (message/rfc822).
+func (c *Client) Outlook(ctx context.Context, f File) (io.ReadCloser, error) {
+	return c.postFiles(ctx, "/outlook", nil, nil, f)
+}
+
+// StemOptions are the options of Stem.
+type StemOptions struct {
+	// Languages are the hunspell dictionary names (en_US, hu_HU...).
+	Languages []string
+}
+
+// Stem returns the stems of the words of the text (or document), per language.
+func (c *Client) Stem(ctx context.Context, f File, opts StemOptions) (map[string]map[string][]string, error) {
+	v := make(url.Values)
+	for _, lang := range opts.Languages {
+		v.Add("lang", lang)
+	}
+	rc, err := c.postFiles(ctx, "/stem", v, nil, f)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var res map[string]map[string][]string
+	err = json.NewDecoder(rc).Decode(&res)
+	return res, err
+}
+
+// JobOptions are the options of SubmitJob.
+type JobOptions struct {
+	ConvertOptions
+	// Convert uses the /convert semantics (any document) instead of /email/convert.
+	Convert bool
+}
+
+// Part is the state of one part of the conversion.
+type Part struct {
+	Filename    string `json:",omitempty"`
+	ContentType string
+	State       string
+	Converter   string   `json:",omitempty"`
+	Backend     string   `json:",omitempty"`
+	Error       string   `json:",omitempty"`
+	Archives    []string `json:",omitempty"`
+	Seq, Level  int
+	Pages       int  `json:",omitempty"`
+	CacheHit    bool `json:",omitempty"`
+}
+
+// Job is the state of an asynchronous conversion.
+type Job struct {
+	Created, Started, Finished time.Time
+	ID, State                  string
+	Error                      string `json:",omitempty"`
+	Result                     string `json:",omitempty"`
+	Parts                      []Part `json:",omitempty"`
+}
+
+// Job states.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// SubmitJob starts an asynchronous conversion.
+func (c *Client) SubmitJob(ctx context.Context, f File, opts JobOptions) (Job, error) {
+	v := opts.values()
+	if opts.Convert {
+		v.Set("kind", "convert")
+	}
+	var job Job
+	rc, err := c.postFiles(ctx, "/jobs", v, opts.form(), f)
+	if err != nil {
+		return job, err
+	}
+	defer rc.Close()
+	err = json.NewDecoder(rc).Decode(&job)
+	return job, err
+}
+
+// Job returns the state of the job.
+func (c *Client) Job(ctx context.Context, id string) (Job, error) {
+	var job Job
+	rc, err := c.get(ctx, "/jobs/"+url.PathEscape(id))
+	if err != nil {
+		return job, err
+	}
+	defer rc.Close()
+	err = json.NewDecoder(rc).Decode(&job)
+	return job, err
+}
+
+// JobResult returns the result of the finished job.
+func (c *Client) JobResult(ctx context.Context, id string) (io.ReadCloser, error) {
+	return c.get(ctx, "/jobs/"+url.PathEscape(id)+"/result")
+}
+
+// Wait polls the job until it finishes, and returns its final state.
+func (c *Client) Wait(ctx context.Context, id string, interval time.Duration) (Job, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil || job.State == JobDone || job.State == JobFailed {
+			return job, err
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) get(ctx context.Context, path string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// postFiles posts the files as multipart/form-data, with the query and the form values.
+func (c *Client) postFiles(ctx context.Context, path string, query, form url.Values, files ...File) (io.ReadCloser, error) {
+	req, err := c.newPostRequest(ctx, path, query, form, files...)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+func (c *Client) newPostRequest(ctx context.Context, path string, query, form url.Values, files ...File) (*http.Request, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files")
+	}
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeMultipart(mw, form, files))
+	}()
+	u := c.URL + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u, pr)
+	if err != nil {
+		_ = pr.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req, nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func writeMultipart(mw *multipart.Writer, form url.Values, files []File) error {
+	for k, vv := range form {
+		for _, v := range vv {
+			if err := mw.WriteField(k, v); err != nil {
+				return err
+			}
+		}
+	}
+	for i, f := range files {
+		name := f.Name
+		if name == "" {
+			name = "file-" + strconv.Itoa(i)
+		}
+		ct := f.ContentType
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		h := make(textproto.MIMEHeader, 2)
+		h.Set("Content-Disposition",
+			`form-data; name="file"; filename="`+quoteEscaper.Replace(name)+`"`)
+		h.Set("Content-Type", ct)
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(w, f.Body); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func (c *Client) do(req *http.Request) (io.ReadCloser, error) {
+	resp, err := c.doResponse(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) doResponse(req *http.Request) (*http.Response, error) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+	}
+	return resp, nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tgulacsi/agostle/converter"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// convertServer serves /convert: one file is converted as by /email/convert,
+// more files are converted one by one, into a ZIP or a merged PDF.
+var convertServer = kithttp.NewServer(
+	convertEP,
+	convertDecode,
+	convertEncode,
+	kithttp.ServerBefore(defaultBeforeFuncs...),
+)
+
+type convertRequest struct {
+	Inputs []reqFile
+	Params convertParams
+	Sort   sortMode
+}
+
+func convertDecode(ctx context.Context, r *http.Request) (any, error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		return emailConvertDecode(ctx, r)
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	inputs, err := getRequestFiles(r)
+	if err != nil {
+		for _, f := range inputs {
+			_ = f.Close()
+		}
+		return nil, err
+	}
+	if len(inputs) == 1 {
+		return newEmailConvertRequest(ctx, r, inputs[0]), nil
+	}
+	return convertRequest{Inputs: inputs, Params: getConvertParams(r), Sort: getSortMode(r)}, nil
+}
+
+func convertEP(ctx context.Context, request any) (response any, err error) {
+	req, ok := request.(convertRequest)
+	if !ok {
+		return emailConvertEP(ctx, request)
+	}
+	defer func() {
+		for _, f := range req.Inputs {
+			_ = f.Close()
+		}
+	}()
+	logger := getLogger(ctx).With("fn", "convertEP")
+	ctx = converter.WithCoverPage(converter.WithHeaderOptions(ctx, req.Params.Header), req.Params.Cover)
+	ctx = converter.WithRawHeaders(ctx, req.Params.RawHeaders)
+	ctx = converter.WithExtractLimits(converter.WithArchivePasswords(ctx, req.Params.Passwords))
+	if req.Sort.sortFiles(req.Inputs) {
+		logger.Info("sorting filenames, as requested", "ask", req.Sort, "config", sortBeforeMerge)
+	}
+	_, wd := converter.PrepareContext(ctx, "")
+
+	parts := make([]converter.PartInfo, len(req.Inputs))
+	items := make([]converter.ArchFileItem, 0, len(req.Inputs)+2)
+	var errs []string
+	for i, f := range req.Inputs {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		info := &parts[i]
+		info.Seq, info.Filename = i+1, f.Filename
+		nm := baseName(f.Filename)
+		fn := filepath.Join(wd, fmt.Sprintf("%03d-%s.pdf", i+1, strings.TrimSuffix(nm, filepath.Ext(nm))))
+		if info.ContentType, err = convertFile(ctx, fn, f); err != nil {
+			if errors.Is(err, converter.ErrSkip) {
+				info.State = converter.PartSkipped
+				continue
+			}
+			var hErr httpError
+			if errors.As(err, &hErr) {
+				return nil, httpError{Code: hErr.Code, Err: fmt.Errorf("%s: %w", f.Filename, hErr.Err)}
+			}
+			logger.Error("convert", "file", f.Filename, "error", err)
+			info.State, info.Error = converter.PartFailed, err.Error()
+			errs = append(errs, f.Filename+": "+err.Error()+"\n")
+			continue
+		}
+		info.State = converter.PartDone
+		info.Archives = []string{filepath.Base(fn)}
+		items = append(items, converter.ArchFileItem{Filename: fn, Archive: filepath.Base(fn)})
+	}
+	if len(items) == 0 {
+		return nil, httpError{Code: http.StatusUnprocessableEntity,
+			Err: fmt.Errorf("no file could be converted: %s", strings.Join(errs, ""))}
+	}
+
+	if req.Params.Merged {
+		fns := make([]string, len(items), len(items)+1)
+		for i, item := range items {
+			fns[i] = item.Filename
+		}
+		if len(errs) != 0 {
+			efn := filepath.Join(wd, "errors.pdf")
+			if err := converter.TextToPdf(ctx, efn, strings.NewReader(strings.Join(errs, "")), "text/plain"); err != nil {
+				logger.Warn("errors to pdf", "errors", errs, "error", err)
+			} else {
+				fns = append(fns, efn)
+			}
+		}
+		dst := filepath.Join(wd, "merged.pdf")
+		if err = converter.PdfMerge(ctx, dst, fns...); err != nil {
+			return nil, err
+		}
+		fh, err := os.Open(dst)
+		return convertResponse{content: fh, contentType: "application/pdf"}, err
+	}
+
+	if len(errs) != 0 {
+		efn := filepath.Join(wd, "errors.txt")
+		if err = os.WriteFile(efn, []byte(strings.Join(errs, "")), 0640); err != nil {
+			return nil, err
+		}
+		items = append(items, converter.ArchFileItem{Filename: efn, Archive: converter.ErrTextFn})
+	}
+	mfn := filepath.Join(wd, converter.ManifestFn)
+	if err = (&converter.Manifest{Parts: parts}).WriteFile(mfn); err != nil {
+		return nil, err
+	}
+	items = append(items, converter.ArchFileItem{Filename: mfn, Archive: converter.ManifestFn})
+
+	fh, err := os.CreateTemp(wd, "convert-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	if err = converter.ZipFiles(fh, false, true, items...); err == nil {
+		_, err = fh.Seek(0, 0)
+	}
+	if err != nil {
+		_ = fh.Close()
+		return nil, err
+	}
+	return convertResponse{content: fh, contentType: "application/zip"}, nil
+}
+
+// convertFile converts f into the PDF destfn, and returns the detected content type.
+// Mails (and Outlook messages) are converted with all their parts into one PDF.
+func convertFile(ctx context.Context, destfn string, f reqFile) (string, error) {
+	contentType := f.Header.Get("Content-Type")
+	if contentType == "application/octet-stream" {
+		contentType = ""
+	}
+	var head [1024]byte
+	n, err := io.ReadAtLeast(f, head[:], len(head))
+	if n == 0 && errors.Is(err, io.EOF) {
+		return contentType, httpError{Code: http.StatusBadRequest, Err: errors.New("empty input")}
+	}
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return contentType, err
+	}
+	contentType = converter.FixContentType(head[:n], contentType, f.Filename)
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" {
+		mediaType = contentType
+	}
+	r := io.MultiReader(bytes.NewReader(head[:n]), f)
+
+	switch mediaType {
+	case "message/rfc822", converter.MessageEmlx, "application/vnd.ms-outlook", "application/CDFV2":
+		return mediaType, converter.MailToMergedPdf(ctx, destfn, r, mediaType)
+	}
+	conv := converter.GetConverter(mediaType, params)
+	if conv == nil {
+		return mediaType, fmt.Errorf("no converter for %q", mediaType)
+	}
+	return mediaType, conv(ctx, destfn, r, mediaType)
+}
+
+type convertResponse struct {
+	content     *os.File
+	contentType string
+}
+
+func convertEncode(ctx context.Context, w http.ResponseWriter, response any) error {
+	resp, ok := response.(convertResponse)
+	if !ok {
+		w.Header().Set("Content-Type", "application/zip")
+		return emailConvertEncode(ctx, w, response)
+	}
+	w.Header().Set("Content-Type", resp.contentType)
+	return pdfMergeEncode(ctx, w, resp.content)
+}
@@ -0,0 +1,286 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/mholt/archives"
+	"github.com/nwaples/rardecode/v2"
+)
+
+// ErrArchivePassword is returned for the encrypted archives none of the passwords opens.
+var ErrArchivePassword = errors.New("encrypted archive: no working password")
+
+// archiveContentTypes are the content types of the archives and compressed files
+// opened by ExtractingFilter and Decompress.
+var archiveContentTypes = map[string]bool{
+	applicationZIP: true, "application/x-zip-compressed": true,
+	"application/rar": true, "application/vnd.rar": true, "application/x-rar": true,
+	"application/x-7z-compressed": true,
+	"application/tar":             true, "application/x-tar": true, "application/x-gtar": true,
+	"application/gzip": true, "application/x-gzip": true,
+	"application/x-bzip2": true, "application/x-xz": true,
+	"application/zstd": true, "application/x-zstd": true,
+	"application/x-lzip": true, "application/x-lz4": true,
+	"application/x-br": true, "application/zlib": true,
+	"application/x-snappy-framed": true, "application/x-minlz-compressed": true,
+}
+
+// IsArchive reports whether the content type is of an archive (or compressed file) agostle extracts.
+func IsArchive(contentType string) bool { return archiveContentTypes[contentType] }
+
+type ctxKeyArchivePasswords struct{}
+
+// WithArchivePasswords returns a context which tries the passwords (before the configured ones)
+// on the encrypted archives.
+func WithArchivePasswords(ctx context.Context, passwords []string) context.Context {
+	return context.WithValue(ctx, ctxKeyArchivePasswords{}, passwords)
+}
+
+// archivePasswords returns the passwords of ctx, and the ones in ConfArchivePasswordsFile.
+func archivePasswords(ctx context.Context) []string {
+	passwords, _ := ctx.Value(ctxKeyArchivePasswords{}).([]string)
+	if *ConfArchivePasswordsFile == "" {
+		return passwords
+	}
+	fh, err := os.Open(*ConfArchivePasswordsFile)
+	if err != nil {
+		getLogger(ctx).Warn("open archive passwords", "file", *ConfArchivePasswordsFile, "error", err)
+		return passwords
+	}
+	defer fh.Close()
+	passwords = append(make([]string, 0, len(passwords)+8), passwords...)
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			passwords = append(passwords, line)
+		}
+	}
+	return passwords
+}
+
+// archiveEntry is an extracted file of an archive, spooled into a file of the working directory.
+type archiveEntry struct {
+	Body *io.SectionReader
+	Name string
+	file string
+}
+
+// removeEntries removes the spooled files of the entries.
+func removeEntries(entries ...archiveEntry) {
+	for _, e := range entries {
+		if e.file != "" {
+			_ = os.Remove(e.file)
+		}
+	}
+}
+
+// head returns the first bytes of the entry, for FixContentType.
+func (e archiveEntry) head() []byte {
+	var b [1024]byte
+	n, _ := e.Body.ReadAt(b[:], 0)
+	return b[:n]
+}
+
+// isArchivePasswordError reports whether the error of a 7z or RAR extraction is caused by
+// the encryption (no or a wrong password) - only then is it worth to try the next password.
+func isArchivePasswordError(err error) bool {
+	if errors.Is(err, ErrLimitExceeded) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var re *sevenzip.ReadError
+	return errors.As(err, &re) && re.Encrypted ||
+		errors.Is(err, rardecode.ErrArchiveEncrypted) || errors.Is(err, rardecode.ErrArchivedFileEncrypted) ||
+		errors.Is(err, rardecode.ErrBadPassword)
+}
+
+// extractArchive returns the files of the archive (any format archives.Identify recognizes,
+// or a single compressed file), trying the passwords of the context on encrypted ZIP, 7z and RAR archives.
+func extractArchive(ctx context.Context, name string, sr *io.SectionReader) ([]archiveEntry, error) {
+	format, _, err := archives.Identify(ctx, name, io.NewSectionReader(sr, 0, sr.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("identify archive %q: %w", name, err)
+	}
+	switch f := format.(type) {
+	case archives.Zip:
+		zr, err := zip.NewReader(sr, sr.Size())
+		if err != nil {
+			return nil, err
+		}
+		if zipEncrypted(zr) {
+			return extractEncryptedZip(ctx, zr, sr.Size())
+		}
+	case archives.SevenZip, archives.Rar:
+		entries, err := extractWith(ctx, f.(archives.Extraction), sr)
+		if err == nil || !isArchivePasswordError(err) {
+			return entries, err
+		}
+		passwords := archivePasswords(ctx)
+		if len(passwords) == 0 {
+			return nil, fmt.Errorf("%s: %w: no password given: %w", name, ErrArchivePassword, err)
+		}
+		for _, password := range passwords {
+			var ex archives.Extraction
+			if z, ok := f.(archives.SevenZip); ok {
+				z.Password, ex = password, z
+			} else {
+				r := f.(archives.Rar)
+				r.Password, ex = password, r
+			}
+			entries, pErr := extractWith(ctx, ex, sr)
+			if pErr == nil {
+				return entries, nil
+			}
+			if !isArchivePasswordError(pErr) {
+				return nil, pErr
+			}
+			err = pErr
+		}
+		return nil, fmt.Errorf("%s: %w (tried %d passwords): %w", name, ErrArchivePassword, len(passwords), err)
+	}
+	if ex, ok := format.(archives.Extraction); ok {
+		return extractWith(ctx, ex, sr)
+	}
+	comp, ok := format.(archives.Compression)
+	if !ok {
+		return nil, fmt.Errorf("%s: %T is not an archive", name, format)
+	}
+	rc, err := comp.OpenReader(io.NewSectionReader(sr, 0, sr.Size()))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	inner := strings.TrimSuffix(path.Base(name), comp.Extension())
+	if inner == "" || inner == "." {
+		inner = "file"
+	}
+	limits := getExtractLimits(ctx)
+	if err = limits.addEntry(inner); err != nil {
+		return nil, err
+	}
+	e, err := limits.spool(ctx, inner, rc, sr.Size(), 0)
+	if err != nil {
+		return nil, fmt.Errorf("decompress %s: %w", name, err)
+	}
+	return []archiveEntry{e}, nil
+}
+
+// extractWith extracts the (non-empty, non-directory) files with ex.
+//
+// On a password error, the files and bytes of this attempt are given back to the limits.
+func extractWith(ctx context.Context, ex archives.Extraction, sr *io.SectionReader) ([]archiveEntry, error) {
+	logger := getLogger(ctx)
+	limits := getExtractLimits(ctx)
+	var entries []archiveEntry
+	var counted, extracted int64
+	err := ex.Extract(ctx, io.NewSectionReader(sr, 0, sr.Size()), func(ctx context.Context, f archives.FileInfo) error {
+		name := f.Name()
+		if name == "__MACOSX" {
+			logger.Info("skip", "item", name)
+			return nil
+		}
+		if f.IsDir() || f.FileInfo.Size() == 0 {
+			return nil
+		}
+		if strings.HasPrefix(f.NameInArchive, "__MACOSX/") {
+			logger.Info("skip", "item", f.NameInArchive)
+			return nil
+		}
+		counted++
+		if err := limits.addEntry(name); err != nil {
+			return err
+		}
+		z, err := f.Open()
+		if err != nil {
+			return err
+		}
+		e, err := limits.spool(ctx, name, z, sr.Size(), extracted)
+		_ = z.Close()
+		logger.Info("read archive element", "i", len(entries)+1, "fi", name, "error", err)
+		if err != nil {
+			return err
+		}
+		extracted += e.Body.Size()
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		removeEntries(entries...)
+		if isArchivePasswordError(err) {
+			limits.release(counted, extracted)
+		}
+		return nil, err
+	}
+	return entries, nil
+}
+
+// extractEncryptedZip extracts the files of the ZIP (of size bytes), decrypting them with the passwords of ctx.
+func extractEncryptedZip(ctx context.Context, zr *zip.Reader, size int64) ([]archiveEntry, error) {
+	passwords := archivePasswords(ctx)
+	if len(passwords) == 0 {
+		return nil, fmt.Errorf("%w: no password given", ErrArchivePassword)
+	}
+	limits := getExtractLimits(ctx)
+	var entries []archiveEntry
+	var extracted int64
+	var last int // the password which worked last
+	fail := func(err error) ([]archiveEntry, error) {
+		removeEntries(entries...)
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+		name := path.Base(f.Name)
+		if f.FileInfo().IsDir() || f.UncompressedSize64 == 0 ||
+			strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		if err := limits.addEntry(name); err != nil {
+			return fail(err)
+		}
+		var e archiveEntry
+		read := func(r io.Reader) error {
+			var err error
+			e, err = limits.spool(ctx, name, r, size, extracted)
+			return err
+		}
+		var err error
+		for i := range passwords {
+			j := (last + i) % len(passwords)
+			err = readZipFile(f, passwords[j], read)
+			if err != nil && e.file != "" {
+				// a wrong password passing the check byte: give back the garbage
+				limits.release(0, e.Body.Size())
+				removeEntries(e)
+				e = archiveEntry{}
+			}
+			if err == nil || !errors.Is(err, errZipPassword) {
+				last = j
+				break
+			}
+		}
+		if err != nil {
+			if errors.Is(err, errZipPassword) {
+				return fail(fmt.Errorf("%s: %w (tried %d passwords)", f.Name, ErrArchivePassword, len(passwords)))
+			}
+			return fail(err)
+		}
+		extracted += e.Body.Size()
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
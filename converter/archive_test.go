@@ -0,0 +1,274 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/nwaples/rardecode/v2"
+)
+
+func TestExtractArchive(t *testing.T) {
+	const content = "Hello, World!\n"
+	var tgz, gz bytes.Buffer
+	{
+		zw := gzip.NewWriter(&tgz)
+		tw := tar.NewWriter(zw)
+		if err := tw.WriteHeader(&tar.Header{Name: "dir/a.txt", Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = tw.Write([]byte(content))
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		zw = gzip.NewWriter(&gz)
+		_, _ = zw.Write([]byte(content))
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := WithArchivePasswords(context.Background(), []string{"bad", "secret"})
+	for i, tc := range []struct {
+		Name    string
+		Data    []byte
+		Ctx     context.Context
+		Want    string
+		WantErr error
+	}{
+		{Name: "a.tar.gz", Data: tgz.Bytes(), Ctx: context.Background(), Want: "a.txt"},
+		{Name: "b.txt.gz", Data: gz.Bytes(), Ctx: context.Background(), Want: "b.txt"},
+		{Name: "c.zip", Data: testEncryptedZip(t, "a.txt", content, "secret", false), Ctx: ctx, Want: "a.txt"},
+		{Name: "d.zip", Data: testEncryptedZip(t, "a.txt", content, "secret", true), Ctx: ctx, Want: "a.txt"},
+		{Name: "e.zip", Data: testEncryptedZip(t, "a.txt", content, "other", false), Ctx: ctx, WantErr: ErrArchivePassword},
+		{Name: "f.zip", Data: testEncryptedZip(t, "a.txt", content, "secret", true), Ctx: context.Background(), WantErr: ErrArchivePassword},
+	} {
+		entries, err := extractArchive(tc.Ctx, tc.Name, io.NewSectionReader(bytes.NewReader(tc.Data), 0, int64(len(tc.Data))))
+		if tc.WantErr != nil {
+			if !errors.Is(err, tc.WantErr) {
+				t.Errorf("%d. got %v, want %v", i, err, tc.WantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d. %s: %+v", i, tc.Name, err)
+			continue
+		}
+		var got string
+		if len(entries) == 1 {
+			b, _ := io.ReadAll(entries[0].Body)
+			got = string(b)
+		}
+		removeEntries(entries...)
+		if len(entries) != 1 || entries[0].Name != tc.Want || got != content {
+			t.Errorf("%d. got %+v (%q), want %q with %q", i, entries, got, tc.Want, content)
+		}
+	}
+}
+
+func TestIsArchivePasswordError(t *testing.T) {
+	for i, tc := range []struct {
+		Err  error
+		Want bool
+	}{
+		{Err: &sevenzip.ReadError{Encrypted: true, Err: errors.New("checksum")}, Want: true},
+		{Err: fmt.Errorf("a.7z: %w", &sevenzip.ReadError{Encrypted: true}), Want: true},
+		{Err: &sevenzip.ReadError{Err: errors.New("checksum")}},
+		{Err: fmt.Errorf("a.rar: %w", rardecode.ErrBadPassword), Want: true},
+		{Err: rardecode.ErrArchiveEncrypted, Want: true},
+		{Err: fmt.Errorf("a.txt: %w: bigger than 1 bytes", ErrLimitExceeded)},
+		{Err: context.Canceled},
+		{Err: io.ErrUnexpectedEOF},
+	} {
+		if got := isArchivePasswordError(tc.Err); got != tc.Want {
+			t.Errorf("%d. %v: got %t, want %t", i, tc.Err, got, tc.Want)
+		}
+	}
+}
+
+func TestReadZipFile(t *testing.T) {
+	long := strings.Repeat("0123456789abcdefghijklmnopqrstuvwxyz\n", 1000)
+	for i, tc := range []struct {
+		Content, Password string
+		AES               bool
+		Limit             int
+		WantErr           error
+	}{
+		{Content: long, Password: "secret"},
+		{Content: long, Password: "secret", AES: true},
+		{Content: long, Password: "other", AES: true, WantErr: errZipPassword},
+		// the limit applies while decrypting
+		{Content: long, Password: "secret", Limit: 100, WantErr: ErrLimitExceeded},
+		{Content: long, Password: "secret", AES: true, Limit: 100, WantErr: ErrLimitExceeded},
+	} {
+		data := testEncryptedZip(t, "a.txt", tc.Content, tc.Password, tc.AES)
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		limit := len(tc.Content)
+		if tc.Limit != 0 {
+			limit = tc.Limit
+		}
+		var b []byte
+		err = readZipFile(zr.File[0], "secret", func(r io.Reader) error {
+			var err error
+			if b, err = io.ReadAll(io.LimitReader(r, int64(limit)+1)); err == nil && len(b) > limit {
+				err = ErrLimitExceeded
+			}
+			return err
+		})
+		if tc.WantErr != nil {
+			if !errors.Is(err, tc.WantErr) {
+				t.Errorf("%d. got %v, want %v", i, err, tc.WantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d. %+v", i, err)
+		} else if string(b) != tc.Content {
+			t.Errorf("%d. got %d bytes, want %d", i, len(b), len(tc.Content))
+		}
+	}
+
+	// a tampered AES encrypted file fails the authentication
+	data := testEncryptedZip(t, "a.txt", long, "secret", true)
+	data[bytes.Index(data, []byte("a.txt"))+len("a.txt")+16+2+100] ^= 1
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = readZipFile(zr.File[0], "secret", func(r io.Reader) error {
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}); !errors.Is(err, errZipPassword) {
+		t.Errorf("got %v, want %v", err, errZipPassword)
+	}
+}
+
+func FuzzReadZipFile(f *testing.F) {
+	for _, useAES := range []bool{false, true} {
+		data := testEncryptedZip(f, "a.txt", "Hello, World!\n", "secret", useAES)
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			f.Fatal(err)
+		}
+		zf := zr.File[0]
+		raw, err := zf.OpenRaw()
+		if err != nil {
+			f.Fatal(err)
+		}
+		b, err := io.ReadAll(raw)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b, zf.Method, zf.Extra, zf.CRC32, "secret")
+	}
+	f.Fuzz(func(t *testing.T, data []byte, method uint16, extra []byte, crc uint32, password string) {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.CreateRaw(&zip.FileHeader{Name: "a.txt", Method: method, Flags: 0x1, Extra: extra,
+			CRC32: crc, CompressedSize64: uint64(len(data)), UncompressedSize64: uint64(len(data))})
+		if err != nil {
+			return
+		}
+		if _, err = w.Write(data); err != nil {
+			return
+		}
+		if err = zw.Close(); err != nil {
+			return
+		}
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil || len(zr.File) != 1 {
+			return
+		}
+		_ = readZipFile(zr.File[0], password, func(r io.Reader) error {
+			_, err := io.Copy(io.Discard, io.LimitReader(r, 1<<20))
+			return err
+		})
+	})
+}
+
+// testEncryptedZip returns a ZIP with one stored, encrypted file.
+func testEncryptedZip(t testing.TB, name, content, password string, useAES bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	fh := zip.FileHeader{Name: name, Method: zip.Store, Flags: 0x1,
+		CRC32: crc32.ChecksumIEEE([]byte(content)), UncompressedSize64: uint64(len(content))}
+	var data []byte
+	if useAES {
+		fh.Method = 99
+		fh.Extra = []byte{0x01, 0x99, 7, 0, 1, 0, 'A', 'E', 3, 0, 0}
+		salt := bytes.Repeat([]byte{7}, 16)
+		key, err := pbkdf2.Key(sha1.New, password, salt, 1000, 2*32+2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := aes.NewCipher(key[:32])
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc := make([]byte, len(content))
+		var ctr, stream [aes.BlockSize]byte
+		for i := 0; i < len(enc); i += aes.BlockSize {
+			binary.LittleEndian.PutUint64(ctr[:], uint64(i/aes.BlockSize+1))
+			block.Encrypt(stream[:], ctr[:])
+			for j := i; j < len(enc) && j < i+aes.BlockSize; j++ {
+				enc[j] = content[j] ^ stream[j-i]
+			}
+		}
+		h := hmac.New(sha1.New, key[32:64])
+		h.Write(enc)
+		data = append(append(append(salt, key[64:]...), enc...), h.Sum(nil)[:10]...)
+	} else {
+		keys := [3]uint32{0x12345678, 0x23456789, 0x34567890}
+		update := func(c byte) {
+			keys[0] = crc32.IEEETable[byte(keys[0])^c] ^ (keys[0] >> 8)
+			keys[1] = (keys[1]+keys[0]&0xff)*134775813 + 1
+			keys[2] = crc32.IEEETable[byte(keys[2])^byte(keys[1]>>24)] ^ (keys[2] >> 8)
+		}
+		for _, c := range []byte(password) {
+			update(c)
+		}
+		plain := append(append(make([]byte, 11, 12+len(content)), byte(fh.CRC32>>24)), content...)
+		for _, c := range plain {
+			t := keys[2] | 2
+			data = append(data, c^byte((t*(t^1))>>8))
+			update(c)
+		}
+	}
+	fh.CompressedSize64 = uint64(len(data))
+	w, err := zw.CreateRaw(&fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,308 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+// authHeader carries the JSON encoded AuthStatus of the mail, on its text parts.
+const authHeader = "X-Agostle-Auth"
+
+// AuthStatus is the result of the DKIM verification, and the authentication results
+// recorded by the receiving servers.
+type AuthStatus struct {
+	DKIM []DKIMResult `json:",omitempty"`
+	// Results are the Authentication-Results headers (RFC 8601), the topmost first.
+	Results []AuthResults `json:",omitempty"`
+	// ARC is the ARC (RFC 8617) chain, as sealed by the last intermediary.
+	ARC *ARCStatus `json:",omitempty"`
+}
+
+// AuthResults is an Authentication-Results header.
+type AuthResults struct {
+	AuthServID string
+	Results    []AuthResult `json:",omitempty"`
+	// Untrusted is set if AuthServID is not in ConfMailAuthTrusted:
+	// the header may have been written by anyone (RFC 8601 section 5).
+	Untrusted bool `json:",omitempty"`
+}
+
+// AuthResult is one "method=result" of an Authentication-Results header.
+type AuthResult struct {
+	Method, Result string
+	// Details are the reason and the properties (as "header.d=example.com").
+	Details string `json:",omitempty"`
+}
+
+// ARCStatus is the last ARC set of the mail.
+type ARCStatus struct {
+	Instance int
+	// Chain is the cv= of the last ARC-Seal: none, pass or fail.
+	Chain   string
+	Results *AuthResults `json:",omitempty"`
+	// Untrusted is set if the ARC-Authentication-Results is missing or its authserv-id is not trusted.
+	Untrusted bool `json:",omitempty"`
+}
+
+func (ar AuthResults) String() string {
+	parts := make([]string, 0, len(ar.Results))
+	for _, r := range ar.Results {
+		parts = append(parts, r.Method+"="+r.Result)
+	}
+	return strings.Join(parts, ", ") + " (" + ar.AuthServID + ")"
+}
+
+func (st AuthStatus) String() string {
+	var parts []string
+	for _, r := range st.DKIM {
+		parts = append(parts, "DKIM: "+r.String())
+	}
+	for _, r := range st.Results {
+		if !r.Untrusted {
+			parts = append(parts, r.String())
+		}
+	}
+	if st.ARC != nil && !st.ARC.Untrusted {
+		s := "ARC: i=" + strconv.Itoa(st.ARC.Instance) + ", cv=" + st.ARC.Chain
+		if st.ARC.Results != nil {
+			s += ", " + st.ARC.Results.String()
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (st AuthStatus) isZero() bool { return len(st.DKIM) == 0 && len(st.Results) == 0 && st.ARC == nil }
+
+// getAuthStatus returns the authentication status recorded in the header by SlurpMail.
+func getAuthStatus(hdr map[string][]string) *AuthStatus {
+	vv := hdr[authHeader]
+	if len(vv) == 0 {
+		return nil
+	}
+	var st AuthStatus
+	if err := json.Unmarshal([]byte(vv[0]), &st); err != nil {
+		return nil
+	}
+	return &st
+}
+
+type ctxKeyTXTResolver struct{}
+
+// WithTXTResolver returns a context which looks up the DKIM keys with r (instead of net.DefaultResolver).
+func WithTXTResolver(ctx context.Context, r TXTResolver) context.Context {
+	return context.WithValue(ctx, ctxKeyTXTResolver{}, r)
+}
+
+func getTXTResolver(ctx context.Context) TXTResolver {
+	if r, _ := ctx.Value(ctxKeyTXTResolver{}).(TXTResolver); r != nil {
+		return r
+	}
+	return net.DefaultResolver
+}
+
+func isNotFound(err error) bool {
+	var de *net.DNSError
+	return errors.As(err, &de) && de.IsNotFound
+}
+
+// trustedAuthServIDs returns the authserv-ids of ConfMailAuthTrusted, in lower case.
+func trustedAuthServIDs() map[string]bool {
+	ids := strings.FieldsFunc(strings.ToLower(*ConfMailAuthTrusted), func(r rune) bool { return r == ',' || r == ' ' })
+	m := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		m[id] = true
+	}
+	return m
+}
+
+// verifyMailAuth verifies the DKIM signatures of the message,
+// and parses its Authentication-Results and ARC headers,
+// marking the ones not written by a trusted authserv-id.
+func verifyMailAuth(ctx context.Context, r io.Reader) (AuthStatus, error) {
+	var st AuthStatus
+	b, err := io.ReadAll(io.LimitReader(r, MaxSize))
+	if err != nil {
+		return st, err
+	}
+	if !bytes.Contains(b, []byte("\r\n")) {
+		b = bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n"))
+	}
+	ctx, cancel := context.WithTimeout(ctx, *ConfMailAuthTimeout)
+	defer cancel()
+	st.DKIM = verifyDKIM(ctx, getTXTResolver(ctx), b)
+
+	hdr, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(b))).ReadMIMEHeader()
+	if err != nil && len(hdr) == 0 {
+		return st, nil
+	}
+	trusted := trustedAuthServIDs()
+	for _, v := range hdr.Values("Authentication-Results") {
+		ar := parseAuthResults(v)
+		ar.Untrusted = !trusted[strings.ToLower(ar.AuthServID)]
+		st.Results = append(st.Results, ar)
+	}
+
+	type arcSet struct {
+		cv      string
+		results *AuthResults
+	}
+	arc := make(map[int]*arcSet)
+	getSet := func(tags string) (*arcSet, string) {
+		i, rest, _ := strings.Cut(tags, ";")
+		k, v, _ := strings.Cut(i, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if strings.TrimSpace(k) != "i" || err != nil || n <= 0 {
+			return nil, ""
+		}
+		if arc[n] == nil {
+			arc[n] = new(arcSet)
+		}
+		return arc[n], rest
+	}
+	for _, v := range hdr.Values("Arc-Authentication-Results") {
+		if set, rest := getSet(v); set != nil {
+			ar := parseAuthResults(rest)
+			set.results = &ar
+		}
+	}
+	for _, v := range hdr.Values("Arc-Seal") {
+		if set, _ := getSet(v); set != nil {
+			set.cv = tagValue(v, "cv")
+		}
+	}
+	for n, set := range arc {
+		if st.ARC == nil || n > st.ARC.Instance {
+			st.ARC = &ARCStatus{Instance: n, Chain: set.cv, Results: set.results,
+				Untrusted: set.results == nil || !trusted[strings.ToLower(set.results.AuthServID)]}
+		}
+	}
+	return st, nil
+}
+
+// tagValue returns the value of the tag of the "tag=value; ..." list.
+func tagValue(tags, name string) string {
+	for _, t := range strings.Split(tags, ";") {
+		if k, v, ok := strings.Cut(t, "="); ok && strings.TrimSpace(k) == name {
+			return strings.Join(strings.Fields(v), "")
+		}
+	}
+	return ""
+}
+
+// parseAuthResults parses the value of an Authentication-Results header.
+func parseAuthResults(s string) AuthResults {
+	s = stripComments(strings.NewReplacer("\r\n", " ", "\n", " ").Replace(s))
+	items := strings.Split(s, ";")
+	var ar AuthResults
+	// authserv-id [version]
+	if f := strings.Fields(items[0]); len(f) != 0 {
+		ar.AuthServID = f[0]
+	}
+	for _, item := range items[1:] {
+		f := strings.Fields(item)
+		if len(f) == 0 {
+			continue
+		}
+		method, result, ok := strings.Cut(f[0], "=")
+		if !ok {
+			continue
+		}
+		if i := strings.IndexByte(method, '/'); i >= 0 { // method/version
+			method = method[:i]
+		}
+		ar.Results = append(ar.Results, AuthResult{
+			Method: strings.ToLower(method), Result: strings.ToLower(result),
+			Details: strings.Join(f[1:], " "),
+		})
+	}
+	return ar
+}
+
+// stripComments removes the (possibly nested) comments in parentheses.
+func stripComments(s string) string {
+	var buf strings.Builder
+	var depth int
+	var quoted bool
+	for _, c := range s {
+		switch {
+		case c == '"' && depth == 0:
+			quoted = !quoted
+		case c == '(' && !quoted:
+			depth++
+			continue
+		case c == ')' && !quoted && depth > 0:
+			depth--
+			continue
+		}
+		if depth == 0 {
+			buf.WriteRune(c)
+		}
+	}
+	return buf.String()
+}
+
+// authChecker verifies the messages of a mail once, and records the result on their text parts.
+type authChecker struct {
+	statuses map[int]string
+}
+
+// newAuthChecker returns nil if ConfMailAuth is off.
+func newAuthChecker() *authChecker {
+	if !*ConfMailAuth {
+		return nil
+	}
+	return &authChecker{statuses: make(map[int]string)}
+}
+
+// mark deletes the authHeader from the part (do not trust the sender), and sets it
+// on the text parts, with the AuthStatus of the message of the part.
+func (ac *authChecker) mark(ctx context.Context, mp i18nmail.MailPart) {
+	if mp.Header == nil {
+		return
+	}
+	mp.Header.Del(authHeader)
+	if ac == nil || mp.ContentType != textPlain && mp.ContentType != textHtml {
+		return
+	}
+	var msg *i18nmail.MailPart
+	for p := mp.Parent; p != nil; p = p.Parent {
+		if p.Parent == nil || strings.HasPrefix(p.ContentType, "message/") {
+			msg = p
+			break
+		}
+	}
+	if msg == nil || msg.Body == nil {
+		return
+	}
+	s, ok := ac.statuses[msg.Seq]
+	if !ok {
+		logger := getLogger(ctx)
+		st, err := verifyMailAuth(ctx, io.NewSectionReader(msg.Body, 0, msg.Body.Size()))
+		if err != nil {
+			logger.Warn("verify mail authentication", "seq", msg.Seq, "error", err)
+		} else if !st.isZero() {
+			b, _ := json.Marshal(st)
+			s = string(b)
+			logger.Info("mail authentication", "seq", msg.Seq, "status", st.String())
+		}
+		ac.statuses[msg.Seq] = s
+	}
+	if s != "" {
+		mp.Header.Set(authHeader, s)
+	}
+}
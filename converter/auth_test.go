@@ -0,0 +1,131 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// stubResolver serves the TXT records from the map.
+type stubResolver map[string]string
+
+func (r stubResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if name == "down._domainkey.example.com" {
+		return nil, errors.New("network is down")
+	}
+	if s, ok := r[name]; ok {
+		return []string{s}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func TestVerifyMailAuth(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithTXTResolver(context.Background(), stubResolver{
+		"rsa._domainkey.example.com": "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der),
+		"ed._domainkey.example.com":  "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(edPub),
+	})
+	b64 := base64.StdEncoding.EncodeToString
+	sum := func(s string) []byte { h := sha256.Sum256([]byte(s)); return h[:] }
+
+	// simple/simple: the header and the body as is
+	const simpleBody = "Hello,\r\n\r\nWorld!\r\n"
+	simpleSig := "DKIM-Signature: v=1; a=rsa-sha256; c=simple/simple; d=example.com; s=rsa;\r\n" +
+		" h=From:Subject; bh=" + b64(sum(simpleBody)) + ";\r\n b="
+	rsaSig, err := rsa.SignPKCS1v15(nil, rsaKey, crypto.SHA256,
+		sum("From: Joe <joe@example.com>\r\nSubject: Hi\r\n"+simpleSig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	simple := simpleSig + b64(rsaSig) + "\r\n" +
+		"From: Joe <joe@example.com>\r\nTo: Sue <sue@example.net>\r\nSubject: Hi\r\n\r\n" +
+		simpleBody + "\r\n\r\n"
+
+	// relaxed/relaxed: lowercase names, unfolded and compressed whitespace, no trailing empty lines
+	relaxedSig := "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+		"  d=example.com; s=ed; h=from : subject; bh=" + b64(sum("Hello, World!\r\n")) + "; b="
+	edSig := ed25519.Sign(edKey, sum("from:Joe <joe@example.com>\r\nsubject:Hi there\r\n"+
+		"dkim-signature:v=1; a=ed25519-sha256; c=relaxed/relaxed; d=example.com; s=ed; h=from : subject; bh="+
+		b64(sum("Hello, World!\r\n"))+"; b="))
+	relaxed := relaxedSig + b64(edSig) + "\r\n" +
+		"FROM :  Joe   <joe@example.com>\r\nSubject: Hi\r\n\tthere \r\n\r\n" +
+		"Hello,  World! \t\r\n\r\n"
+
+	for i, tc := range []struct {
+		Name, Message string
+		Want          string
+	}{
+		{"simple", simple, DKIMPass},
+		{"relaxed", relaxed, DKIMPass},
+		{"tampered", strings.Replace(simple, "World", "Moon", 1), DKIMFail},
+		{"header", strings.Replace(relaxed, "Hi", "Ho", 1), DKIMFail},
+		{"nokey", strings.Replace(simple, "s=rsa", "s=none", 1), DKIMPermError},
+		{"down", strings.Replace(simple, "s=rsa", "s=down", 1), DKIMTempError},
+	} {
+		st, err := verifyMailAuth(ctx, strings.NewReader(tc.Message))
+		if err != nil {
+			t.Fatalf("%d. %s: %+v", i, tc.Name, err)
+		}
+		if len(st.DKIM) != 1 || st.DKIM[0].Result != tc.Want {
+			t.Errorf("%d. %s: got %+v, want %s", i, tc.Name, st.DKIM, tc.Want)
+		}
+	}
+
+	defer func(trusted string) { *ConfMailAuthTrusted = trusted }(*ConfMailAuthTrusted)
+	*ConfMailAuthTrusted = "mail.example.net, MX.example.net"
+	// the forged header of the sender is not shown
+	const results = "Authentication-Results: evil.example.org; dkim=pass header.d=example.com\r\n" +
+		"ARC-Authentication-Results: i=1; evil.example.org; dkim=pass header.d=example.com\r\n" +
+		"Authentication-Results: mx.example.net (comment);\r\n" +
+		"  dkim=pass (good signature) header.d=example.com;\r\n  spf=pass smtp.mailfrom=example.com; dmarc=fail\r\n" +
+		"ARC-Seal: i=1; a=rsa-sha256; cv=none; d=example.org; s=arc; b=AAAA\r\n" +
+		"ARC-Seal: i=2; a=rsa-sha256; cv=pass; d=example.net; s=arc; b=AAAA\r\n" +
+		"ARC-Authentication-Results: i=2; mx.example.net; dkim=pass header.d=example.com\r\n" +
+		"From: Joe <joe@example.com>\r\n\r\nHello\r\n"
+	st, err := verifyMailAuth(ctx, strings.NewReader(results))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := st.String(), "dkim=pass, spf=pass, dmarc=fail (mx.example.net); "+
+		"ARC: i=2, cv=pass, dkim=pass (mx.example.net)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if len(st.Results) != 2 || !st.Results[0].Untrusted || st.Results[1].Untrusted {
+		t.Fatalf("got %+v, want an untrusted and a trusted result", st.Results)
+	}
+	if d := st.Results[1].Results[0].Details; d != "header.d=example.com" {
+		t.Errorf("got %q, want %q", d, "header.d=example.com")
+	}
+
+	*ConfMailAuthTrusted = ""
+	if st, err = verifyMailAuth(ctx, strings.NewReader(results)); err != nil {
+		t.Fatal(err)
+	}
+	if st.ARC == nil || !st.ARC.Untrusted || st.String() != "" {
+		t.Errorf("got %+v (%q), want nothing trusted", st, st)
+	}
+}
@@ -0,0 +1,473 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar is the parsed iCalendar (RFC 5545) object.
+type Calendar struct {
+	Method string
+	Events []CalendarEvent
+}
+
+// CalendarEvent is a VEVENT.
+type CalendarEvent struct {
+	Summary, Location, Description, Status string
+	Organizer                              CalendarAttendee
+	Attendees                              []CalendarAttendee
+	Start, End                             time.Time
+	AllDay                                 bool
+	// RRule is the recurrence rule (FREQ=WEEKLY;BYDAY=MO...).
+	RRule string
+}
+
+// CalendarAttendee is an ORGANIZER or an ATTENDEE.
+type CalendarAttendee struct {
+	Name, Email, Role, Status string
+	RSVP                      bool
+}
+
+// ParseCalendar parses the iCalendar data. Times with a TZID which
+// cannot be loaded, and the floating times are read in loc.
+func ParseCalendar(r io.Reader, loc *time.Location) (*Calendar, error) {
+	var (
+		cal      Calendar
+		ev       *CalendarEvent
+		stack    []string
+		tzOffset = make(map[string]*time.Location)
+		tzid     string
+		duration string
+	)
+	getLoc := func(params map[string]string) *time.Location {
+		if params["TZID"] == "" {
+			return loc
+		}
+		id := strings.Trim(params["TZID"], `"`)
+		if l, err := time.LoadLocation(id); err == nil {
+			return l
+		}
+		if l := tzOffset[id]; l != nil {
+			return l
+		}
+		return loc
+	}
+
+	for line := range unfoldCalendarLines(r) {
+		name, params, value := parseCalendarLine(line)
+		switch name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(value))
+			if strings.EqualFold(value, "VEVENT") {
+				cal.Events = append(cal.Events, CalendarEvent{})
+				ev = &cal.Events[len(cal.Events)-1]
+				duration = ""
+			}
+			continue
+		case "END":
+			if strings.EqualFold(value, "VEVENT") && ev != nil {
+				if ev.End.IsZero() && duration != "" {
+					if d, err := parseCalendarDuration(duration); err == nil {
+						ev.End = ev.Start.Add(d)
+					}
+				}
+				ev = nil
+			}
+			if len(stack) != 0 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		if len(stack) == 0 {
+			continue
+		}
+		switch stack[len(stack)-1] {
+		case "VCALENDAR":
+			if name == "METHOD" {
+				cal.Method = strings.ToUpper(value)
+			}
+		case "VTIMEZONE":
+			if name == "TZID" {
+				tzid = value
+			}
+		case "STANDARD":
+			// only the standard offset, for the TZIDs unknown to Go
+			if name == "TZOFFSETTO" && tzid != "" {
+				if off, err := parseCalendarOffset(value); err == nil {
+					tzOffset[tzid] = time.FixedZone(tzid, off)
+				}
+			}
+		case "VEVENT":
+			if ev == nil {
+				continue
+			}
+			switch name {
+			case "SUMMARY":
+				ev.Summary = unescapeCalendarText(value)
+			case "LOCATION":
+				ev.Location = unescapeCalendarText(value)
+			case "DESCRIPTION":
+				ev.Description = unescapeCalendarText(value)
+			case "STATUS":
+				ev.Status = strings.ToUpper(value)
+			case "RRULE":
+				ev.RRule = value
+			case "DURATION":
+				duration = value
+			case "DTSTART":
+				ev.Start, ev.AllDay = parseCalendarTime(value, params, getLoc(params))
+			case "DTEND":
+				ev.End, _ = parseCalendarTime(value, params, getLoc(params))
+			case "ORGANIZER":
+				ev.Organizer = parseCalendarAttendee(params, value)
+			case "ATTENDEE":
+				ev.Attendees = append(ev.Attendees, parseCalendarAttendee(params, value))
+			}
+		}
+	}
+	if len(cal.Events) == 0 {
+		return &cal, errors.New("no VEVENT found")
+	}
+	return &cal, nil
+}
+
+// unfoldCalendarLines returns the unfolded content lines.
+func unfoldCalendarLines(r io.Reader) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+		var buf strings.Builder
+		for scanner.Scan() {
+			line := strings.TrimRight(scanner.Text(), "\r")
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				buf.WriteString(line[1:])
+				continue
+			}
+			if buf.Len() != 0 && !yield(buf.String()) {
+				return
+			}
+			buf.Reset()
+			buf.WriteString(line)
+		}
+		if buf.Len() != 0 {
+			yield(buf.String())
+		}
+	}
+}
+
+// parseCalendarLine splits the NAME;PARAM=value;PARAM="v:a:l":VALUE content line.
+func parseCalendarLine(line string) (name string, params map[string]string, value string) {
+	var quoted bool
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+	value = line[colon+1:]
+	fields := splitUnquoted(line[:colon], ';')
+	name = strings.ToUpper(fields[0])
+	if len(fields) > 1 {
+		params = make(map[string]string, len(fields)-1)
+		for _, f := range fields[1:] {
+			k, v, _ := strings.Cut(f, "=")
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return name, params, value
+}
+
+func splitUnquoted(s string, sep rune) []string {
+	var (
+		parts  []string
+		quoted bool
+		start  int
+	)
+	for i, c := range s {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == sep && !quoted {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescapeCalendarText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// parseCalendarTime parses DATE and DATE-TIME values.
+func parseCalendarTime(value string, params map[string]string, loc *time.Location) (time.Time, bool) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, _ := time.ParseInLocation("20060102", value, loc)
+		return t, true
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, _ := time.Parse("20060102T150405Z", value)
+		return t, false
+	}
+	t, _ := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false
+}
+
+// parseCalendarOffset parses the +HHMM[SS] UTC offset.
+func parseCalendarOffset(s string) (int, error) {
+	if len(s) < 5 || (s[0] != '+' && s[0] != '-') {
+		return 0, fmt.Errorf("bad offset %q", s)
+	}
+	h, err := strconv.Atoi(s[1:3])
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.Atoi(s[3:5])
+	if err != nil {
+		return 0, err
+	}
+	off := h*3600 + m*60
+	if s[0] == '-' {
+		off = -off
+	}
+	return off, nil
+}
+
+// parseCalendarDuration parses the [+-]P[nW][nD][T[nH][nM][nS]] duration.
+func parseCalendarDuration(s string) (time.Duration, error) {
+	var (
+		d      time.Duration
+		neg    bool
+		inTime bool
+		num    int
+	)
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("bad duration %q", s)
+	}
+	for _, c := range s[1:] {
+		if '0' <= c && c <= '9' {
+			num = num*10 + int(c-'0')
+			continue
+		}
+		unit := time.Duration(0)
+		switch {
+		case c == 'T':
+			inTime = true
+			continue
+		case c == 'W':
+			unit = 7 * 24 * time.Hour
+		case c == 'D':
+			unit = 24 * time.Hour
+		case c == 'H' && inTime:
+			unit = time.Hour
+		case c == 'M' && inTime:
+			unit = time.Minute
+		case c == 'S' && inTime:
+			unit = time.Second
+		default:
+			return 0, fmt.Errorf("bad duration %q", s)
+		}
+		d += time.Duration(num) * unit
+		num = 0
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+func parseCalendarAttendee(params map[string]string, value string) CalendarAttendee {
+	a := CalendarAttendee{
+		Name:   params["CN"],
+		Role:   params["ROLE"],
+		Status: params["PARTSTAT"],
+		RSVP:   strings.EqualFold(params["RSVP"], "TRUE"),
+	}
+	if len(value) > 7 && strings.EqualFold(value[:7], "mailto:") {
+		a.Email = value[7:]
+	} else {
+		a.Email = value
+	}
+	return a
+}
+
+var calendarFreq = map[string][2]string{
+	"SECONDLY": {"every second", "seconds"},
+	"MINUTELY": {"every minute", "minutes"},
+	"HOURLY":   {"hourly", "hours"},
+	"DAILY":    {"daily", "days"},
+	"WEEKLY":   {"weekly", "weeks"},
+	"MONTHLY":  {"monthly", "months"},
+	"YEARLY":   {"yearly", "years"},
+}
+
+// describeRRule returns a human readable form of the recurrence rule.
+func describeRRule(rrule string, loc *time.Location) string {
+	if rrule == "" {
+		return ""
+	}
+	rule := make(map[string]string)
+	for _, f := range strings.Split(rrule, ";") {
+		k, v, _ := strings.Cut(f, "=")
+		rule[strings.ToUpper(k)] = v
+	}
+	freq, ok := calendarFreq[strings.ToUpper(rule["FREQ"])]
+	if !ok {
+		return rrule
+	}
+	s := freq[0]
+	if n, _ := strconv.Atoi(rule["INTERVAL"]); n > 1 {
+		s = "every " + strconv.Itoa(n) + " " + freq[1]
+	}
+	if v := rule["BYDAY"]; v != "" {
+		s += " on " + strings.ReplaceAll(v, ",", ", ")
+	}
+	if v := rule["BYMONTHDAY"]; v != "" {
+		s += " on day " + strings.ReplaceAll(v, ",", ", ")
+	}
+	if v := rule["COUNT"]; v != "" {
+		s += ", " + v + " times"
+	}
+	if v := rule["UNTIL"]; v != "" {
+		t, allDay := parseCalendarTime(v, nil, loc)
+		s += ", until " + formatCalendarTime(t, allDay, loc)
+	}
+	return s
+}
+
+func formatCalendarTime(t time.Time, allDay bool, loc *time.Location) string {
+	if t.IsZero() {
+		return ""
+	}
+	if allDay {
+		return t.Format("Mon, 2 Jan 2006")
+	}
+	return t.In(loc).Format("Mon, 2 Jan 2006 15:04 MST")
+}
+
+// calendarLocation returns the time zone of calendar.timezone (the local one by default).
+func calendarLocation() *time.Location {
+	tz := *ConfCalendarTimezone
+	if tz == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		logger.Warn("calendar.timezone", "tz", tz, "error", err)
+		return time.Local
+	}
+	return loc
+}
+
+var calendarTemplate = template.Must(template.New("calendar").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8">
+<style>
+body { font-family: sans-serif; }
+th { text-align: left; vertical-align: top; padding-right: 1em; }
+.description { white-space: pre-wrap; border-top: 1px solid #999; padding-top: 1em; }
+</style>
+</head>
+<body>
+{{range .Events}}
+<h1>{{if .Cancelled}}Cancelled: {{end}}{{.Summary}}</h1>
+<table>
+{{if .Method}}<tr><th>Type</th><td>{{.Method}}</td></tr>{{end}}
+<tr><th>When</th><td>{{.When}}</td></tr>
+{{if .Repeats}}<tr><th>Repeats</th><td>{{.Repeats}}</td></tr>{{end}}
+{{if .Location}}<tr><th>Where</th><td>{{.Location}}</td></tr>{{end}}
+{{if .Organizer.Email}}<tr><th>Organizer</th><td>{{.Organizer.Name}} &lt;{{.Organizer.Email}}&gt;</td></tr>{{end}}
+{{if .Attendees}}<tr><th>Attendees</th><td><ul>
+{{range .Attendees}}<li>{{.Name}} &lt;{{.Email}}&gt;{{if .Status}} – {{.Status}}{{end}}{{if .Role}} ({{.Role}}){{end}}</li>
+{{end}}</ul></td></tr>{{end}}
+</table>
+{{if .Description}}<div class="description">{{.Description}}</div>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+type calendarEventView struct {
+	CalendarEvent
+	Method, When, Repeats string
+	Cancelled             bool
+	Attendees             []CalendarAttendee
+}
+
+var calendarMethods = map[string]string{
+	"REQUEST": "Invitation",
+	"REPLY":   "Reply",
+	"CANCEL":  "Cancellation",
+	"PUBLISH": "Event",
+	"COUNTER": "Counter proposal",
+}
+
+// WriteCalendarHTML renders the calendar as HTML, with the times in loc.
+func WriteCalendarHTML(w io.Writer, cal *Calendar, loc *time.Location) error {
+	views := make([]calendarEventView, len(cal.Events))
+	for i, ev := range cal.Events {
+		v := calendarEventView{
+			CalendarEvent: ev,
+			Method:        calendarMethods[cal.Method],
+			Repeats:       describeRRule(ev.RRule, loc),
+			Cancelled:     cal.Method == "CANCEL" || ev.Status == "CANCELLED",
+			When:          formatCalendarTime(ev.Start, ev.AllDay, loc),
+		}
+		end := ev.End
+		if ev.AllDay && !end.IsZero() {
+			end = end.AddDate(0, 0, -1) // DTEND is exclusive
+		}
+		if end.After(ev.Start) {
+			v.When += " – " + formatCalendarTime(end, ev.AllDay, loc)
+		}
+		for _, a := range ev.Attendees {
+			a.Status = strings.ToLower(strings.ReplaceAll(a.Status, "-", " "))
+			a.Role = strings.ToLower(strings.ReplaceAll(a.Role, "-", " "))
+			if a.RSVP && (a.Status == "" || a.Status == "needs action") {
+				a.Status = "RSVP requested"
+			}
+			v.Attendees = append(v.Attendees, a)
+		}
+		views[i] = v
+	}
+	return calendarTemplate.Execute(w, struct{ Events []calendarEventView }{views})
+}
+
+// CalendarToPdf converts iCalendar (text/calendar) invitations to PDF.
+func CalendarToPdf(ctx context.Context, destfn string, r io.Reader, contentType string) error {
+	loc := calendarLocation()
+	cal, err := ParseCalendar(r, loc)
+	if err != nil {
+		return fmt.Errorf("parse calendar: %w", err)
+	}
+	var buf bytes.Buffer
+	if err = WriteCalendarHTML(&buf, cal, loc); err != nil {
+		return err
+	}
+	return HTMLToPdf(ctx, destfn, &buf, textHtml)
+}
@@ -0,0 +1,75 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testInvite = "BEGIN:VCALENDAR\r\n" +
+	"METHOD:REQUEST\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:Central Europe Standard Time\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"TZOFFSETFROM:+0200\r\n" +
+	"TZOFFSETTO:+0100\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Weekly sync\\, planning\r\n" +
+	"ORGANIZER;CN=\"Boss, The\":mailto:boss@example.com\r\n" +
+	"ATTENDEE;CN=Alice;PARTSTAT=ACCEPTED;ROLE=REQ-PARTICIPANT:mailto:alice@example.com\r\n" +
+	"ATTENDEE;CN=Bob;RSVP=TRUE;PARTSTAT=NEEDS-ACTION:mailto:bob@example.com\r\n" +
+	"DTSTART;TZID=Central Europe Standard Time:20260112T100000\r\n" +
+	"DURATION:PT1H30M\r\n" +
+	"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10\r\n" +
+	"LOCATION:Room 1\r\n" +
+	"DESCRIPTION:First line\\nsecond line which is folded\r\n" +
+	"  and continues\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseCalendar(t *testing.T) {
+	cal, err := ParseCalendar(strings.NewReader(testInvite), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cal.Events) != 1 {
+		t.Fatalf("got %d events, want 1", len(cal.Events))
+	}
+	ev := cal.Events[0]
+	for i, tc := range [][2]string{
+		{cal.Method, "REQUEST"},
+		{ev.Summary, "Weekly sync, planning"},
+		{ev.Organizer.Name, "Boss, The"},
+		{ev.Organizer.Email, "boss@example.com"},
+		{ev.Description, "First line\nsecond line which is folded and continues"},
+		{ev.Start.UTC().Format(time.RFC3339), "2026-01-12T09:00:00Z"},
+		{ev.End.UTC().Format(time.RFC3339), "2026-01-12T10:30:00Z"},
+		{describeRRule(ev.RRule, time.UTC), "every 2 weeks on MO, WE, 10 times"},
+	} {
+		if tc[0] != tc[1] {
+			t.Errorf("%d. got %q, want %q", i, tc[0], tc[1])
+		}
+	}
+	if len(ev.Attendees) != 2 || ev.Attendees[0].Status != "ACCEPTED" || !ev.Attendees[1].RSVP {
+		t.Errorf("got attendees %+v", ev.Attendees)
+	}
+
+	var buf strings.Builder
+	if err = WriteCalendarHTML(&buf, cal, time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Weekly sync, planning", "Mon, 12 Jan 2026 09:00 UTC – Mon, 12 Jan 2026 10:30 UTC",
+		"accepted", "RSVP requested", "Room 1", "Invitation",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("%q not found in %s", want, buf.String())
+		}
+	}
+}
@@ -111,12 +111,143 @@ var (
 	// ConfKeepRemoteImage specifiec whether to keep the remote sources of images (mg src="http://mailtrack...").
 	ConfKeepRemoteImage = config.Bool("keepRemoteImage", false)
 
+	// ConfRemoteImages downloads the remote images of the HTML mails before rendering them,
+	// and rewrites them to the local files.
+	ConfRemoteImages = config.Bool("remote-images.enabled", false)
+	// ConfRemoteImagesAllow and ConfRemoteImagesDeny are the hosts (comma separated, "*.example.com"
+	// matches the subdomains, too) the images are (not) downloaded from - all, if ConfRemoteImagesAllow is empty.
+	// Private, loopback and link-local addresses are always denied.
+	ConfRemoteImagesAllow = config.String("remote-images.allow", "")
+	ConfRemoteImagesDeny  = config.String("remote-images.deny", "")
+	// ConfRemoteImagesMaxSize is the maximal size of a downloaded image.
+	ConfRemoteImagesMaxSize = config.Int64("remote-images.max-size", 5<<20)
+	// ConfRemoteImagesTimeout is the time limit of downloading an image.
+	ConfRemoteImagesTimeout = config.Duration("remote-images.timeout", 10*time.Second)
+	// ConfRemoteImagesMaxCount is the maximal number of images downloaded for a document (0: no limit).
+	ConfRemoteImagesMaxCount = config.Int("remote-images.max-count", 32)
+	// ConfRemoteImagesTotalTimeout is the time limit of downloading all the images of a document (0: no limit).
+	ConfRemoteImagesTotalTimeout = config.Duration("remote-images.total-timeout", 30*time.Second)
+	// ConfRemoteImagesProxy is the URL of the outbound proxy the images are downloaded through.
+	// The proxy resolves the names again, so it must deny the private addresses itself.
+	ConfRemoteImagesProxy = config.String("remote-images.proxy", "")
+
 	// ConfGotenbertURL is the working Gotenbert (https://pkg.go.dev/github.com/gotenberg/gotenberg/v7) service URL
 	ConfGotenbergURL = &gotenberg.URL
 
 	// ConfMaxSubprocMemoryBytes is the limit for subprocess' memory.
 	ConfMaxSubprocMemoryBytes = config.Uint64("max-subproc-mem-bytes", DefaultMaxSubprocMemoryBytes)
 
+	// ConfResultRetention is the time the results (result-*.zip, finished jobs) are kept.
+	ConfResultRetention = config.Duration("result-retention", 1*time.Hour)
+
+	// ConfJobTimeout is the time limit for an asynchronous job.
+	ConfJobTimeout = config.Duration("job-timeout", 1*time.Hour)
+
+	// ConfAdmissionConcurrency is the number of conversion requests served concurrently
+	// (Concurrency if not positive).
+	ConfAdmissionConcurrency = config.Int("admission.concurrency", 0)
+
+	// ConfAdmissionQueueDepth is the number of requests waiting for a free slot;
+	// more are rejected with 429 Too Many Requests.
+	ConfAdmissionQueueDepth = config.Int("admission.queue-depth", 64)
+
+	// ConfAdmissionTimeout is the maximal wait in the admission queue.
+	ConfAdmissionTimeout = config.Duration("admission.wait-timeout", 1*time.Minute)
+
+	// ConfUploadMaxParts is the maximal number of parts (files and fields) of a multi-file request;
+	// more are rejected with 413 Request Entity Too Large.
+	ConfUploadMaxParts = config.Int("upload.max-parts", 256)
+
+	// ConfUploadMaxTotalSize is the maximal total size of the files of a multi-file request;
+	// bigger requests are rejected with 413 Request Entity Too Large.
+	ConfUploadMaxTotalSize = config.Int64("upload.max-total-size", 1<<30)
+
+	// ConfAuthKeys are the accepted API keys (X-API-Key header) or bearer tokens,
+	// as "name:scope+scope:secret", separated by spaces or commas.
+	// Authentication is disabled if both this and ConfAuthClientCA are empty.
+	ConfAuthKeys = config.String("auth.keys", "")
+
+	// ConfAuthClientCA is the PEM file of the CA for client certificate (mTLS) authentication.
+	ConfAuthClientCA = config.String("auth.client-ca", "")
+
+	// ConfAuthCertScopes are the scopes of the client certificates, as "CN:scope+scope",
+	// separated by spaces or commas. "*" matches every CN.
+	ConfAuthCertScopes = config.String("auth.cert-scopes", "*:convert")
+
+	// ConfTLSCert and ConfTLSKey are the server's certificate and key files, for HTTPS.
+	ConfTLSCert = config.String("tls.cert", "")
+	ConfTLSKey  = config.String("tls.key", "")
+
+	// ConfSMIMECert and ConfSMIMEKey are the PEM files of the recipient certificate and key,
+	// for decrypting S/MIME encrypted mails.
+	ConfSMIMECert = config.String("smime.cert", "")
+	ConfSMIMEKey  = config.String("smime.key", "")
+
+	// ConfSMIMECA is the PEM file of the trusted roots for S/MIME signatures
+	// (the system roots if empty).
+	ConfSMIMECA = config.String("smime.ca", "")
+
+	// ConfPGPKeyring is the (armored or binary) keyring file, with the private keys
+	// for decrypting and the public keys for verifying PGP/MIME mails.
+	ConfPGPKeyring = config.String("pgp.keyring", "")
+
+	// ConfPGPPassphrase is the passphrase of the private keys in ConfPGPKeyring.
+	ConfPGPPassphrase = config.String("pgp.passphrase", "")
+
+	// ConfMailAuth verifies the DKIM signatures of the mails, and shows the result with
+	// the Authentication-Results and ARC headers in the header block and the manifest.
+	ConfMailAuth = config.Bool("mailauth.verify", false)
+	// ConfMailAuthTimeout is the time limit of the DKIM key lookups of a mail.
+	ConfMailAuthTimeout = config.Duration("mailauth.timeout", 10*time.Second)
+	// ConfMailAuthTrusted is the comma separated list of the trusted authserv-ids (the border MTAs),
+	// only their Authentication-Results and ARC headers are shown.
+	ConfMailAuthTrusted = config.String("mailauth.trusted", "")
+
+	// ConfCalendarTimezone is the time zone of the rendered calendar invitations
+	// (the local time zone if empty).
+	ConfCalendarTimezone = config.String("calendar.timezone", "")
+
+	// ConfHeaderList is the comma separated list of the headers printed before the mail body
+	// (PrependHeaders if empty). "Attachments" lists the names of the attached files.
+	ConfHeaderList = config.String("header.headers", "")
+
+	// ConfHeaderLang is the default language of the header labels (en, hu, de).
+	ConfHeaderLang = config.String("header.lang", "en")
+
+	// ConfHeaderDisabled switches off the header block by default.
+	ConfHeaderDisabled = config.Bool("header.disabled", false)
+
+	// ConfHeaderHTMLTemplate and ConfHeaderTextTemplate are the files of the html/template
+	// and text/template of the header block, executed with a HeaderBlock.
+	ConfHeaderHTMLTemplate = config.String("header.html-template", "")
+	ConfHeaderTextTemplate = config.String("header.text-template", "")
+
+	// ConfCoverPage adds a cover page to the converted mails by default,
+	// listing the parts with their page ranges and conversion states.
+	ConfCoverPage = config.Bool("cover-page", false)
+
+	// ConfRawHeaders appends the raw headers of the top-level ("top") or of all ("all")
+	// messages to the converted mails by default.
+	ConfRawHeaders = config.String("raw-headers", "")
+
+	// ConfMboxParallel is the number of messages of a mailbox converted in parallel
+	// (Concurrency if not positive).
+	ConfMboxParallel = config.Int("mbox.parallel", 0)
+
+	// ConfArchivePasswordsFile is the file of the passwords (one per line)
+	// tried on the encrypted ZIP, 7z and RAR archives, after the ones given in the request.
+	ConfArchivePasswordsFile = config.String("archive.passwords-file", "")
+
+	// ConfLimitDepth is the maximal nesting depth of the attached mails and archives.
+	ConfLimitDepth = config.Int("limits.depth", 8)
+	// ConfLimitTotalSize is the maximal number of bytes extracted from the archives of a request.
+	ConfLimitTotalSize = config.Int64("limits.total-size", 1<<30)
+	// ConfLimitEntries is the maximal number of files extracted from the archives of a request.
+	ConfLimitEntries = config.Int("limits.entries", 10000)
+	// ConfLimitRatio is the maximal compression ratio of an archive (not checked below 1MiB).
+	// All limits are switched off with 0.
+	ConfLimitRatio = config.Int("limits.ratio", 100)
+
 	ConfCacheTrimInterval = config.Duration("cache-trim-interval", 5*time.Minute)
 	ConfCacheTrimLimit    = config.Duration("cache-trim-limit", 1*time.Hour)
 	ConfCacheTrimSize     = config.Int64("cache-trim-size", 20<<20)
@@ -14,7 +14,6 @@ import (
 	"io"
 	"log/slog"
 	"mime"
-	"mime/multipart"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -27,7 +26,6 @@ import (
 
 	"github.com/UNO-SOFT/filecache"
 	"github.com/google/renameio/v2"
-	"github.com/mholt/archives"
 	"github.com/tgulacsi/go/iohlp"
 	"golang.org/x/net/html"
 	"mvdan.cc/sh/v3/syntax"
@@ -93,6 +91,7 @@ func (c Converter) WithCache(ctx context.Context, destfn string, r io.Reader, so
 	if fn, _, err := Cache.GetFile(key); err == nil {
 		if err = copyFile(fn, destfn); err == nil {
 			logger.Info("served from cache")
+			setCacheHit(ctx)
 			return nil
 		}
 		logger.Info("copy from cache", "source", fn, "dest", destfn, "error", err)
@@ -214,6 +213,7 @@ func imageToPdf(ctx context.Context, destfn string, r io.Reader, contentType str
 		var n int
 		if n, _, err = pdfPageNum(ctx, destfn); err == nil && n != 0 {
 			logger.Info("pagenum", "n", n, "file", destfn)
+			setBackend(ctx, "pdfcpu")
 			return w.Close()
 		}
 	}
@@ -235,6 +235,7 @@ func imageToPdf(ctx context.Context, destfn string, r io.Reader, contentType str
 		logger.Info("ImageToPdfGm", "error", err)
 		return fmt.Errorf("ImageToPdfGm: %w", err)
 	}
+	setBackend(ctx, "gm")
 	return w.Close()
 }
 
@@ -275,30 +276,6 @@ func PdfToPdf(ctx context.Context, destfn string, r io.Reader, _ string) error {
 	return closeErr
 }
 
-// MPRelatedToPdf converts multipart/related to PDF
-func MPRelatedToPdf(ctx context.Context, destfn string, r io.Reader, contentType string) error {
-	//Log := getLogger(ctx).Log
-	var (
-		err    error
-		params map[string]string
-	)
-	contentType, params, err = mime.ParseMediaType(contentType)
-	if err != nil {
-		err = fmt.Errorf("parse Content-Type %s: %w", contentType, err)
-		return err
-	}
-
-	parts := multipart.NewReader(r, params["boundary"])
-	_, e := parts.NextPart()
-	for e == nil {
-		_, e = parts.NextPart()
-	}
-	if e != nil && !errors.Is(e, io.EOF) {
-		return e
-	}
-	return nil
-}
-
 func RtfToPdf(ctx context.Context, destfn string, r io.Reader, contentType string) error {
 	if *ConfUnrtf == "" {
 		return OfficeToPdf(ctx, destfn, r, contentType)
@@ -374,7 +351,14 @@ func htmlToPdf(ctx context.Context, destfn string, r io.Reader, contentType stri
 				}
 				return nil
 			}
-			var buf bytes.Buffer
+			var fetch func(string) (string, error)
+			if fetcher := getImageFetcher(ctx); fetcher != nil {
+				var stop func()
+				fetch, stop = fetcher.session(ctx, filepath.Join(filepath.Dir(inpfn), "images"))
+				defer stop()
+			}
+			var buf, out bytes.Buffer
+			var last int
 			for _, pos := range reHtmlImg.FindAllIndex(b, -1) {
 				line := b[pos[0]:pos[1]]
 				img, _ := html.Parse(bytes.NewReader(line))
@@ -391,11 +375,19 @@ func htmlToPdf(ctx context.Context, destfn string, r io.Reader, contentType stri
 						mCW = true
 						img.Attr[i].Val = maxWidthEasyPrint
 					case "src":
-						if !*ConfKeepRemoteImage {
-							if s := img.Attr[i].Val; strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://") {
-								del = true
+						s := img.Attr[i].Val
+						if !strings.HasPrefix(s, "https://") && !strings.HasPrefix(s, "http://") {
+							break
+						}
+						if fetch != nil {
+							fn, err := fetch(s)
+							if err == nil {
+								img.Attr[i].Val = fn
+								break
 							}
+							logger.Warn("fetch remote image", "url", s, "error", err)
 						}
+						del = !*ConfKeepRemoteImage
 					}
 					if del {
 						img.Attr[i] = img.Attr[len(img.Attr)-1]
@@ -409,12 +401,12 @@ func htmlToPdf(ctx context.Context, destfn string, r io.Reader, contentType stri
 					continue
 				}
 				logger.Info("htmlToPdf", "old", string(line), "new", buf.String())
-				i := pos[0] + copy(b[pos[0]:pos[1]], buf.Bytes())
-				for i < pos[1] {
-					b[i] = ' '
-					i++
-				}
+				out.Write(b[last:pos[0]])
+				out.Write(buf.Bytes())
+				last = pos[1]
 			}
+			out.Write(b[last:])
+			b = out.Bytes()
 
 			if err = os.WriteFile(inpfn, b, 0644); err != nil {
 				return fmt.Errorf("overwrite %s: %w", inpfn, err)
@@ -425,6 +417,7 @@ func htmlToPdf(ctx context.Context, destfn string, r io.Reader, contentType stri
 	if gotenberg.Valid() {
 		err := gotenberg.PostFileNames(ctx, destfn, "/forms/chromium/convert/html", []string{inpfn}, "text/html")
 		if err == nil {
+			setBackend(ctx, "gotenberg")
 			return nil
 		}
 		logger.Debug("gotenberg chromium", "error", err)
@@ -433,6 +426,7 @@ func htmlToPdf(ctx context.Context, destfn string, r io.Reader, contentType stri
 	if *ConfWeasyPrint != "" {
 		err := weasyprint(ctx, destfn, inpfn)
 		if err == nil {
+			setBackend(ctx, "weasyprint")
 			return nil
 		}
 		logger.Info("weasyprint", "error", err)
@@ -454,6 +448,7 @@ func htmlToPdf(ctx context.Context, destfn string, r io.Reader, contentType stri
 		}
 		err := wkhtmltopdf(ctx, destfn, inpfn)
 		if err == nil {
+			setBackend(ctx, "wkhtmltopdf")
 			return nil
 		}
 		logger.Info("wkhtmltopdf", "error", err)
@@ -505,6 +500,7 @@ func lofficeConvert(ctx context.Context, outDir, inpfn, contentType string) erro
 	if gotenberg.Valid() {
 		err := gotenberg.PostFileNames(ctx, filepath.Join(outDir, filepath.Base(inpfn)+".pdf"), "/forms/libreoffice/convert", []string{inpfn}, contentType)
 		if err == nil {
+			setBackend(ctx, "gotenberg")
 			return nil
 		}
 		logger.Debug("libreofficeConvert gotenberg", "error", err)
@@ -552,6 +548,7 @@ func lofficeConvert(ctx context.Context, outDir, inpfn, contentType string) erro
 	if _, err := os.Stat(outfn); err != nil {
 		return fmt.Errorf("%v no output for %s: %w", cmd.Args, filepath.Base(inpfn), err)
 	}
+	setBackend(ctx, "loffice")
 	return nil
 }
 
@@ -700,8 +697,13 @@ var ExtContentType = map[string]string{
 	"odb": "application/vnd.oasis.database",
 	"odi": "application/vnd.oasis.image",
 
-	"txt": textPlain,
-	"msg": mimeOutlook,
+	"txt":   textPlain,
+	"ics":   "text/calendar",
+	"vcf":   "text/vcard",
+	"msg":   mimeOutlook,
+	"emlx":  MessageEmlx,
+	"mht":   multipartRelated,
+	"mhtml": multipartRelated,
 
 	"jpg":  "image/jpeg",
 	"jpeg": "image/jpeg",
@@ -770,6 +772,15 @@ func FixContentType(body []byte, contentType, fileName string) (ct string) {
 		return contentType
 	}
 
+	switch {
+	case ext == ".emlx" || IsEmlx(body) &&
+		(contentType == "" || contentType == "application/octet-stream" || contentType == textPlain || contentType == messageRFC822):
+		where = "emlx"
+		return MessageEmlx
+	case ext == ".mht" || ext == ".mhtml" || contentType == "application/x-mimearchive":
+		where = "mht"
+		return multipartRelated
+	}
 	contentType = fixCT(contentType, fileName)
 	if strings.HasPrefix(ext, ".") {
 		if want, ok := ExtContentType[ext[1:]]; ok && contentType != want {
@@ -805,11 +816,12 @@ func FixContentType(body []byte, contentType, fileName string) (ct string) {
 }
 
 const (
-	textHtml       = "text/html"
-	textPlain      = "text/plain"
-	applicationPDF = "application/pdf"
-	applicationZIP = "application/zip"
-	messageRFC822  = "message/rfc822"
+	textHtml         = "text/html"
+	textPlain        = "text/plain"
+	applicationPDF   = "application/pdf"
+	applicationZIP   = "application/zip"
+	messageRFC822    = "message/rfc822"
+	multipartRelated = "multipart/related"
 )
 
 // GetConverter gets converter for the content-type
@@ -831,19 +843,26 @@ func GetConverter(contentType string, mediaType map[string]string) (converter Co
 		}
 	case textHtml:
 		converter = HTMLToPdf
-	case messageRFC822:
+	case "text/calendar", "application/ics":
+		converter = CalendarToPdf
+	case "text/vcard", "text/x-vcard", "text/directory":
+		converter = VCardToPdf
+	case messageRFC822, MessageEmlx:
 		converter = MailToPdfZip
 	case mimeOutlook, "application/CDFV2":
 		converter = OutlookToEML
-	case "multipart/related":
+	case multipartRelated:
 		converter = MPRelatedToPdf
-	case applicationZIP:
-		converter = Decompress
 	case "text/es3+xml":
 		converter = Decompress
-	case "application/x-pkcs7-signature", "text/xml":
+	case "application/x-pkcs7-signature", "application/pkcs7-signature",
+		"application/pgp-signature", "application/pgp-encrypted", "text/xml":
 		converter = Skip
 	default:
+		if IsArchive(contentType) {
+			converter = Decompress
+			break
+		}
 		if strings.HasPrefix(contentType, "text/") && strings.HasSuffix(contentType, "+xml") {
 			converter = Skip
 			break
@@ -908,23 +927,27 @@ func Decompress(ctx context.Context, destfn string, r io.Reader, contentType str
 			os.Remove(fn)
 		}
 	}()
-	switch contentType {
-	case applicationZIP:
-		archives.Zip{}.Extract(ctx, r, func(ctx context.Context, f archives.FileInfo) error {
-			rc, err := f.Open()
-			if err != nil {
+	switch {
+	case IsArchive(contentType):
+		ctx, err := enterNested(WithExtractLimits(ctx), nestingDepth(ctx)+1)
+		if err != nil {
+			return err
+		}
+		sr, err := iohlp.MakeSectionReader(io.LimitReader(r, MaxSize), InMemorySize)
+		if err != nil {
+			return err
+		}
+		entries, err := extractArchive(ctx, "", sr)
+		if err != nil {
+			return err
+		}
+		defer removeEntries(entries...)
+		for _, e := range entries {
+			if pdfs, err = toPDF(ctx, pdfs, e.Body, FixContentType(e.head(), "", e.Name)); err != nil {
 				return err
 			}
-			defer rc.Close()
-			var a [1024]byte
-			n, _ := io.ReadAtLeast(rc, a[:], 512)
-			body := a[:n]
-			r := io.MultiReader(bytes.NewReader(body), rc)
-			pdfs, err = toPDF(ctx, pdfs, r, FixContentType(body, "", f.Name()))
-			return err
-
-		})
-	case "text/es3+xml":
+		}
+	case contentType == "text/es3+xml":
 		dec := xml.NewDecoder(r)
 		var x es3Dossier
 		if err := dec.Decode(&x); err != nil {
@@ -0,0 +1,258 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+// name of the cover page in the resulting archive (the first one, so the first page of the merged PDF)
+const CoverFn = "cover.pdf"
+
+// CoverPart is a part listed on the cover page.
+type CoverPart struct {
+	Filename, ContentType, SHA256 string
+	State, Error                  string
+	Size                          int64
+	Seq, Level                    int
+	// FirstPage and LastPage are the page range in the merged output (0 if not there).
+	FirstPage, LastPage int
+}
+
+type ctxKeyCoverPage struct{}
+
+// WithCoverPage returns a context which adds (or omits) the cover page
+// listing the parts of the converted mail, regardless of ConfCoverPage.
+func WithCoverPage(ctx context.Context, on bool) context.Context {
+	return context.WithValue(ctx, ctxKeyCoverPage{}, on)
+}
+
+func coverPageEnabled(ctx context.Context) bool {
+	if on, ok := ctx.Value(ctxKeyCoverPage{}).(bool); ok {
+		return on
+	}
+	return *ConfCoverPage
+}
+
+// seePart records the part read by SlurpMail, for the cover page.
+func seePart(ctx context.Context, mp i18nmail.MailPart) {
+	m := getManifest(ctx)
+	if m == nil || !coverPageEnabled(ctx) {
+		return
+	}
+	cp := CoverPart{
+		Seq: mp.Seq, Level: mp.Level,
+		Filename: attachmentName(mp.Header), ContentType: mp.ContentType,
+	}
+	if cp.Filename == "" {
+		cp.Filename = headerGetFileName(mp.Header)
+	}
+	if mp.Body != nil {
+		h := sha256.New()
+		cp.Size, _ = io.Copy(h, io.NewSectionReader(mp.Body, 0, mp.Body.Size()))
+		cp.SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	var hdr textproto.MIMEHeader
+	for p := &mp; p != nil; p = p.Parent {
+		if len(p.Header) != 0 {
+			hdr = p.Header
+		}
+	}
+	m.mu.Lock()
+	m.seen = append(m.seen, cp)
+	if m.header == nil {
+		m.header = hdr
+	}
+	m.mu.Unlock()
+}
+
+// coverParts returns the parts seen by SlurpMail and the converted ones, with their states
+// and page ranges (shifted by the offset pages of the cover page).
+func (m *Manifest) coverParts(pageRanges map[int][2]int, offset int) []CoverPart {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parts := append(make([]CoverPart, 0, len(m.seen)+len(m.Parts)), m.seen...)
+	bySeq := make(map[int]int, len(parts))
+	for i, p := range parts {
+		bySeq[p.Seq] = i
+	}
+	for _, info := range m.Parts {
+		i, ok := bySeq[info.Seq]
+		if !ok {
+			i = len(parts)
+			bySeq[info.Seq] = i
+			parts = append(parts, CoverPart{
+				Seq: info.Seq, Level: info.Level,
+				Filename: info.Filename, ContentType: info.ContentType,
+			})
+		}
+		parts[i].State, parts[i].Error = info.State, info.Error
+	}
+	for i, p := range parts {
+		if p.State == "" { // dropped by a filter
+			parts[i].State = PartSkipped
+		}
+		if r, ok := pageRanges[p.Seq]; ok {
+			parts[i].FirstPage, parts[i].LastPage = r[0]+offset, r[1]+offset
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].Seq < parts[j].Seq })
+	return parts
+}
+
+// mergedPageRanges returns the page ranges (1-based) of the parts, by Seq,
+// in the PDF merged from the PDFs of items, in this order.
+func (m *Manifest) mergedPageRanges(ctx context.Context, items []ArchFileItem, sources map[string]string) map[int][2]int {
+	m.mu.Lock()
+	outputs := make(map[string]PartInfo, len(m.Parts))
+	for _, p := range m.Parts {
+		if p.output != "" {
+			outputs[p.output] = p
+		}
+	}
+	m.mu.Unlock()
+
+	ranges := make(map[int][2]int, len(outputs))
+	page := 0
+	for _, item := range items {
+		if item.Error != nil || item.Filename == "" || !strings.HasSuffix(item.ArchiveName(), ".pdf") {
+			continue
+		}
+		src := item.Filename
+		if s := sources[src]; s != "" {
+			src = s
+		}
+		p, ok := outputs[src]
+		n := p.Pages
+		if !ok || src != item.Filename || n <= 0 {
+			var err error
+			if n, _, err = pdfPageNum(ctx, item.Filename); err != nil || n <= 0 {
+				getLogger(ctx).Warn("page number", "file", item.Filename, "error", err)
+				continue
+			}
+		}
+		if ok {
+			r, found := ranges[p.Seq]
+			if !found {
+				r[0] = page + 1
+			}
+			r[1] = page + n
+			ranges[p.Seq] = r
+		}
+		page += n
+	}
+	return ranges
+}
+
+var coverTemplate = template.Must(template.New("cover").Funcs(template.FuncMap{
+	"size": func(n int64) string {
+		switch {
+		case n >= 1<<20:
+			return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+		case n >= 1<<10:
+			return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+		}
+		return fmt.Sprintf("%d B", n)
+	},
+	"indent": func(level, minLevel int) template.CSS {
+		return template.CSS(fmt.Sprintf("padding-left: %dem", level-minLevel))
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8">
+<style>
+body { font-family: sans-serif; font-size: 10pt; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #999; padding: 2px 4px; text-align: left; vertical-align: top; }
+td.num { text-align: right; white-space: nowrap; }
+td.hash { font-family: monospace; font-size: 7pt; word-break: break-all; }
+tr.failed td { background: #fdd; }
+tr.failed td.state { color: #a00; font-weight: bold; }
+tr.skipped td { color: #777; }
+</style>
+</head>
+<body>
+<h1>{{with .Subject}}{{.}}{{else}}Contents{{end}}</h1>
+<p>{{with .From}}{{.}}<br>{{end}}{{with .Date}}{{.}}<br>{{end}}
+{{len .Parts}} parts{{with .Failed}}, <strong>{{.}} failed</strong>{{end}}{{with .Skipped}}, {{.}} skipped{{end}}</p>
+<table>
+<tr><th>#</th><th>File name</th><th>Content type</th><th>Size</th><th>SHA-256</th><th>Pages</th><th>Status</th></tr>
+{{range .Parts}}<tr class="{{.State}}">
+<td class="num">{{.Seq}}</td>
+<td style="{{indent .Level $.MinLevel}}">{{.Filename}}</td>
+<td>{{.ContentType}}</td>
+<td class="num">{{if .Size}}{{size .Size}}{{end}}</td>
+<td class="hash">{{.SHA256}}</td>
+<td class="num">{{if .FirstPage}}{{.FirstPage}}{{if ne .FirstPage .LastPage}}-{{.LastPage}}{{end}}{{end}}</td>
+<td class="state">{{.State}}{{with .Error}}: {{.}}{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// writeCoverHTML writes the cover page listing the parts as HTML.
+func writeCoverHTML(w io.Writer, hdr textproto.MIMEHeader, parts []CoverPart) error {
+	data := struct {
+		Subject, From, Date string
+		Parts               []CoverPart
+		Failed, Skipped     int
+		MinLevel            int
+	}{Parts: parts}
+	if hdr != nil {
+		data.Subject = i18nmail.HeadDecode(hdr.Get("Subject"))
+		data.From = i18nmail.HeadDecode(hdr.Get("From"))
+		data.Date = hdr.Get("Date")
+	}
+	for i, p := range parts {
+		if i == 0 || p.Level < data.MinLevel {
+			data.MinLevel = p.Level
+		}
+		switch p.State {
+		case PartFailed:
+			data.Failed++
+		case PartSkipped:
+			data.Skipped++
+		}
+	}
+	return coverTemplate.Execute(w, data)
+}
+
+// writeCoverPage writes the cover page into destfn, listing the parts with their page ranges
+// in the PDF merged from the cover page and the PDFs of items.
+func (m *Manifest) writeCoverPage(ctx context.Context, destfn string, items []ArchFileItem, sources map[string]string) error {
+	m.mu.Lock()
+	hdr := m.header
+	m.mu.Unlock()
+	ranges := m.mergedPageRanges(ctx, items, sources)
+	// the cover page may be longer than one page, and that shifts the ranges
+	offset := 1
+	for range 3 {
+		var buf bytes.Buffer
+		if err := writeCoverHTML(&buf, hdr, m.coverParts(ranges, offset)); err != nil {
+			return err
+		}
+		if err := HTMLToPdf(ctx, destfn, &buf, textHtml); err != nil {
+			return fmt.Errorf("cover page: %w", err)
+		}
+		n, _, err := pdfPageNum(ctx, destfn)
+		if err != nil || n <= 0 || n == offset {
+			break
+		}
+		offset = n
+	}
+	return nil
+}
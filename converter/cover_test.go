@@ -0,0 +1,71 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"context"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestCoverParts(t *testing.T) {
+	var m Manifest
+	m.seen = []CoverPart{
+		{Seq: 1, Level: 1, Filename: "1.txt", ContentType: textPlain, Size: 10, SHA256: "aa"},
+		{Seq: 2, Level: 1, Filename: "a.docx", ContentType: "application/msword", Size: 2000},
+		{Seq: 3, Level: 1, Filename: "smime.p7s", ContentType: "application/pkcs7-signature", Size: 300},
+		{Seq: 4, Level: 1, Filename: "b.png", ContentType: "image/png", Size: 4 << 20},
+	}
+	m.add(&PartInfo{Seq: 1, State: PartDone, Pages: 2, output: "/tmp/x/01#001.text--plain.pdf"})
+	m.add(&PartInfo{Seq: 2, State: PartFailed, Error: "no converter"})
+	m.add(&PartInfo{Seq: 4, State: PartDone, Pages: 1, output: "/tmp/x/01#004.image--png.pdf"})
+	m.add(&PartInfo{Seq: 5, Level: 2, Filename: "c.txt", State: PartDone, Pages: 3, output: "/tmp/x/02#005.text--plain.pdf"})
+	items := []ArchFileItem{
+		{Filename: "/tmp/x/01#001.text--plain.pdf"},
+		{Filename: "/tmp/x/01#002.application--msword", Archive: "application/01#002.application--msword", Error: ErrSkip},
+		{Filename: "/tmp/x/01#004.image--png.pdf"},
+		{Filename: "/tmp/x/02#005.text--plain.pdf"},
+		{Filename: "/tmp/x/manifest.json", Archive: ManifestFn},
+	}
+	parts := m.coverParts(m.mergedPageRanges(context.Background(), items, nil), 1)
+	for i, want := range []struct {
+		Seq, First, Last int
+		State            string
+	}{
+		{1, 2, 3, PartDone},
+		{2, 0, 0, PartFailed},
+		{3, 0, 0, PartSkipped},
+		{4, 4, 4, PartDone},
+		{5, 5, 7, PartDone},
+	} {
+		if i >= len(parts) {
+			t.Fatalf("got %d parts, want 5", len(parts))
+		}
+		p := parts[i]
+		if p.Seq != want.Seq || p.FirstPage != want.First || p.LastPage != want.Last || p.State != want.State {
+			t.Errorf("%d. got %+v, want %+v", i, p, want)
+		}
+	}
+
+	var buf strings.Builder
+	hdr := textproto.MIMEHeader{"Subject": {"=?UTF-8?Q?=C3=A1rv=C3=ADzt=C5=B1r=C5=91?="}}
+	if err := writeCoverHTML(&buf, hdr, parts); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for i, want := range []string{
+		"<h1>árvíztűrő</h1>",
+		"5 parts, <strong>1 failed</strong>, 1 skipped",
+		`<tr class="failed">`,
+		"failed: no converter",
+		`<td class="num">5-7</td>`,
+		`<td class="num">4.0 MiB</td>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("%d. %q not found in\n%s", i, want, html)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// DKIM verification results (RFC 8601).
+const (
+	DKIMPass      = "pass"
+	DKIMFail      = "fail"
+	DKIMNeutral   = "neutral"
+	DKIMTempError = "temperror"
+	DKIMPermError = "permerror"
+)
+
+// at most this many signatures are verified
+const maxDKIMSignatures = 5
+
+// DKIMResult is the result of the verification of a DKIM-Signature.
+type DKIMResult struct {
+	Domain string
+	Result string
+	Error  string `json:",omitempty"`
+}
+
+func (r DKIMResult) String() string {
+	s := r.Result + " (" + r.Domain + ")"
+	if r.Error != "" {
+		s += ": " + r.Error
+	}
+	return s
+}
+
+// TXTResolver looks up the TXT records of a domain name, as net.Resolver does.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// verifyDKIM verifies the DKIM-Signature fields (at most maxDKIMSignatures) of the message.
+func verifyDKIM(ctx context.Context, resolver TXTResolver, msg []byte) []DKIMResult {
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(msg), &dkim.VerifyOptions{
+		MaxVerifications: maxDKIMSignatures,
+		LookupTXT: func(name string) ([]string, error) {
+			txts, err := resolver.LookupTXT(ctx, name)
+			if err != nil && !isNotFound(err) {
+				// go-msgauth tells the temporary errors by net.Error
+				var de *net.DNSError
+				if !errors.As(err, &de) || !de.IsTemporary {
+					err = &net.DNSError{Err: err.Error(), Name: name, IsTemporary: true}
+				}
+			}
+			return txts, err
+		},
+	})
+	if err != nil && !errors.Is(err, dkim.ErrTooManySignatures) {
+		getLogger(ctx).Warn("verify DKIM", "error", err)
+	}
+	results := make([]DKIMResult, 0, len(verifications))
+	for _, v := range verifications {
+		res := DKIMResult{Domain: v.Domain, Result: DKIMPass}
+		if v.Err != nil {
+			res.Error = v.Err.Error()
+			switch {
+			case dkim.IsTempFail(v.Err):
+				res.Result = DKIMTempError
+			case dkim.IsPermFail(v.Err):
+				res.Result = DKIMPermError
+			default:
+				res.Result = DKIMFail
+			}
+		}
+		results = append(results, res)
+	}
+	return results
+}
@@ -5,7 +5,6 @@
 package converter
 
 import (
-	"archive/zip"
 	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
@@ -25,9 +24,6 @@ import (
 
 	"github.com/tgulacsi/go/i18nmail"
 	"github.com/tgulacsi/go/iohlp"
-
-	//"github.com/tgulacsi/go/uncompr"
-	"github.com/mholt/archives"
 )
 
 const bodyThreshold = 1 << 20
@@ -36,9 +32,52 @@ func MailToPdfZip(ctx context.Context, destfn string, body io.Reader, contentTyp
 	return MailToSplittedPdfZip(ctx, destfn, body, contentType, false, "", "", nil)
 }
 
+// MailToMergedPdf converts the mail into one PDF, merging the converted parts,
+// with the cover page and the raw headers appendix if enabled (see WithCoverPage and WithRawHeaders).
+func MailToMergedPdf(ctx context.Context, destfn string, body io.Reader, contentType string) error {
+	logger := getLogger(ctx)
+	ctx, _ = PrepareContext(ctx, "")
+	ctx, manifest := withManifest(ctx)
+	files, err := MailToPdfFiles(ctx, body, contentType)
+	items := make([]ArchFileItem, 0, len(files)+2)
+	for _, item := range files {
+		if item.Error == nil && item.Filename != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		if err == nil {
+			err = errors.New("no convertable part")
+		}
+		return err
+	}
+	if rawHeadersMode(ctx) != "" {
+		rfn := destfn + "-" + RawHeadersFn
+		if e := manifest.writeRawHeaders(ctx, rfn); e != nil {
+			logger.Warn("write raw headers", "dest", rfn, "error", e)
+		} else {
+			items = append(items, ArchFileItem{Filename: rfn, Archive: RawHeadersFn})
+		}
+	}
+	if coverPageEnabled(ctx) {
+		cfn := destfn + "-" + CoverFn
+		if e := manifest.writeCoverPage(ctx, cfn, items, nil); e != nil {
+			logger.Warn("write cover page", "dest", cfn, "error", e)
+		} else {
+			items = append([]ArchFileItem{{Filename: cfn, Archive: CoverFn}}, items...)
+		}
+	}
+	fns := make([]string, len(items))
+	for i, item := range items {
+		fns[i] = item.Filename
+	}
+	return PdfMerge(ctx, destfn, fns...)
+}
+
 type maybeArchItems struct {
-	Error error
-	Items []ArchFileItem
+	Error  error
+	Source string
+	Items  []ArchFileItem
 }
 
 // MailToSplittedPdfZip converts mail to ZIP of PDFs and images
@@ -48,6 +87,7 @@ func MailToSplittedPdfZip(ctx context.Context, destfn string, body io.Reader,
 ) error {
 	logger := getLogger(ctx)
 	ctx, _ = PrepareContext(ctx, "")
+	ctx, manifest := withManifest(ctx)
 	var errs []string
 	files, err := MailToPdfFiles(ctx, body, contentType)
 	tbz := make([]ArchFileItem, 0, 2*len(files))
@@ -80,6 +120,7 @@ func MailToSplittedPdfZip(ctx context.Context, destfn string, body io.Reader,
 	}
 
 	rch := make(chan maybeArchItems, len(files))
+	sources := make(map[string]string)
 	if !split && imgmime == "" {
 		tbz = append(tbz, files...)
 	} else {
@@ -102,6 +143,9 @@ func MailToSplittedPdfZip(ctx context.Context, destfn string, body io.Reader,
 				}
 				errs = append(errs, ms.Error.Error())
 			}
+			for _, item := range ms.Items {
+				sources[item.Filename] = ms.Source
+			}
 			tbz = append(tbz, ms.Items...)
 		}
 	}
@@ -129,11 +173,36 @@ func MailToSplittedPdfZip(ctx context.Context, destfn string, body io.Reader,
 		})
 	}
 
+	manifest.setArchives(tbz, sources)
+	mfn := destfn + "-" + ManifestFn
+	if e := manifest.WriteFile(mfn); e != nil {
+		logger.Warn("write manifest", "dest", mfn, "error", e)
+	} else {
+		tbz = append(tbz, ArchFileItem{Filename: mfn, Archive: ManifestFn})
+	}
+	tbz = ArchItems(tbz).Sort()
+	if rawHeadersMode(ctx) != "" {
+		rfn := destfn + "-" + RawHeadersFn
+		if e := manifest.writeRawHeaders(ctx, rfn); e != nil {
+			logger.Warn("write raw headers", "dest", rfn, "error", e)
+		} else {
+			tbz = append(tbz, ArchFileItem{Filename: rfn, Archive: RawHeadersFn})
+		}
+	}
+	if coverPageEnabled(ctx) {
+		cfn := destfn + "-" + CoverFn
+		if e := manifest.writeCoverPage(ctx, cfn, tbz, sources); e != nil {
+			logger.Warn("write cover page", "dest", cfn, "error", e)
+		} else {
+			tbz = append([]ArchFileItem{{Filename: cfn, Archive: CoverFn}}, tbz...)
+		}
+	}
+
 	destfh, err := openOut(destfn)
 	if err != nil {
 		return fmt.Errorf("open out %s: %w", destfn, err)
 	}
-	ze := ZipFiles(destfh, true, true, []ArchFileItem(ArchItems(tbz).Sort())...)
+	ze := ZipFiles(destfh, true, true, tbz...)
 	if err = destfh.Close(); err != nil && ze == nil {
 		ze = err
 	}
@@ -212,7 +281,7 @@ func splitPdfMulti(ctx context.Context, files []string, imgmime, imgsize string,
 
 	for _, fn := range files {
 		if !strings.HasSuffix(fn, ".pdf") {
-			rch <- maybeArchItems{Items: []ArchFileItem{{Filename: fn}}}
+			rch <- maybeArchItems{Source: fn, Items: []ArchFileItem{{Filename: fn}}}
 			continue
 		}
 		sfiles, _, err = PdfSplit(ctx, fn, pages)
@@ -238,7 +307,7 @@ func splitPdfMulti(ctx context.Context, files []string, imgmime, imgsize string,
 		}
 		if err != nil {
 			logger.Info("splitting", "file", fn, "error", err)
-			rch <- maybeArchItems{Error: err}
+			rch <- maybeArchItems{Source: fn, Error: err}
 			if isCanceled(err) {
 				return
 			}
@@ -250,7 +319,7 @@ func splitPdfMulti(ctx context.Context, files []string, imgmime, imgsize string,
 			items = append(items, ArchFileItem{Filename: nm})
 		}
 		if imgmime == "" {
-			rch <- maybeArchItems{Items: items}
+			rch <- maybeArchItems{Source: fn, Items: items}
 			continue
 		}
 		if ifiles, err = PdfToImageMulti(ctx, sfiles, imgmime, imgsize); err != nil {
@@ -263,7 +332,7 @@ func splitPdfMulti(ctx context.Context, files []string, imgmime, imgsize string,
 		for _, nm := range ifiles {
 			items = append(items, ArchFileItem{Filename: nm})
 		}
-		rch <- maybeArchItems{Items: items}
+		rch <- maybeArchItems{Source: fn, Items: items}
 	}
 	close(rch)
 }
@@ -381,6 +450,21 @@ func SlurpMail(ctx context.Context, partch chan<- i18nmail.MailPart, errch chan<
 	b := make([]byte, 2048)
 	n, _ := mp.Body.ReadAt(b, 0)
 	b = b[:n]
+	if contentType == MessageEmlx || IsEmlx(b) {
+		if mp.Body, err = EmlxMessage(mp.Body); err != nil {
+			errch <- err
+			return
+		}
+		contentType = messageRFC822
+		n, _ = mp.Body.ReadAt(b[:cap(b)], 0)
+		b = b[:n]
+	}
+	if contentType == multipartRelated { // a web archive (.mht), not a mail
+		mp.ContentType = contentType
+		seePart(ctx, mp)
+		partch <- mp
+		return
+	}
 	if typ := MIMEMatch(b); typ != "" &&
 		!(bytes.Contains(b, []byte("\nTo:")) || bytes.Contains(b, []byte("\nReceived:")) ||
 			bytes.Contains(b, []byte("\nFrom: ")) || bytes.Contains(b, []byte("\nMIME-Version: "))) {
@@ -399,12 +483,16 @@ func SlurpMail(ctx context.Context, partch chan<- i18nmail.MailPart, errch chan<
 		logger.Info("fixed", "contentType", contentType)
 		if contentType != messageRFC822 { // sth else
 			mp.ContentType = contentType
+			seePart(ctx, mp)
 			partch <- mp
 			return
 		}
 	}
 	mp.ContentType = messageRFC822
-	err = i18nmail.Walk(
+	ac := newAuthChecker()
+	seeMessage(ctx, mp, nestingDepth(ctx) > 0)
+	msgs := make(map[int]bool) // the nested messages seen
+	err = walkMail(
 		mp,
 		func(mp i18nmail.MailPart) error {
 			select {
@@ -436,6 +524,18 @@ func SlurpMail(ctx context.Context, partch chan<- i18nmail.MailPart, errch chan<
 			}
 			mp.ContentType = FixContentType(head[:n], mp.ContentType, fn)
 			_, _ = mp.Body.Seek(0, 0)
+			ac.mark(ctx, mp)
+			var nested []*i18nmail.MailPart
+			for p := mp.Parent; p != nil && p.Parent != nil; p = p.Parent {
+				if strings.HasPrefix(p.ContentType, "message/") && !msgs[p.Seq] {
+					msgs[p.Seq] = true
+					nested = append(nested, p)
+				}
+			}
+			for i := len(nested) - 1; i >= 0; i-- {
+				seeMessage(ctx, *nested[i], true)
+			}
+			seePart(ctx, mp)
 			partch <- mp
 			return nil
 		},
@@ -475,7 +575,15 @@ func SetupFilters(
 // MailToPdfFiles converts email to PDF files
 // all mail part goes through all filter in Filters, in reverse order (last first)
 func MailToPdfFiles(ctx context.Context, r io.Reader, contentType string) ([]ArchFileItem, error) {
+	return mailToPdfFiles(ctx, r, contentType, nil)
+}
+
+// mailToPdfFiles is MailToPdfFiles, calling emit (if not nil) with each converted file
+// as soon as it is ready. An emit error cancels the conversion.
+func mailToPdfFiles(ctx context.Context, r io.Reader, contentType string, emit func(ArchFileItem) error) ([]ArchFileItem, error) {
 	logger := getLogger(ctx)
+	ctx, cancel := context.WithCancel(WithExtractLimits(ctx))
+	defer cancel()
 	hsh := sha256.New()
 	sr, e := iohlp.MakeSectionReader(r, InMemorySize)
 	if e != nil {
@@ -544,6 +652,13 @@ Collect:
 					errs = append(errs, fmt.Errorf("%q: zero file", item.Filename))
 				} else {
 					files = append(files, item)
+					if emit != nil {
+						if err := emit(item); err != nil {
+							errs = append(errs, err)
+							emit = nil
+							cancel()
+						}
+					}
 				}
 			}
 		case err := <-errch:
@@ -584,15 +699,24 @@ func convertPart(ctx context.Context, mp i18nmail.MailPart, resultch chan<- Arch
 	)
 
 	fn = savePart(ctx, &mp)
+	ctx, info := startPart(ctx, mp)
 
-	if messageRFC822 != mp.ContentType {
+	if mp.ContentType != messageRFC822 && mp.ContentType != MessageEmlx {
 		converter = GetConverter(mp.ContentType, mp.MediaType)
 	} else {
+		info.Converter = "MailToPdfFiles"
 		_, _ = mp.Body.Seek(0, 0)
-		plus, e := MailToPdfFiles(ctx, mp.Body, mp.ContentType)
+		nested, e := enterNested(ctx, partDepth(ctx, mp)+1)
+		if e != nil {
+			err = fmt.Errorf("convertPart(%02d): %w", mp.Seq, e)
+			finishPart(ctx, info, PartFailed, err)
+			return
+		}
+		plus, e := MailToPdfFiles(nested, mp.Body, mp.ContentType)
 		if e != nil {
 			logger.Info("MailToPdfFiles", "seq", mp.Seq, "error", e)
 			err = fmt.Errorf("convertPart(%02d): %w", mp.Seq, e)
+			finishPart(ctx, info, PartFailed, err)
 			return
 		}
 		for _, elt := range plus {
@@ -601,28 +725,39 @@ func convertPart(ctx context.Context, mp i18nmail.MailPart, resultch chan<- Arch
 			}
 			resultch <- elt
 		}
+		finishPart(ctx, info, PartDone, nil)
 		return nil
 	}
+	info.Converter = converterName(converter)
 	if converter == nil { // no converter for this!?
 		err = fmt.Errorf("no converter for %s", mp.ContentType)
 	} else {
 		err = converter(ctx, fn+".pdf", mp.Body, mp.ContentType)
 	}
 	if err == nil {
-		resultch <- ArchFileItem{Filename: fn + ".pdf"}
+		info.output = fn + ".pdf"
+		if n, _, pErr := pdfPageNum(ctx, info.output); pErr == nil {
+			info.Pages = n
+		}
+		resultch <- ArchFileItem{Filename: info.output}
+		finishPart(ctx, info, PartDone, nil)
 		return nil
 	}
 	if errors.Is(err, ErrSkip) {
+		finishPart(ctx, info, PartSkipped, nil)
 		return nil
 	}
 	_ = unlink(fn, "MailToPdfFiles dest part") // ignore error
 	logger.Info("converting to pdf", "ct", mp.ContentType, "fn", fn, "seq", mp.Seq, "error", err)
 	j := strings.Index(mp.ContentType, "/")
 	_, _ = mp.Body.Seek(0, 0)
-	resultch <- ArchFileItem{
+	item := ArchFileItem{
 		File:    MakeFileLike(mp.Body),
 		Archive: mp.ContentType[:j+1] + filepath.Base(fn),
 		Error:   err}
+	info.Archives = []string{item.Archive}
+	finishPart(ctx, info, PartFailed, err)
+	resultch <- item
 	return nil
 }
 
@@ -759,10 +894,9 @@ func ExtractingFilter(ctx context.Context,
 
 	for part := range allIn {
 		var (
-			format       archives.Extraction
-			rsc          *io.SectionReader
-			err          error
-			archRowCount int
+			rsc     *io.SectionReader
+			err     error
+			entries []archiveEntry
 		)
 		body := part.Body
 		if part.ContentType == "application/x-ole-storage" || part.ContentType == "application/vnd.ms-outlook" {
@@ -791,56 +925,28 @@ func ExtractingFilter(ctx context.Context,
 			continue
 		}
 
-		switch part.ContentType {
-		case applicationZIP:
-			format = archives.Zip{}
-		case "application/rar":
-			format = archives.Rar{}
-		case "application/tar":
-			format = archives.Tar{}
-		default:
+		if !IsArchive(part.ContentType) {
 			goto Skip
 		}
+		if err = checkDepth(partDepth(ctx, part) + 1); err != nil {
+			goto Error
+		}
 		if rsc, err = iohlp.MakeSectionReader(
 			io.LimitReader(body, MaxSize), InMemorySize,
 		); err != nil {
 			goto Error
 		}
-		if err = format.Extract(ctx, rsc, func(ctx context.Context, f archives.FileInfo) error {
-			name := f.Name()
-			if name == "__MACOSX" {
-				logger.Info("skip", "item", name)
-				return nil
-			}
-			if f.IsDir() || f.FileInfo.Size() == 0 {
-				return nil
-			}
-			if zfh, ok := f.Header.(zip.FileHeader); ok && strings.HasPrefix(zfh.Name, "__MACOSX/") {
-				logger.Info("skip", "item", zfh.Name)
-				return nil
-			}
-
-			archRowCount++
-			z, err := f.Open()
-			if err != nil {
-				return err
-			}
-			chunk, cErr := io.ReadAll(z)
-			_ = z.Close()
-			logger.Info("read zip element", "i", archRowCount, "fi", name, "error", err)
-			if cErr != nil {
-				return nil
-			}
+		if entries, err = extractArchive(ctx, headerGetFileName(part.Header), rsc); err != nil {
+			goto Error
+		}
+		for _, e := range entries {
 			child := part.Spawn()
-			child.ContentType = FixContentType(chunk, "application/octet-stream", name)
-			child.Body = io.NewSectionReader(bytes.NewReader(chunk), 0, int64(len(chunk)))
+			child.ContentType = FixContentType(e.head(), "application/octet-stream", e.Name)
+			child.Body = e.Body
 			child.Header = textproto.MIMEHeader(make(map[string][]string, 1))
-			child.Header.Add("X-FileName", safeFn(name, true))
+			child.Header.Add("X-FileName", safeFn(e.Name, true))
 			wg.Add(1)
 			allIn <- child
-			return nil
-		}); err != nil {
-			goto Error
 		}
 		wg.Done()
 		continue
@@ -849,6 +955,12 @@ func ExtractingFilter(ctx context.Context,
 		if err != nil {
 			errch <- err
 		}
+		if errors.Is(err, ErrLimitExceeded) {
+			// do not try to convert it again
+			failPart(ctx, part, err)
+			wg.Done()
+			continue
+		}
 	Skip:
 		wg.Done()
 		outch <- part
@@ -870,13 +982,17 @@ func max(x ...int) int {
 type FilterFunc func(context.Context, <-chan i18nmail.MailPart, chan<- i18nmail.MailPart, chan<- ArchFileItem, chan<- error)
 
 // Filters is the filter pipeline - order is application order
-var Filters = make([]FilterFunc, 0, 6)
+var Filters = make([]FilterFunc, 0, 10)
 
 func init() {
+	Filters = append(Filters, SMIMEFilter)
+	Filters = append(Filters, PGPFilter)
+	Filters = append(Filters, TNEFFilter)
 	Filters = append(Filters, ExtractingFilter)
 	Filters = append(Filters, DupFilter)
 	Filters = append(Filters, TextDecodeFilter)
 	Filters = append(Filters, SaveOriHTMLFilter)
+	Filters = append(Filters, QuoteFilter)
 	Filters = append(Filters, PrependHeaderFilter)
 	Filters = append(Filters, HTMLPartFilter)
 	Filters = append(Filters, DupFilter)
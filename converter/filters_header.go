@@ -1,4 +1,4 @@
-// Copyright 2017, 2023 The Agostle Authors. All rights reserved.
+// Copyright 2017, 2026 The Agostle Authors. All rights reserved.
 // Use of this source code is governed by an Apache 2.0
 // license that can be found in the LICENSE file.
 
@@ -9,11 +9,11 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"html/template"
 	"io"
 	"net/mail"
 	"net/textproto"
 	"os"
+	"slices"
 
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/htmlindex"
@@ -33,16 +33,24 @@ func PrependHeaderFilter(ctx context.Context,
 		close(outch)
 	}()
 	ctx, _ = PrepareContext(ctx, "")
+	opts := getHeaderOptions(ctx)
+	if *opts.Disabled {
+		for part := range inch {
+			outch <- part
+		}
+		return
+	}
+	withAttachments := slices.Contains(opts.Headers, AttachmentsHeader)
 
-	mailHeader := mail.Header(make(map[string][]string, len(PrependHeaders)))
+	mailHeader := mail.Header(make(map[string][]string, len(opts.Headers)))
 	headersBuf := bytes.NewBuffer(make([]byte, 0, 128))
 
 	for part := range inch {
 		logger.Debug("PrependHeaderFilter receives", "seq", part.Seq, "ct", part.ContentType, "header", part.Header, "inch", inch)
 		if len(mailHeader["From"]) == 0 || mailHeader.Get("Subject") == "" {
 			hdrs := make([]textproto.MIMEHeader, 0, 4)
+			parent := &part
 			{
-				parent := &part
 				if len(parent.Header) > 0 {
 					hdrs = append(hdrs, parent.Header)
 				}
@@ -57,17 +65,27 @@ func PrependHeaderFilter(ctx context.Context,
 			if len(hdrs) > 0 {
 				hdr := hdrs[len(hdrs)-1]
 				logger.Info("filling mailHeader", "header", hdr)
-				for _, k := range PrependHeaders {
+				for _, k := range opts.Headers {
 					if v, ok := hdr[k]; ok {
 						mailHeader[k] = v
 					}
 				}
+				if withAttachments && mailHeader[AttachmentsHeader] == nil {
+					mailHeader[AttachmentsHeader] = append(make([]string, 0), attachmentNames(*parent)...)
+				}
 			}
 		}
 
 		if !(part.ContentType == textPlain || part.ContentType == textHtml) {
 			goto Skip
 		}
+		for _, k := range []string{smimeHeader, pgpHeader, authHeader} {
+			if v := part.Header.Get(k); v != "" {
+				mailHeader[k] = []string{v}
+			} else {
+				delete(mailHeader, k)
+			}
+		}
 		headersBuf.Reset()
 		if err := writeHeaders(ctx, headersBuf, mailHeader, part.ContentType); err != nil {
 			logger.Info("error writing headers", "error", err)
@@ -241,7 +259,8 @@ func decodeHTML(ctx context.Context, r io.Reader, deleteMETA bool) io.Reader {
 	return r
 }
 
-// PrependHeaders are the headers which should be prepended to the printed mail
+// PrependHeaders are the headers which should be prepended to the printed mail,
+// if neither the request (HeaderOptions) nor the config (ConfHeaderList) says otherwise.
 var PrependHeaders = []string{"From", "To", "Cc", "Subject", "Date"}
 
 func writeToFile(ctx context.Context, fn string, r io.Reader, contentType string /*, mailHeader mail.Header*/) error {
@@ -260,75 +279,58 @@ func writeToFile(ctx context.Context, fn string, r io.Reader, contentType string
 	return fh.Close()
 }
 
+// writeHeaders writes the header block (as set by the HeaderOptions of ctx) for the text or html part.
 func writeHeaders(ctx context.Context, w io.Writer, mailHeader mail.Header, contentType string) error {
 	logger := getLogger(ctx)
 	if mailHeader == nil || !(contentType == textPlain || contentType == textHtml) {
 		return nil
 	}
-	var buf bytes.Buffer
-	ew := &errWriter{Writer: &buf}
-	var preList, postList, preKey string
-	postKey, preAddr, postAddr := ": ", "<", ">"
-	bol, eol := "  ", "\r\n"
-	escape := func(s string) string { return s }
-
-	if contentType == textHtml {
-		preList, postList = "<div><ul>\n", "</ul></div>\n"
-		preKey, postKey = "<em>", ":</em> "
-		bol, eol = "<li>", "</li>\n"
-		preAddr, postAddr = "&lt;", "&gt;"
-		escape = template.HTMLEscapeString
+	opts := getHeaderOptions(ctx)
+	if *opts.Disabled {
+		return nil
 	}
-
-	_, _ = io.WriteString(ew, preList)
+	block := HeaderBlock{Lang: opts.Lang, Fields: make([]HeaderField, 0, len(opts.Headers)+2)}
 	mh := i18nmail.Header(mailHeader)
-	for _, k := range PrependHeaders {
-		if k == "Subject" || k == "Date" {
-			continue
-		}
-		if mh.Get(k) == "" {
-			continue
-		}
-		_, _ = io.WriteString(ew, bol+preKey+k+postKey)
-		addr, err := mh.AddressList(k)
-		if err != nil {
-			if a, err := i18nmail.ParseAddress(mh.Get(k)); err != nil {
-				logger.Info("parsing address", "of", k, "value", mh.Get(k), "error", err)
-				_, _ = io.WriteString(ew, escape(mh.Get(k)))
-			} else {
-				addr = append(addr, a)
+	for _, k := range opts.Headers {
+		f := HeaderField{Key: k, Label: headerLabel(opts.Lang, k)}
+		switch {
+		case k == AttachmentsHeader:
+			f.Values = mailHeader[k]
+		case mh.Get(k) == "":
+		case addressHeaders[k]:
+			addr, err := mh.AddressList(k)
+			if err != nil {
+				if a, err := i18nmail.ParseAddress(mh.Get(k)); err != nil {
+					logger.Info("parsing address", "of", k, "value", mh.Get(k), "error", err)
+					f.Values = append(f.Values, mh.Get(k))
+				} else {
+					addr = append(addr, a)
+				}
 			}
-		}
-		s := ""
-		for i, a := range addr {
-			_, _ = io.WriteString(ew, s+escape(a.Name)+" "+preAddr+escape(a.Address)+postAddr)
-			if i == 0 {
-				s = ", "
+			for _, a := range addr {
+				f.Values = append(f.Values, a.Name+" <"+a.Address+">")
 			}
+		default:
+			f.Values = []string{i18nmail.HeadDecode(mh.Get(k))}
 		}
-		_, _ = io.WriteString(ew, eol)
+		if len(f.Values) != 0 || k == "Subject" || k == "Date" {
+			block.Fields = append(block.Fields, f)
+		}
+	}
+	if st := getSMIMEStatus(mailHeader); st != nil {
+		block.Fields = append(block.Fields, HeaderField{Key: smimeHeader, Label: headerLabel(opts.Lang, smimeHeader), Values: []string{st.String()}})
+	}
+	if st := getPGPStatus(mailHeader); st != nil {
+		block.Fields = append(block.Fields, HeaderField{Key: pgpHeader, Label: headerLabel(opts.Lang, pgpHeader), Values: []string{st.String()}})
+	}
+	if st := getAuthStatus(mailHeader); st != nil {
+		block.Fields = append(block.Fields, HeaderField{Key: authHeader, Label: headerLabel(opts.Lang, authHeader), Values: []string{st.String()}})
 	}
-	_, _ = io.WriteString(ew, bol+preKey+"Subject"+postKey+escape(i18nmail.HeadDecode(mh.Get("Subject")))+eol)
-	_, _ = io.WriteString(ew, bol+preKey+"Date"+postKey+escape(mh.Get("Date"))+eol)
-	_, _ = io.WriteString(ew, postList)
 
-	if ew.Err != nil {
-		return ew.Err
+	var buf bytes.Buffer
+	if err := getHeaderTemplate(ctx, contentType).Execute(&buf, block); err != nil {
+		return fmt.Errorf("execute header template: %w", err)
 	}
 	_, err := w.Write(buf.Bytes())
 	return err
 }
-
-type errWriter struct {
-	io.Writer
-	Err error
-}
-
-func (ew *errWriter) Write(p []byte) (int, error) {
-	if ew.Err != nil {
-		return 0, ew.Err
-	}
-	var n int
-	n, ew.Err = ew.Writer.Write(p)
-	return n, ew.Err
-}
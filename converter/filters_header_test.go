@@ -1,6 +1,18 @@
 package converter
 
-import "testing"
+import (
+	"context"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tgulacsi/go/i18nmail"
+)
 
 func TestTagIndex(t *testing.T) {
 	for i, tc := range []struct {
@@ -15,3 +27,109 @@ func TestTagIndex(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteHeaders(t *testing.T) {
+	hdr := mail.Header{
+		"From":        {"Feladó Ferenc <ferenc@example.com>"},
+		"To":          {"a@example.com, B <b@example.com>"},
+		"Reply-To":    {"noreply@example.com"},
+		"Subject":     {"=?UTF-8?Q?=C3=A1rv=C3=ADzt=C5=B1r=C5=91?= <test>"},
+		"Date":        {"Sat, 17 Oct 2026 10:00:00 +0200"},
+		"Message-Id":  {"<1234@example.com>"},
+		"Attachments": {"a.pdf", "b.docx"},
+	}
+	for i, tc := range []struct {
+		Options     HeaderOptions
+		ContentType string
+		Want        string
+	}{
+		{HeaderOptions{}, textPlain,
+			"  From: Feladó Ferenc <ferenc@example.com>\r\n" +
+				"  To:  <a@example.com>, B <b@example.com>\r\n" +
+				"  Subject: árvíztűrő <test>\r\n" +
+				"  Date: Sat, 17 Oct 2026 10:00:00 +0200\r\n"},
+		{HeaderOptions{Lang: "hu-HU", Headers: ParseHeaderList("from,subject reply-to,message-id,attachments,bcc")}, textPlain,
+			"  Feladó: Feladó Ferenc <ferenc@example.com>\r\n" +
+				"  Tárgy: árvíztűrő <test>\r\n" +
+				"  Válaszcím:  <noreply@example.com>\r\n" +
+				"  Üzenetazonosító: <1234@example.com>\r\n" +
+				"  Mellékletek: a.pdf, b.docx\r\n"},
+		{HeaderOptions{Headers: []string{"Subject"}}, textHtml,
+			"<div class=\"agostle-header\"><ul>\n" +
+				"<li><em>Subject:</em> árvíztűrő &lt;test&gt;</li>\n" +
+				"</ul></div>\n"},
+		{HeaderOptions{Disabled: new(true)}, textHtml, ""},
+	} {
+		var buf strings.Builder
+		ctx := WithHeaderOptions(context.Background(), tc.Options)
+		if err := writeHeaders(ctx, &buf, hdr, tc.ContentType); err != nil {
+			t.Fatalf("%d. %+v", i, err)
+		}
+		if got := buf.String(); got != tc.Want {
+			t.Errorf("%d. got %q, want %q", i, got, tc.Want)
+		}
+	}
+
+	// the request switches on the header block disabled by the config
+	defer func(disabled bool) { *ConfHeaderDisabled = disabled }(*ConfHeaderDisabled)
+	*ConfHeaderDisabled = true
+	for i, tc := range []struct {
+		Disabled *bool
+		Want     bool
+	}{{nil, false}, {new(true), false}, {new(false), true}} {
+		var buf strings.Builder
+		ctx := WithHeaderOptions(context.Background(), HeaderOptions{Disabled: tc.Disabled, Headers: []string{"Subject"}})
+		if err := writeHeaders(ctx, &buf, hdr, textPlain); err != nil {
+			t.Fatalf("%d. %+v", i, err)
+		}
+		if got := buf.Len() != 0; got != tc.Want {
+			t.Errorf("%d. got %t, want %t", i, got, tc.Want)
+		}
+	}
+}
+
+func TestHeaderTemplateFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "header.tmpl")
+	if err := os.WriteFile(fn, []byte("{{range .Fields}}{{.Key}}\n{{end}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(text string) { *ConfHeaderTextTemplate = text }(*ConfHeaderTextTemplate)
+	*ConfHeaderTextTemplate = fn
+	ctx := context.Background()
+	tmpl := getHeaderTemplate(ctx, textPlain)
+	if tmpl == headerExecuter(headerTextTemplate) {
+		t.Fatal("got the default template")
+	}
+	if got := getHeaderTemplate(ctx, textPlain); got != tmpl {
+		t.Error("the template is parsed again")
+	}
+	// a modified file is parsed again
+	if err := os.WriteFile(fn, []byte("{{range .Fields}}{{.Label}}\n{{end}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(fn, time.Time{}, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got := getHeaderTemplate(ctx, textPlain); got == tmpl {
+		t.Error("the modified template is not parsed again")
+	}
+}
+
+func TestAttachmentNames(t *testing.T) {
+	const msg = "From: a@example.com\r\nSubject: att\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"BND\"\r\n\r\n" +
+		"--BND\r\nContent-Type: text/plain\r\n\r\nbody\r\n" +
+		"--BND\r\nContent-Type: image/png\r\nContent-Disposition: inline; filename=\"logo.png\"\r\n\r\nPNG\r\n" +
+		"--BND\r\nContent-Type: application/pdf; name=\"a.pdf\"\r\nContent-Disposition: attachment\r\n\r\n%PDF\r\n" +
+		"--BND\r\nContent-Type: message/rfc822\r\nContent-Disposition: attachment; filename=\"fwd.eml\"\r\n\r\n" +
+		"From: b@example.com\r\nSubject: inner\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"INNER\"\r\n\r\n" +
+		"--INNER\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=\"inner.pdf\"\r\n\r\n%PDF\r\n" +
+		"--INNER--\r\n" +
+		"\r\n--BND--\r\n"
+	sr := io.NewSectionReader(strings.NewReader(msg), 0, int64(len(msg)))
+	got := attachmentNames(i18nmail.MailPart{Body: sr, ContentType: messageRFC822})
+	if want := []string{"a.pdf", "fwd.eml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"context"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+// AttachmentsHeader is the pseudo-header listing the names of the attached files.
+const AttachmentsHeader = "Attachments"
+
+// HeaderOptions are the options of the header block printed at the beginning of the mail body.
+type HeaderOptions struct {
+	// Headers to print, PrependHeaders if empty.
+	Headers []string
+	// Lang is the language of the labels (ConfHeaderLang if empty).
+	Lang string
+	// Disabled switches off (true) or on (false) the header block, ConfHeaderDisabled decides if nil.
+	Disabled *bool
+}
+
+// IsZero reports whether these are the default options.
+func (o HeaderOptions) IsZero() bool {
+	return o.Disabled == nil && o.Lang == "" && len(o.Headers) == 0
+}
+
+// String returns a compact, stable representation, usable in cache keys.
+func (o HeaderOptions) String() string {
+	s := o.Lang + ":" + strings.Join(o.Headers, ",")
+	if o.Disabled != nil {
+		if *o.Disabled {
+			return "-"
+		}
+		s = "+" + s
+	}
+	return s
+}
+
+// ParseHeaderList parses the comma or space separated list of header names.
+func ParseHeaderList(s string) []string {
+	var hdrs []string
+	for _, k := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		hdrs = append(hdrs, textproto.CanonicalMIMEHeaderKey(k))
+	}
+	return hdrs
+}
+
+type ctxKeyHeaderOptions struct{}
+
+// WithHeaderOptions returns a context which prints the header block according to opts.
+func WithHeaderOptions(ctx context.Context, opts HeaderOptions) context.Context {
+	return context.WithValue(ctx, ctxKeyHeaderOptions{}, opts)
+}
+
+// getHeaderOptions returns the header options of ctx, completed with the configured defaults.
+func getHeaderOptions(ctx context.Context) HeaderOptions {
+	opts, _ := ctx.Value(ctxKeyHeaderOptions{}).(HeaderOptions)
+	if opts.Disabled == nil {
+		opts.Disabled = new(*ConfHeaderDisabled)
+	}
+	if len(opts.Headers) == 0 {
+		if opts.Headers = ParseHeaderList(*ConfHeaderList); len(opts.Headers) == 0 {
+			opts.Headers = PrependHeaders
+		}
+	}
+	if opts.Lang == "" {
+		opts.Lang = *ConfHeaderLang
+	}
+	return opts
+}
+
+// headerLabels are the localized labels of the headers, by language.
+var headerLabels = map[string]map[string]string{
+	"en": {
+		"From": "From", "To": "To", "Cc": "Cc", "Bcc": "Bcc",
+		"Reply-To": "Reply-To", "Sender": "Sender",
+		"Subject": "Subject", "Date": "Date", "Message-Id": "Message-ID",
+		AttachmentsHeader: "Attachments",
+		smimeHeader:       "S/MIME", pgpHeader: "PGP", authHeader: "Authentication",
+	},
+	"hu": {
+		"From": "Feladó", "To": "Címzett", "Cc": "Másolat", "Bcc": "Titkos másolat",
+		"Reply-To": "Válaszcím", "Sender": "Küldő",
+		"Subject": "Tárgy", "Date": "Dátum", "Message-Id": "Üzenetazonosító",
+		AttachmentsHeader: "Mellékletek",
+		smimeHeader:       "S/MIME", pgpHeader: "PGP", authHeader: "Hitelesség",
+	},
+	"de": {
+		"From": "Von", "To": "An", "Cc": "Kopie", "Bcc": "Blindkopie",
+		"Reply-To": "Antwort an", "Sender": "Absender",
+		"Subject": "Betreff", "Date": "Datum", "Message-Id": "Nachrichten-ID",
+		AttachmentsHeader: "Anhänge",
+		smimeHeader:       "S/MIME", pgpHeader: "PGP", authHeader: "Authentizität",
+	},
+}
+
+// headerLabel returns the label of the header in the language (hu-HU falls back to hu, then en).
+func headerLabel(lang, key string) string {
+	lang = strings.ToLower(lang)
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		if s := headerLabels[lang][key]; s != "" {
+			return s
+		}
+		lang = lang[:i]
+	}
+	if s := headerLabels[lang][key]; s != "" {
+		return s
+	}
+	if s := headerLabels["en"][key]; s != "" {
+		return s
+	}
+	return key
+}
+
+// addressHeaders are the headers formatted as address lists.
+var addressHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Reply-To": true, "Sender": true,
+}
+
+// HeaderField is a printed header of the header block template.
+type HeaderField struct {
+	// Key is the canonical header name, Label is its localized label.
+	Key, Label string
+	// Values are the decoded values (the addresses, attachment names).
+	Values []string
+}
+
+// Value returns the values joined by commas.
+func (f HeaderField) Value() string { return strings.Join(f.Values, ", ") }
+
+// HeaderBlock is the data of the header block template.
+type HeaderBlock struct {
+	Lang   string
+	Fields []HeaderField
+}
+
+const (
+	defaultHeaderHTMLTemplate = `<div class="agostle-header"><ul>
+{{range .Fields}}<li><em>{{.Label}}:</em> {{.Value}}</li>
+{{end}}</ul></div>
+`
+	defaultHeaderTextTemplate = "{{range .Fields}}  {{.Label}}: {{.Value}}\r\n{{end}}"
+)
+
+var (
+	headerHTMLTemplate = htmltemplate.Must(htmltemplate.New("header").Parse(defaultHeaderHTMLTemplate))
+	headerTextTemplate = texttemplate.Must(texttemplate.New("header").Parse(defaultHeaderTextTemplate))
+)
+
+type headerExecuter interface {
+	Execute(io.Writer, any) error
+}
+
+// headerTemplates caches the parsed template files, by file name.
+var headerTemplates = struct {
+	m  map[string]cachedHeaderTemplate
+	mu sync.Mutex
+}{m: make(map[string]cachedHeaderTemplate)}
+
+type cachedHeaderTemplate struct {
+	modTime time.Time
+	tmpl    headerExecuter
+}
+
+// getHeaderTemplate returns the header block template for the content type -
+// the one configured in ConfHeaderHTMLTemplate/ConfHeaderTextTemplate, or the default.
+//
+// The template file is parsed again only if its modification time changes.
+func getHeaderTemplate(ctx context.Context, contentType string) headerExecuter {
+	fn, def := *ConfHeaderTextTemplate, headerExecuter(headerTextTemplate)
+	if contentType == textHtml {
+		fn, def = *ConfHeaderHTMLTemplate, headerHTMLTemplate
+	}
+	if fn == "" {
+		return def
+	}
+	fi, err := os.Stat(fn)
+	if err != nil {
+		getLogger(ctx).Warn("read header template", "file", fn, "error", err)
+		return def
+	}
+	headerTemplates.mu.Lock()
+	defer headerTemplates.mu.Unlock()
+	if c, ok := headerTemplates.m[fn]; ok && c.modTime.Equal(fi.ModTime()) {
+		if c.tmpl == nil {
+			return def
+		}
+		return c.tmpl
+	}
+	// a failed read or parse is cached (as nil), too: it is logged only once
+	headerTemplates.m[fn] = cachedHeaderTemplate{modTime: fi.ModTime()}
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		getLogger(ctx).Warn("read header template", "file", fn, "error", err)
+		return def
+	}
+	var tmpl headerExecuter
+	if contentType == textHtml {
+		tmpl, err = htmltemplate.New("header").Parse(string(b))
+	} else {
+		tmpl, err = texttemplate.New("header").Parse(string(b))
+	}
+	if err != nil {
+		getLogger(ctx).Warn("parse header template", "file", fn, "error", err)
+		return def
+	}
+	headerTemplates.m[fn] = cachedHeaderTemplate{modTime: fi.ModTime(), tmpl: tmpl}
+	return tmpl
+}
+
+// attachmentNames returns the names of the attached files of the mail (not descending into attached mails).
+func attachmentNames(root i18nmail.MailPart) []string {
+	var names []string
+	seen := make(map[int]bool)
+	_ = i18nmail.Walk(
+		i18nmail.MailPart{Body: root.GetBody(), ContentType: messageRFC822},
+		func(mp i18nmail.MailPart) error {
+			// the attached mails are not emitted, only their parts
+			var attached *i18nmail.MailPart
+			for p := mp.Parent; p != nil && p.Parent != nil; p = p.Parent {
+				if p.ContentType == messageRFC822 {
+					attached = p
+				}
+			}
+			if attached == nil {
+				if fn := attachmentName(mp.Header); fn != "" {
+					names = append(names, fn)
+				}
+			} else if !seen[attached.Seq] {
+				seen[attached.Seq] = true
+				fn := attachmentName(attached.Header)
+				if fn == "" {
+					fn = i18nmail.HeadDecode(attached.Header.Get("Subject")) + ".eml"
+				}
+				names = append(names, fn)
+			}
+			return nil
+		},
+		false)
+	return names
+}
+
+// attachmentName returns the file name of the part, if it is an attachment.
+func attachmentName(hdr textproto.MIMEHeader) string {
+	disp, params, _ := mime.ParseMediaType(hdr.Get("Content-Disposition"))
+	if disp == "inline" {
+		return ""
+	}
+	if fn := params["filename"]; fn != "" {
+		return fn
+	}
+	if _, params, _ = mime.ParseMediaType(hdr.Get("Content-Type")); params["name"] != "" {
+		return params["name"]
+	}
+	return ""
+}
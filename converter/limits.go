@@ -0,0 +1,170 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+// ErrLimitExceeded is returned when an archive or the nesting of the attached mails and archives
+// exceeds the configured limits (ConfLimitDepth, ConfLimitTotalSize, ConfLimitEntries, ConfLimitRatio).
+var ErrLimitExceeded = errors.New("extraction limit exceeded")
+
+// the compression ratio is not checked below this size
+const ratioMinSize = 1 << 20
+
+// extractLimits accounts the extracted entries and bytes of a request.
+type extractLimits struct {
+	total, entries atomic.Int64
+}
+
+type ctxKeyExtractLimits struct{}
+type ctxKeyNestingDepth struct{}
+
+// WithExtractLimits returns a context which accounts the files extracted from the archives together,
+// for the limits - call it at the start of a request.
+func WithExtractLimits(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(ctxKeyExtractLimits{}).(*extractLimits); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKeyExtractLimits{}, new(extractLimits))
+}
+
+func getExtractLimits(ctx context.Context) *extractLimits {
+	if l, _ := ctx.Value(ctxKeyExtractLimits{}).(*extractLimits); l != nil {
+		return l
+	}
+	return new(extractLimits)
+}
+
+// nestingDepth returns the nesting depth of the context.
+func nestingDepth(ctx context.Context) int {
+	depth, _ := ctx.Value(ctxKeyNestingDepth{}).(int)
+	return depth
+}
+
+// partDepth returns the nesting depth of the part: the number of archives and mails it is in.
+func partDepth(ctx context.Context, mp i18nmail.MailPart) int {
+	depth := nestingDepth(ctx)
+	for p := mp.Parent; p != nil; p = p.Parent {
+		if IsArchive(p.ContentType) || p.ContentType == messageRFC822 && p.Parent != nil {
+			depth++
+		}
+	}
+	return depth
+}
+
+// enterNested returns the context for the content of a part at the depth,
+// or an ErrLimitExceeded if that is deeper than ConfLimitDepth.
+func enterNested(ctx context.Context, depth int) (context.Context, error) {
+	if err := checkDepth(depth); err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, ctxKeyNestingDepth{}, depth), nil
+}
+
+func checkDepth(depth int) error {
+	if *ConfLimitDepth > 0 && depth > *ConfLimitDepth {
+		return fmt.Errorf("%w: nesting depth %d is above %d", ErrLimitExceeded, depth, *ConfLimitDepth)
+	}
+	return nil
+}
+
+// addEntry counts an extracted file.
+func (l *extractLimits) addEntry(name string) error {
+	if n := l.entries.Add(1); *ConfLimitEntries > 0 && n > int64(*ConfLimitEntries) {
+		return fmt.Errorf("%s: %w: more than %d files extracted", name, ErrLimitExceeded, *ConfLimitEntries)
+	}
+	return nil
+}
+
+// allowance returns the number of bytes which may be extracted into the next file, and the limit deciding it:
+// archiveSize is the size of the archive, extracted is the number of bytes extracted from it before.
+func (l *extractLimits) allowance(archiveSize, extracted int64) (int64, string) {
+	allowed, what := int64(MaxSize), fmt.Sprintf("bigger than %d bytes", MaxSize)
+	if *ConfLimitTotalSize > 0 {
+		if rem := *ConfLimitTotalSize - l.total.Load(); rem < allowed {
+			allowed, what = rem, fmt.Sprintf("more than %d bytes extracted", *ConfLimitTotalSize)
+		}
+	}
+	if *ConfLimitRatio > 0 {
+		maxSize := int64(*ConfLimitRatio) * archiveSize
+		if maxSize < ratioMinSize {
+			maxSize = ratioMinSize
+		}
+		if rem := maxSize - extracted; rem < allowed {
+			allowed, what = rem, fmt.Sprintf("compression ratio is above %d", *ConfLimitRatio)
+		}
+	}
+	if allowed < 0 {
+		allowed = 0
+	}
+	return allowed, what
+}
+
+// spool copies the extracted file from r into a file of the working directory within the limits
+// (see allowance), so the extracted files are not kept in memory.
+func (l *extractLimits) spool(ctx context.Context, name string, r io.Reader, archiveSize, extracted int64) (archiveEntry, error) {
+	allowed, what := l.allowance(archiveSize, extracted)
+	_, wd := PrepareContext(ctx, "")
+	fh, err := os.CreateTemp(wd, "extracted-*")
+	if err != nil {
+		return archiveEntry{}, err
+	}
+	n, err := io.Copy(fh, io.LimitReader(r, allowed+1))
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > allowed {
+		err = fmt.Errorf("%s: %w: %s", name, ErrLimitExceeded, what)
+	}
+	if err != nil {
+		_ = os.Remove(fh.Name())
+		return archiveEntry{}, err
+	}
+	l.total.Add(n)
+	return archiveEntry{Name: name, Body: io.NewSectionReader(fileReaderAt(fh.Name()), 0, n), file: fh.Name()}, nil
+}
+
+// charge counts the extracted file of size bytes, already in memory, within the limits (see allowance).
+func (l *extractLimits) charge(name string, size, archiveSize, extracted int64) error {
+	if allowed, what := l.allowance(archiveSize, extracted); size > allowed {
+		return fmt.Errorf("%s: %w: %s", name, ErrLimitExceeded, what)
+	}
+	l.total.Add(size)
+	return nil
+}
+
+// release gives back the files and bytes of a failed extraction attempt (as a wrong password), before the next one.
+func (l *extractLimits) release(entries, size int64) {
+	l.entries.Add(-entries)
+	l.total.Add(-size)
+}
+
+// fileReaderAt reads the named file, opening it for each ReadAt,
+// so the many spooled files do not hold file descriptors.
+type fileReaderAt string
+
+func (fn fileReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	fh, err := os.Open(string(fn))
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+	return fh.ReadAt(p, off)
+}
+
+// failPart records the part as failed.
+func failPart(ctx context.Context, mp i18nmail.MailPart, err error) {
+	ctx, info := startPart(ctx, mp)
+	finishPart(ctx, info, PartFailed, err)
+}
@@ -0,0 +1,104 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+func TestExtractLimits(t *testing.T) {
+	var bomb, tgz bytes.Buffer
+	{
+		zw := gzip.NewWriter(&bomb)
+		_, _ = zw.Write(make([]byte, 4<<20))
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		zw = gzip.NewWriter(&tgz)
+		tw := tar.NewWriter(zw)
+		for _, nm := range []string{"a.txt", "b.txt", "c.txt"} {
+			if err := tw.WriteHeader(&tar.Header{Name: nm, Mode: 0644, Size: 1000}); err != nil {
+				t.Fatal(err)
+			}
+			_, _ = tw.Write(bytes.Repeat([]byte{'x'}, 1000))
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(ratio, entries int, total int64) {
+		*ConfLimitRatio, *ConfLimitEntries, *ConfLimitTotalSize = ratio, entries, total
+	}(*ConfLimitRatio, *ConfLimitEntries, *ConfLimitTotalSize)
+	for i, tc := range []struct {
+		Name           string
+		Data           []byte
+		Ratio, Entries int
+		TotalSize      int64
+		WantErr        error
+	}{
+		{Name: "bomb.gz", Data: bomb.Bytes(), Ratio: 100, WantErr: ErrLimitExceeded},
+		{Name: "bomb.gz", Data: bomb.Bytes()},
+		{Name: "a.tar.gz", Data: tgz.Bytes(), Entries: 2, WantErr: ErrLimitExceeded},
+		{Name: "a.tar.gz", Data: tgz.Bytes(), TotalSize: 2500, WantErr: ErrLimitExceeded},
+		{Name: "a.tar.gz", Data: tgz.Bytes(), Ratio: 100, Entries: 3, TotalSize: 3000},
+	} {
+		*ConfLimitRatio, *ConfLimitEntries, *ConfLimitTotalSize = tc.Ratio, tc.Entries, tc.TotalSize
+		ctx := WithExtractLimits(context.Background())
+		_, err := extractArchive(ctx, tc.Name, io.NewSectionReader(bytes.NewReader(tc.Data), 0, int64(len(tc.Data))))
+		if tc.WantErr == nil && err != nil || tc.WantErr != nil && !errors.Is(err, tc.WantErr) {
+			t.Errorf("%d. %s: got %v, want %v", i, tc.Name, err, tc.WantErr)
+		}
+	}
+}
+
+func TestPartDepth(t *testing.T) {
+	defer func(depth int) { *ConfLimitDepth = depth }(*ConfLimitDepth)
+	*ConfLimitDepth = 2
+
+	root := i18nmail.MailPart{ContentType: messageRFC822}
+	zip := root.Spawn()
+	zip.ContentType = applicationZIP
+	inner := zip.Spawn()
+	inner.ContentType = messageRFC822
+	eml := inner.Spawn()
+	eml.ContentType = "text/plain"
+
+	ctx := context.Background()
+	for i, tc := range []struct {
+		Part i18nmail.MailPart
+		Want int
+	}{
+		{Part: root, Want: 0},
+		{Part: zip, Want: 0},
+		{Part: inner, Want: 1},
+		{Part: eml, Want: 2},
+	} {
+		if got := partDepth(ctx, tc.Part); got != tc.Want {
+			t.Errorf("%d. got %d, want %d", i, got, tc.Want)
+		}
+	}
+	if _, err := enterNested(ctx, partDepth(ctx, eml)+1); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("got %v, want %v", err, ErrLimitExceeded)
+	}
+	nested, err := enterNested(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := partDepth(nested, zip); got != 2 {
+		t.Errorf("got %d, want 2", got)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"net/textproto"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/renameio/v2"
+)
+
+// name of the manifest in the resulting archive
+const ManifestFn = "manifest.json"
+
+// Manifest lists the parts of a converted mail.
+type Manifest struct {
+	Parts []PartInfo
+	mu    sync.Mutex
+
+	// the parts read by SlurpMail and the mail's header, for the cover page
+	seen   []CoverPart
+	header textproto.MIMEHeader
+	// the raw headers of the messages, for the appendix
+	rawHeaders []rawHeaders
+}
+
+type ctxKeyManifest struct{}
+
+func withManifest(ctx context.Context) (context.Context, *Manifest) {
+	m := new(Manifest)
+	return context.WithValue(ctx, ctxKeyManifest{}, m), m
+}
+
+func getManifest(ctx context.Context) *Manifest {
+	m, _ := ctx.Value(ctxKeyManifest{}).(*Manifest)
+	return m
+}
+
+func (m *Manifest) add(info *PartInfo) {
+	m.mu.Lock()
+	m.Parts = append(m.Parts, *info)
+	m.mu.Unlock()
+}
+
+// setArchives records the archive names of the items produced from the parts' output.
+func (m *Manifest) setArchives(items []ArchFileItem, sources map[string]string) {
+	names := make(map[string][]string, len(items))
+	for _, item := range items {
+		src := item.Filename
+		if s := sources[src]; s != "" {
+			src = s
+		}
+		nm := item.Archive
+		if nm == "" {
+			nm = unsafeFn(filepath.Base(item.Filename), true)
+		}
+		names[src] = append(names[src], nm)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, p := range m.Parts {
+		if p.output == "" {
+			continue
+		}
+		if nms := names[p.output]; len(nms) != 0 {
+			sort.Strings(nms)
+			m.Parts[i].Archives = nms
+		}
+	}
+}
+
+// WriteFile writes the manifest as JSON into fn.
+func (m *Manifest) WriteFile(fn string) error {
+	m.mu.Lock()
+	parts := append([]PartInfo(nil), m.Parts...)
+	m.mu.Unlock()
+	sort.Slice(parts, func(i, j int) bool {
+		if parts[i].Level == parts[j].Level {
+			return parts[i].Seq < parts[j].Seq
+		}
+		return parts[i].Level < parts[j].Level
+	})
+	b, err := json.MarshalIndent(Manifest{Parts: parts}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return renameio.WriteFile(fn, b, 0640)
+}
+
+// converterName returns the name of the converter function.
+func converterName(c Converter) string {
+	if c == nil {
+		return ""
+	}
+	f := runtime.FuncForPC(reflect.ValueOf(c).Pointer())
+	if f == nil {
+		return ""
+	}
+	nm := f.Name()
+	if i := strings.LastIndexByte(nm, '/'); i >= 0 {
+		nm = nm[i+1:]
+	}
+	if _, after, ok := strings.Cut(nm, "."); ok {
+		nm = after
+	}
+	if before, _, ok := strings.Cut(nm, ".func"); ok {
+		nm = before
+	}
+	return nm
+}
@@ -0,0 +1,50 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConverterName(t *testing.T) {
+	for i, tc := range []struct {
+		Converter Converter
+		Want      string
+	}{
+		{nil, ""},
+		{ImageToPdf, "ImageToPdf"},
+		{NewTextConverter("iso-8859-2"), "NewTextConverter"},
+	} {
+		if got := converterName(tc.Converter); got != tc.Want {
+			t.Errorf("%d. got %q, want %q", i, got, tc.Want)
+		}
+	}
+}
+
+func TestManifestArchives(t *testing.T) {
+	var m Manifest
+	m.add(&PartInfo{Seq: 1, output: "/tmp/x/00#001.text--plain.pdf"})
+	m.add(&PartInfo{Seq: 2, output: "/tmp/x/00#002.image--png.pdf"})
+	m.add(&PartInfo{Seq: 3, Archives: []string{"application/00#003.application--zip"}})
+	m.setArchives([]ArchFileItem{
+		{Filename: "/tmp/x/00#001.text--plain.pdf"},
+		{Filename: "/tmp/x/00#002.image--png-002.pdf"},
+		{Filename: "/tmp/x/00#002.image--png-001.pdf"},
+		{Archive: "application/00#003.application--zip"},
+	}, map[string]string{
+		"/tmp/x/00#002.image--png-001.pdf": "/tmp/x/00#002.image--png.pdf",
+		"/tmp/x/00#002.image--png-002.pdf": "/tmp/x/00#002.image--png.pdf",
+	})
+	for i, want := range [][]string{
+		{"00#001.text--plain.pdf"},
+		{"00#002.image--png-001.pdf", "00#002.image--png-002.pdf"},
+		{"application/00#003.application--zip"},
+	} {
+		if got := m.Parts[i].Archives; !reflect.DeepEqual(got, want) {
+			t.Errorf("%d. got %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/tgulacsi/go/i18nmail"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// ApplicationMbox is the content type of the mbox files.
+	ApplicationMbox = "application/mbox"
+	// MessageEmlx is the content type of the Apple Mail .emlx files.
+	MessageEmlx = "message/x-emlx"
+)
+
+// name of the index of the messages in the resulting archive
+const MboxIndexFn = "index.json"
+
+// MboxIndexEntry describes a converted message of a mailbox.
+type MboxIndexEntry struct {
+	// Folder is the folder of the message's files in the archive.
+	Folder                         string
+	Subject, From, Date, MessageID string `json:",omitempty"`
+	Error                          string `json:",omitempty"`
+	Files                          []string
+	Seq                            int
+	Size                           int64
+}
+
+// IsMbox reports whether b is the beginning of an mbox file:
+// a "From " line followed by a header line.
+func IsMbox(b []byte) bool {
+	if !bytes.HasPrefix(b, []byte("From ")) {
+		return false
+	}
+	_, next, ok := bytes.Cut(b, []byte("\n"))
+	return ok && isHeaderLine(next)
+}
+
+// isHeaderLine reports whether b starts with a "Name:" header line.
+func isHeaderLine(b []byte) bool {
+	i := bytes.IndexByte(b, ':')
+	return i > 0 && bytes.IndexFunc(b[:i], func(r rune) bool { return r <= ' ' || r > '~' }) < 0
+}
+
+// IsEmlx reports whether b is the beginning of an Apple Mail .emlx file:
+// the length of the message in the first line, followed by the message.
+func IsEmlx(b []byte) bool {
+	_, _, ok := emlxLength(b)
+	return ok
+}
+
+// emlxLength returns the length of the message and the length of the first line of the .emlx.
+func emlxLength(b []byte) (length int64, start int, ok bool) {
+	line, next, found := bytes.Cut(b, []byte("\n"))
+	if !found || !isHeaderLine(next) {
+		return 0, 0, false
+	}
+	start = len(line) + 1
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || len(line) > 18 {
+		return 0, 0, false
+	}
+	for _, c := range line {
+		if c < '0' || c > '9' {
+			return 0, 0, false
+		}
+		length = length*10 + int64(c-'0')
+	}
+	return length, start, true
+}
+
+// EmlxMessage returns the message of the .emlx file,
+// without the length prefix and the property list trailer.
+func EmlxMessage(sr *io.SectionReader) (*io.SectionReader, error) {
+	b := make([]byte, 256)
+	n, err := sr.ReadAt(b, 0)
+	if n == 0 && err != nil {
+		return nil, err
+	}
+	length, start, ok := emlxLength(b[:n])
+	if !ok {
+		return nil, errors.New("not an emlx: no message length in the first line")
+	}
+	if rest := sr.Size() - int64(start); length > rest {
+		length = rest
+	}
+	return io.NewSectionReader(sr, int64(start), length), nil
+}
+
+// MboxMessages returns the messages of the mbox file (mboxo or mboxrd).
+func MboxMessages(r io.Reader) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		br := bufio.NewReader(r)
+		var msg bytes.Buffer
+		var started, blank bool
+		flush := func() bool {
+			if !started {
+				return true
+			}
+			b := msg.Bytes()
+			if blank { // the empty line before the next From line belongs to the mbox
+				b = bytes.TrimSuffix(bytes.TrimSuffix(b, []byte("\n")), []byte("\r"))
+			}
+			return yield(bytes.Clone(b), nil)
+		}
+		for {
+			line, err := br.ReadBytes('\n')
+			if len(line) != 0 {
+				if bytes.HasPrefix(line, []byte("From ")) && (!started || blank) {
+					if !flush() {
+						return
+					}
+					msg.Reset()
+					started, blank = true, false
+					continue
+				}
+				if !started {
+					yield(nil, errors.New("not an mbox: no From line at the beginning"))
+					return
+				}
+				// >From, >>From... are escaped From lines (mboxrd)
+				if i := bytes.IndexFunc(line, func(r rune) bool { return r != '>' }); i > 0 && bytes.HasPrefix(line[i:], []byte("From ")) {
+					line = line[1:]
+				}
+				if int64(msg.Len()+len(line)) > MaxSize {
+					yield(nil, fmt.Errorf("message is bigger than %d bytes", MaxSize))
+					return
+				}
+				msg.Write(line)
+				blank = len(bytes.TrimRight(line, "\r\n")) == 0
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					yield(nil, err)
+					return
+				}
+				flush()
+				return
+			}
+		}
+	}
+}
+
+// MaildirMessages returns the messages of the Maildir (from new and cur).
+func MaildirMessages(dir string) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		for _, sub := range []string{"new", "cur"} {
+			des, err := os.ReadDir(filepath.Join(dir, sub))
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				yield(nil, err)
+				return
+			}
+			for _, de := range des {
+				if !de.Type().IsRegular() || strings.HasPrefix(de.Name(), ".") {
+					continue
+				}
+				b, err := os.ReadFile(filepath.Join(dir, sub, de.Name()))
+				if !yield(b, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// IsMaildir reports whether the dir is a Maildir (has a cur or new subdirectory).
+func IsMaildir(dir string) bool {
+	for _, sub := range []string{"cur", "new"} {
+		if fi, err := os.Stat(filepath.Join(dir, sub)); err == nil && fi.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// MboxToPdfZip converts the messages of the mbox to a ZIP, with one folder per message
+// (the result of MailToSplittedPdfZip) and an index.
+func MboxToPdfZip(ctx context.Context, destfn string, r io.Reader,
+	split bool, imgmime, imgsize string, pages []uint16,
+) error {
+	return MailboxToPdfZip(ctx, destfn, MboxMessages(r), split, imgmime, imgsize, pages)
+}
+
+// MailboxToPdfZip converts the messages to a ZIP, with one folder per message
+// (the result of MailToSplittedPdfZip) and an index.
+//
+// At most ConfMboxParallel messages are converted in parallel.
+func MailboxToPdfZip(ctx context.Context, destfn string, messages iter.Seq2[[]byte, error],
+	split bool, imgmime, imgsize string, pages []uint16,
+) error {
+	logger := getLogger(ctx)
+	ctx, wd := PrepareContext(ctx, "")
+	parallel := *ConfMboxParallel
+	if parallel <= 0 {
+		parallel = Concurrency
+	}
+
+	var entries []*MboxIndexEntry
+	defer func() {
+		for _, e := range entries {
+			_ = os.RemoveAll(filepath.Join(wd, mboxWorkDir(e.Seq)))
+		}
+	}()
+	grp, grpCtx := errgroup.WithContext(ctx)
+	grp.SetLimit(parallel)
+	var err error
+	for b, iterErr := range messages {
+		if iterErr != nil {
+			err = iterErr
+			break
+		}
+		if err = grpCtx.Err(); err != nil {
+			break
+		}
+		entry := newMboxIndexEntry(len(entries)+1, b)
+		entries = append(entries, entry)
+		grp.Go(func() error {
+			mctx, mwd := PrepareContext(grpCtx, mboxWorkDir(entry.Seq))
+			convErr := MailToSplittedPdfZip(mctx, filepath.Join(mwd, "result.zip"),
+				bytes.NewReader(b), messageRFC822, split, imgmime, imgsize, pages)
+			if convErr == nil {
+				return nil
+			}
+			if isCanceled(convErr) {
+				return convErr
+			}
+			logger.Warn("convert message", "seq", entry.Seq, "subject", entry.Subject, "error", convErr)
+			entry.Error = convErr.Error()
+			// keep the original
+			return os.WriteFile(filepath.Join(mwd, "message.eml"), b, 0640)
+		})
+	}
+	if grpErr := grp.Wait(); err == nil {
+		err = grpErr
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return errors.New("no messages found")
+	}
+
+	destfh, err := openOut(destfn)
+	if err != nil {
+		return fmt.Errorf("open out %s: %w", destfn, err)
+	}
+	defer func() { _ = destfh.Close() }()
+	zw := zip.NewWriter(destfh)
+	for _, entry := range entries {
+		if err = addMboxEntry(zw, filepath.Join(wd, mboxWorkDir(entry.Seq)), entry); err != nil {
+			return err
+		}
+	}
+	w, err := zw.Create(MboxIndexFn)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(entries); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	return destfh.Close()
+}
+
+// mboxWorkDir is the name of the message's working (sub)directory.
+func mboxWorkDir(seq int) string { return fmt.Sprintf("mbox-%06d", seq) }
+
+// newMboxIndexEntry returns the index entry of the message, with the data from its header.
+func newMboxIndexEntry(seq int, b []byte) *MboxIndexEntry {
+	entry := MboxIndexEntry{Seq: seq, Size: int64(len(b))}
+	if msg, err := mail.ReadMessage(bytes.NewReader(b)); err == nil {
+		hdr := msg.Header
+		entry.Subject = i18nmail.HeadDecode(hdr.Get("Subject"))
+		entry.From = i18nmail.HeadDecode(hdr.Get("From"))
+		entry.Date = hdr.Get("Date")
+		entry.MessageID = hdr.Get("Message-Id")
+	}
+	entry.Folder = fmt.Sprintf("%04d", seq)
+	if s := mboxFolderName(entry.Subject); s != "" {
+		entry.Folder += "-" + s
+	}
+	return &entry
+}
+
+// mboxFolderName returns a file name safe, shortened version of the subject.
+func mboxFolderName(subject string) string {
+	s := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, subject)
+	s = strings.Trim(s, "_.")
+	if r := []rune(s); len(r) > 40 {
+		s = strings.TrimRight(string(r[:40]), "_.")
+	}
+	return s
+}
+
+// addMboxEntry copies the converted files (result.zip's content, or the original message) of the entry to zw,
+// into the entry's folder.
+func addMboxEntry(zw *zip.Writer, dir string, entry *MboxIndexEntry) error {
+	if b, err := os.ReadFile(filepath.Join(dir, "message.eml")); err == nil {
+		w, err := zw.Create(entry.Folder + "/message.eml")
+		if err != nil {
+			return err
+		}
+		entry.Files = append(entry.Files, "message.eml")
+		if _, err = w.Write(b); err != nil {
+			return err
+		}
+	}
+	zr, err := zip.OpenReader(filepath.Join(dir, "result.zip"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		fh := f.FileHeader
+		fh.Name = entry.Folder + "/" + f.Name
+		w, err := zw.CreateRaw(&fh)
+		if err != nil {
+			return err
+		}
+		r, err := f.OpenRaw()
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(w, r); err != nil {
+			return err
+		}
+		entry.Files = append(entry.Files, f.Name)
+	}
+	sort.Strings(entry.Files)
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMbox = "From alice@example.com Sat Oct 17 10:00:00 2026\n" +
+	"From: alice@example.com\nSubject: first/one\n\nHello\n>From the start\n>>From here\n\n" +
+	"From bob@example.com Sat Oct 17 11:00:00 2026\r\n" +
+	"From: bob@example.com\r\nSubject: =?UTF-8?Q?m=C3=A1sodik?=\r\n\r\n>From now on\r\n\r\n"
+
+func TestMboxMessages(t *testing.T) {
+	var got []string
+	for b, err := range MboxMessages(strings.NewReader(testMbox)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(b))
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d messages, want 2", len(got))
+	}
+	for i, want := range []string{
+		"From: alice@example.com\nSubject: first/one\n\nHello\nFrom the start\n>From here\n",
+		"From: bob@example.com\r\nSubject: =?UTF-8?Q?m=C3=A1sodik?=\r\n\r\nFrom now on\r\n",
+	} {
+		if got[i] != want {
+			t.Errorf("%d. got %q, want %q", i, got[i], want)
+		}
+	}
+
+	for i, tc := range []struct {
+		Text string
+		Want bool
+	}{
+		{testMbox, true},
+		{"From: alice@example.com\n\nbody\n", false},
+		{"From now on\nthis is text: nothing else\n", false},
+	} {
+		if got := IsMbox([]byte(tc.Text)); got != tc.Want {
+			t.Errorf("%d. got %t, want %t", i, got, tc.Want)
+		}
+	}
+	for _, err := range MboxMessages(strings.NewReader("From: alice@example.com\n\nbody\n")) {
+		if err == nil {
+			t.Error("no error for a plain message")
+		}
+	}
+}
+
+func TestMaildirMessages(t *testing.T) {
+	dir := t.TempDir()
+	for _, fn := range []string{"new/2", "cur/1:2,S", "cur/.hidden", "tmp/3"} {
+		fn = filepath.Join(dir, fn)
+		if err := os.MkdirAll(filepath.Dir(fn), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, []byte(filepath.Base(fn)), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !IsMaildir(dir) {
+		t.Errorf("%q is not a Maildir", dir)
+	}
+	var got []string
+	for b, err := range MaildirMessages(dir) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(b))
+	}
+	if want := "2 1:2,S"; strings.Join(got, " ") != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMboxToPdfZip(t *testing.T) {
+	dir := t.TempDir()
+	ctx, _ := PrepareContext(context.Background(), filepath.Base(dir))
+	destfn := filepath.Join(dir, "out.zip")
+	if err := MboxToPdfZip(ctx, destfn, strings.NewReader(testMbox), false, "", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(destfn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	names := make(map[string]bool)
+	var entries []MboxIndexEntry
+	for _, f := range zr.File {
+		names[f.Name] = true
+		if f.Name != MboxIndexFn {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.NewDecoder(rc).Decode(&entries)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2 (files: %v)", len(entries), names)
+	}
+	for i, want := range []string{"0001-first_one", "0002-második"} {
+		e := entries[i]
+		if e.Folder != want {
+			t.Errorf("%d. got folder %q, want %q", i, e.Folder, want)
+		}
+		if len(e.Files) == 0 {
+			t.Errorf("%d. no files", i)
+		}
+		for _, fn := range e.Files {
+			if !names[e.Folder+"/"+fn] {
+				t.Errorf("%d. %q is not in the archive", i, e.Folder+"/"+fn)
+			}
+		}
+	}
+}
@@ -29,7 +29,7 @@ import (
 	"github.com/tgulacsi/go/pdf"
 )
 
-var popplerOk = map[string]string{"pdfinfo": "", "pdfseparate": "", "pdfunite": ""}
+var popplerOk = map[string]string{"pdfinfo": "", "pdfseparate": "", "pdfunite": "", "pdftotext": ""}
 
 const (
 	pcNotChecked = 0
@@ -691,8 +691,53 @@ func PdfRewrite(ctx context.Context, destfn, srcfn string) error {
 	return moveFile(pdffn2, destfn)
 }
 
+// PdfToText writes the text of the PDF into w, using pdftotext or mutool.
+func PdfToText(ctx context.Context, w io.Writer, inpfn string) error {
+	var c *cmd
+	if pdftotext := popplerOk["pdftotext"]; pdftotext != "" {
+		// nosemgrep: go.lang.security.audit.dangerous-exec-command.dangerous-exec-command
+		c = Exec.CommandContext(ctx, pdftotext, "-enc", "UTF-8", inpfn, "-")
+	} else if *ConfMutool != "" {
+		// nosemgrep: go.lang.security.audit.dangerous-exec-command.dangerous-exec-command
+		c = Exec.CommandContext(ctx, *ConfMutool, "draw", "-F", "txt", "-o", "-", inpfn)
+	} else {
+		return errors.New("neither pdftotext nor mutool is available")
+	}
+	var errBuf strings.Builder
+	c.Stdout, c.Stderr = w, &errBuf
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("%s: %s: %w", c, errBuf.String(), err)
+	}
+	return nil
+}
+
 // PdfDumpFields dumps the field names from the given PDF.
 func PdfDumpFields(ctx context.Context, inpfn string) ([]string, error) {
+	fields, err := PdfFields(ctx, inpfn)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+	}
+	return names, nil
+}
+
+// PdfField is a form field of a PDF.
+type PdfField struct {
+	Name    string
+	Type    string   `json:",omitempty"` // Text, Button, Choice, Signature
+	AltName string   `json:",omitempty"`
+	Value   string   `json:",omitempty"`
+	Default string   `json:",omitempty"`
+	Options []string `json:",omitempty"` // checkbox states, choice list
+	Flags   int      `json:",omitempty"`
+	MaxLen  int      `json:",omitempty"`
+}
+
+// PdfFields returns the form fields of the given PDF.
+func PdfFields(ctx context.Context, inpfn string) ([]PdfField, error) {
 	var buf bytes.Buffer
 	// nosemgrep: go.lang.security.audit.dangerous-exec-command.dangerous-exec-command
 	cmd := Exec.CommandContext(ctx, *ConfPdftk, inpfn, "dump_data_fields_utf8", "output", "-")
@@ -700,13 +745,49 @@ func PdfDumpFields(ctx context.Context, inpfn string) ([]string, error) {
 	if err := cmd.Run(); err != nil {
 		return nil, err
 	}
-	var fields []string
-	for _, line := range bytes.Split(buf.Bytes(), []byte("\n")) {
-		if bytes.HasPrefix(line, []byte("FieldName: ")) {
-			fields = append(fields, string(bytes.TrimSpace(line[11:])))
+	return parsePdftkFields(buf.Bytes()), nil
+}
+
+// parsePdftkFields parses the output of pdftk dump_data_fields_utf8.
+func parsePdftkFields(b []byte) []PdfField {
+	var fields []PdfField
+	var act *PdfField
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		if bytes.Equal(bytes.TrimSpace(line), []byte("---")) {
+			act = nil
+			continue
 		}
-	}
-	return fields, nil
+		k, v, ok := bytes.Cut(line, []byte(": "))
+		if !ok {
+			if k, ok = bytes.CutSuffix(bytes.TrimRight(line, "\r"), []byte(":")); !ok {
+				continue
+			}
+		}
+		if act == nil {
+			fields = append(fields, PdfField{})
+			act = &fields[len(fields)-1]
+		}
+		val := string(bytes.TrimRight(v, "\r"))
+		switch string(k) {
+		case "FieldType":
+			act.Type = val
+		case "FieldName":
+			act.Name = val
+		case "FieldNameAlt":
+			act.AltName = val
+		case "FieldValue":
+			act.Value = val
+		case "FieldValueDefault":
+			act.Default = val
+		case "FieldStateOption":
+			act.Options = append(act.Options, val)
+		case "FieldFlags":
+			act.Flags, _ = strconv.Atoi(val)
+		case "FieldMaxLength":
+			act.MaxLen, _ = strconv.Atoi(val)
+		}
+	}
+	return fields
 }
 
 // PdfDumpFdf dumps the FDF from the given PDF.
@@ -721,8 +802,17 @@ var fillFdfMu sync.Mutex
 
 // PdfFillFdf fills the FDF and generates PDF.
 func PdfFillFdf(ctx context.Context, destfn, inpfn string, values map[string]string) error {
+	return PdfFillForm(ctx, destfn, inpfn, values, false)
+}
+
+// PdfFillForm fills the form fields of the PDF with the given values,
+// and flattens the result, if asked so.
+func PdfFillForm(ctx context.Context, destfn, inpfn string, values map[string]string, flatten bool) error {
 	if len(values) == 0 {
-		return copyFile(inpfn, destfn)
+		if !flatten {
+			return copyFile(inpfn, destfn)
+		}
+		return call(ctx, *ConfPdftk, inpfn, "output", destfn, "flatten")
 	}
 	fp, err := getFdf(ctx, inpfn)
 	if err != nil {
@@ -739,7 +829,12 @@ func PdfFillFdf(ctx context.Context, destfn, inpfn string, values map[string]str
 	}
 
 	// nosemgrep: go.lang.security.audit.dangerous-exec-command.dangerous-exec-command
-	cmd := Exec.CommandContext(ctx, *ConfPdftk, inpfn, "fill_form", "-", "output", destfn)
+	args := []string{inpfn, "fill_form", "-", "output", destfn}
+	if flatten {
+		args = append(args, "flatten")
+	}
+	// nosemgrep: go.lang.security.audit.dangerous-exec-command.dangerous-exec-command
+	cmd := Exec.CommandContext(ctx, *ConfPdftk, args...)
 	cmd.Stdin = bytes.NewReader(buf.Bytes())
 	return execute(cmd)
 }
@@ -688,3 +688,41 @@ trailer
 		t.Errorf("mismatch: %s", df)
 	}
 }
+
+func TestParsePdftkFields(t *testing.T) {
+	dump := []byte(`---
+FieldType: Text
+FieldName: Given Name Text Box
+FieldNameAlt: First name
+FieldFlags: 0
+FieldValue: Árvíztűrő
+FieldJustification: Left
+FieldMaxLength: 40
+---
+FieldType: Button
+FieldName: Driving License Check Box
+FieldFlags: 0
+FieldValue: Off
+FieldJustification: Left
+FieldStateOption: Off
+FieldStateOption: Yes
+---
+FieldType: Choice
+FieldName: Favourite Colour List Box
+FieldFlags: 131072
+FieldValue: Red
+FieldValueDefault: Red
+FieldJustification: Left
+FieldStateOption: Black
+FieldStateOption: Red
+`)
+	want := []PdfField{
+		{Name: "Given Name Text Box", Type: "Text", AltName: "First name", Value: "Árvíztűrő", MaxLen: 40},
+		{Name: "Driving License Check Box", Type: "Button", Value: "Off", Options: []string{"Off", "Yes"}},
+		{Name: "Favourite Colour List Box", Type: "Choice", Value: "Red", Default: "Red", Flags: 131072, Options: []string{"Black", "Red"}},
+	}
+	got := parsePdftkFields(dump)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
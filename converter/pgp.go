@@ -0,0 +1,319 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+// pgpHeader carries the JSON encoded PGPStatus of the part.
+const pgpHeader = "X-Agostle-Pgp"
+
+// PGPStatus is the result of the PGP/MIME processing of a part.
+type PGPStatus struct {
+	Encrypted bool   `json:",omitempty"`
+	Signed    bool   `json:",omitempty"`
+	Signer    string `json:",omitempty"`
+	KeyID     string `json:",omitempty"`
+	Valid     bool   `json:",omitempty"`
+	// Error is the signature verification error.
+	Error string `json:",omitempty"`
+}
+
+func (st PGPStatus) String() string {
+	var parts []string
+	if st.Encrypted {
+		parts = append(parts, "encrypted")
+	}
+	if st.Signed {
+		s := "signed"
+		if st.Signer != "" {
+			s += " by " + st.Signer
+		}
+		if st.KeyID != "" {
+			s += " (key " + st.KeyID + ")"
+		}
+		if st.Valid {
+			s += ", valid signature"
+		} else {
+			s += ", INVALID signature: " + st.Error
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (st PGPStatus) isZero() bool { return !st.Encrypted && !st.Signed }
+
+// merge returns st with the signature of inner, if that is signed.
+func (st PGPStatus) merge(inner PGPStatus) PGPStatus {
+	st.Encrypted = st.Encrypted || inner.Encrypted
+	if inner.Signed {
+		encrypted := st.Encrypted
+		st = inner
+		st.Encrypted = encrypted
+	}
+	return st
+}
+
+// getPGPStatus returns the PGP status recorded in the header by PGPFilter.
+func getPGPStatus(hdr map[string][]string) *PGPStatus {
+	vv := hdr[pgpHeader]
+	if len(vv) == 0 {
+		return nil
+	}
+	var st PGPStatus
+	if err := json.Unmarshal([]byte(vv[0]), &st); err != nil {
+		return nil
+	}
+	return &st
+}
+
+// loadPGPKeyring reads the (armored or binary) keyring,
+// and decrypts its private keys with the configured passphrase.
+func loadPGPKeyring() (openpgp.EntityList, error) {
+	fn := *ConfPGPKeyring
+	if fn == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("pgp.keyring: %w", err)
+	}
+	var keyring openpgp.EntityList
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("-----BEGIN ")) {
+		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+	} else {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(b))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pgp.keyring %q: %w", fn, err)
+	}
+	if pass := []byte(*ConfPGPPassphrase); len(pass) != 0 {
+		for _, e := range keyring {
+			if e.PrivateKey != nil && e.PrivateKey.Encrypted {
+				if err := e.PrivateKey.Decrypt(pass); err != nil {
+					return nil, fmt.Errorf("pgp.passphrase: %w", err)
+				}
+			}
+			for _, sub := range e.Subkeys {
+				if sub.PrivateKey != nil && sub.PrivateKey.Encrypted {
+					if err := sub.PrivateKey.Decrypt(pass); err != nil {
+						return nil, fmt.Errorf("pgp.passphrase: %w", err)
+					}
+				}
+			}
+		}
+	}
+	return keyring, nil
+}
+
+// origContentType returns the content type from the part's header,
+// as FixContentType may change part.ContentType.
+func origContentType(part i18nmail.MailPart) string {
+	ct, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	return ct
+}
+
+// PGPFilter decrypts PGP/MIME (multipart/encrypted) parts with the keys of pgp.keyring,
+// verifies the signatures (multipart/signed and the signed+encrypted messages),
+// and records the result in the parts' header, for PrependHeaderFilter and the manifest.
+func PGPFilter(ctx context.Context,
+	inch <-chan i18nmail.MailPart, outch chan<- i18nmail.MailPart,
+	files chan<- ArchFileItem, errch chan<- error,
+) {
+	logger := getLogger(ctx)
+	defer close(outch)
+
+	var (
+		keyring    openpgp.EntityList
+		keyringErr error
+		loaded     bool
+	)
+	getKeyring := func() (openpgp.EntityList, error) {
+		if !loaded {
+			keyring, keyringErr = loadPGPKeyring()
+			loaded = true
+		}
+		return keyring, keyringErr
+	}
+	detached := make(map[int]PGPStatus)
+
+	var process func(part i18nmail.MailPart, st PGPStatus)
+	process = func(part i18nmail.MailPart, st PGPStatus) {
+		if part.Header != nil {
+			part.Header.Del(pgpHeader) // do not trust the sender
+		}
+		if signed := multipartAncestor(part, "multipart/signed", "pgp-signature"); signed != nil {
+			dst, ok := detached[signed.Seq]
+			if !ok {
+				kr, err := getKeyring()
+				if err != nil {
+					errch <- err
+				}
+				dst = verifyPGPDetached(*signed, kr)
+				detached[signed.Seq] = dst
+				logger.Info("PGPFilter verify", "seq", signed.Seq, "status", dst.String())
+			}
+			st = st.merge(dst)
+		}
+		if p := part.Parent; p != nil && p.ContentType == "multipart/encrypted" &&
+			strings.Contains(p.MediaType["protocol"], "pgp-encrypted") {
+			if origContentType(part) == "application/pgp-encrypted" {
+				return // the "Version: 1" control part
+			}
+			inner, ist, err := decryptPGP(part, getKeyring)
+			if err != nil {
+				logger.Warn("PGPFilter", "seq", part.Seq, "error", err)
+				errch <- fmt.Errorf("PGP/MIME of %02d: %w", part.Seq, err)
+			} else {
+				logger.Info("PGPFilter decrypt", "seq", part.Seq, "status", ist.String())
+				st = st.merge(ist)
+				msg, err := mail.ReadMessage(io.MultiReader(bytes.NewReader(inner), strings.NewReader("\r\n\r\n")))
+				if err == nil {
+					err = i18nmail.WalkMessage(msg, func(child i18nmail.MailPart) error {
+						var head [4096]byte
+						n, _ := child.Body.ReadAt(head[:], 0)
+						child.ContentType = FixContentType(head[:n], child.ContentType, headerGetFileName(child.Header))
+						process(child, st)
+						return nil
+					}, false, &part)
+				}
+				if err == nil {
+					return
+				}
+				errch <- fmt.Errorf("walk decrypted PGP/MIME of %02d: %w", part.Seq, err)
+			}
+		}
+		if !st.isZero() {
+			if part.Header == nil {
+				part.Header = make(map[string][]string, 1)
+			}
+			b, _ := json.Marshal(st)
+			part.Header.Set(pgpHeader, string(b))
+		}
+		outch <- part
+	}
+
+	for part := range inch {
+		process(part, PGPStatus{})
+	}
+}
+
+// decryptPGP decrypts the encrypted part of the multipart/encrypted,
+// and checks the signature if the message is signed, too.
+func decryptPGP(part i18nmail.MailPart, getKeyring func() (openpgp.EntityList, error)) ([]byte, PGPStatus, error) {
+	st := PGPStatus{Encrypted: true}
+	keyring, err := getKeyring()
+	if err != nil {
+		return nil, st, err
+	}
+	if len(keyring.DecryptionKeys()) == 0 {
+		return nil, st, errors.New("encrypted, but no private key is in pgp.keyring")
+	}
+	var r io.Reader = part.GetBody()
+	if block, err := armor.Decode(r); err == nil {
+		r = block.Body
+	} else {
+		r = part.GetBody()
+	}
+	md, err := openpgp.ReadMessage(r, keyring, nil, nil)
+	if err != nil {
+		return nil, st, err
+	}
+	// the signature is checked only at EOF
+	b, err := io.ReadAll(io.LimitReader(md.UnverifiedBody, MaxSize+1))
+	if err != nil {
+		return nil, st, err
+	}
+	if len(b) > MaxSize {
+		return nil, st, fmt.Errorf("decrypted message is bigger than %d bytes", MaxSize)
+	}
+	if md.IsSigned {
+		st.Signed = true
+		st.KeyID = fmt.Sprintf("%016X", md.SignedByKeyId)
+		if md.SignedBy != nil {
+			st.Signer = entityName(md.SignedBy.Entity)
+		}
+		switch {
+		case md.SignedBy == nil:
+			st.Error = "unknown key"
+		case md.SignatureError != nil:
+			st.Error = md.SignatureError.Error()
+		default:
+			st.Valid = true
+		}
+	}
+	return b, st, nil
+}
+
+// verifyPGPDetached verifies the multipart/signed part's signature.
+func verifyPGPDetached(signed i18nmail.MailPart, keyring openpgp.EntityList) PGPStatus {
+	st := PGPStatus{Signed: true}
+	b, err := io.ReadAll(io.LimitReader(signed.GetBody(), MaxSize))
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	content, sig, err := splitSigned(b, signed.MediaType["boundary"])
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	if block, err := armor.Decode(bytes.NewReader(sig)); err == nil {
+		if sig, err = io.ReadAll(block.Body); err != nil {
+			st.Error = err.Error()
+			return st
+		}
+	}
+	if p, err := packet.Read(bytes.NewReader(sig)); err == nil {
+		if s, ok := p.(*packet.Signature); ok && s.IssuerKeyId != nil {
+			st.KeyID = fmt.Sprintf("%016X", *s.IssuerKeyId)
+			if keys := keyring.KeysById(*s.IssuerKeyId); len(keys) != 0 {
+				st.Signer = entityName(keys[0].Entity)
+			}
+		}
+	}
+	_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(content), bytes.NewReader(sig), nil)
+	if err != nil {
+		if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+			st.Error = "unknown key"
+		} else {
+			st.Error = err.Error()
+		}
+		return st
+	}
+	st.Valid = true
+	return st
+}
+
+// entityName returns the primary (or the first) identity of the key.
+func entityName(e *openpgp.Entity) string {
+	var name string
+	for nm, id := range e.Identities {
+		if id.SelfSignature != nil && id.SelfSignature.IsPrimaryId != nil && *id.SelfSignature.IsPrimaryId {
+			return nm
+		}
+		if name == "" || nm < name {
+			name = nm
+		}
+	}
+	return name
+}
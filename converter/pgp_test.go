@@ -0,0 +1,129 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+func TestPGPFilter(t *testing.T) {
+	config := &packet.Config{DefaultHash: crypto.SHA256}
+	alice, err := openpgp.NewEntity("Alice", "", "alice@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyring bytes.Buffer
+	w, err := armor.Encode(&keyring, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = alice.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(t.TempDir(), "keyring.asc")
+	if err = os.WriteFile(fn, keyring.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	oldKeyring := *ConfPGPKeyring
+	*ConfPGPKeyring = fn
+	defer func() { *ConfPGPKeyring = oldKeyring }()
+	keyID := fmt.Sprintf("%016X", alice.PrimaryKey.KeyId)
+
+	const inner = "Content-Type: text/plain; charset=utf-8\r\n\r\nsecret text\r\n"
+	signed := func(content, signedContent string) string {
+		var sig bytes.Buffer
+		if err := openpgp.ArmoredDetachSign(&sig, alice, strings.NewReader(signedContent), config); err != nil {
+			t.Fatal(err)
+		}
+		return "From: alice@example.com\r\nSubject: signed\r\nMIME-Version: 1.0\r\n" +
+			"Content-Type: multipart/signed; protocol=\"application/pgp-signature\"; micalg=pgp-sha256; boundary=\"BND\"\r\n\r\n" +
+			"--BND\r\n" + content + "\r\n--BND\r\n" +
+			"Content-Type: application/pgp-signature; name=signature.asc\r\n\r\n" +
+			sig.String() + "\r\n--BND--\r\n"
+	}
+	var enc bytes.Buffer
+	aw, err := armor.Encode(&enc, "PGP MESSAGE", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := openpgp.Encrypt(aw, []*openpgp.Entity{alice}, alice, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.WriteString(pw, inner); err != nil {
+		t.Fatal(err)
+	}
+	if err = pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := "From: alice@example.com\r\nSubject: encrypted\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\"; boundary=\"BND\"\r\n\r\n" +
+		"--BND\r\nContent-Type: application/pgp-encrypted\r\n\r\nVersion: 1\r\n" +
+		"--BND\r\nContent-Type: application/octet-stream; name=encrypted.asc\r\n\r\n" +
+		enc.String() + "\r\n--BND--\r\n"
+
+	for i, tc := range []struct {
+		Name, Mail string
+		Want       PGPStatus
+	}{
+		{"signed", signed(inner, inner), PGPStatus{Signed: true, Signer: "Alice <alice@example.com>", KeyID: keyID, Valid: true}},
+		{"tampered", signed(inner, strings.Replace(inner, "secret", "public", 1)), PGPStatus{Signed: true, Signer: "Alice <alice@example.com>", KeyID: keyID}},
+		{"encrypted", encrypted, PGPStatus{Encrypted: true, Signed: true, Signer: "Alice <alice@example.com>", KeyID: keyID, Valid: true}},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		rawch := make(chan i18nmail.MailPart)
+		outch := make(chan i18nmail.MailPart)
+		errch := make(chan error, 16)
+		go SlurpMail(ctx, rawch, errch, strings.NewReader(tc.Mail), messageRFC822)
+		go PGPFilter(ctx, rawch, outch, nil, errch)
+		var texts []i18nmail.MailPart
+		for part := range outch {
+			if part.ContentType == textPlain {
+				texts = append(texts, part)
+			}
+		}
+		cancel()
+		close(errch)
+		for err := range errch {
+			t.Errorf("%d. %s: %+v", i, tc.Name, err)
+		}
+		if len(texts) != 1 {
+			t.Errorf("%d. %s: got %d text parts, want 1", i, tc.Name, len(texts))
+			continue
+		}
+		if b, _ := io.ReadAll(texts[0].GetBody()); !strings.Contains(string(b), "secret text") {
+			t.Errorf("%d. %s: got body %q", i, tc.Name, b)
+		}
+		got := getPGPStatus(texts[0].Header)
+		if got == nil {
+			t.Errorf("%d. %s: no status", i, tc.Name)
+			continue
+		}
+		got.Error = ""
+		if *got != tc.Want {
+			t.Errorf("%d. %s: got %+v, want %+v", i, tc.Name, *got, tc.Want)
+		}
+	}
+}
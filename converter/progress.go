@@ -0,0 +1,101 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"context"
+
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+// Part processing states reported to the ProgressFunc.
+const (
+	PartConverting = "converting"
+	PartDone       = "done"
+	PartFailed     = "failed"
+	PartSkipped    = "skipped"
+)
+
+// PartInfo describes the processing state of one MIME part.
+type PartInfo struct {
+	Filename    string `json:",omitempty"`
+	ContentType string
+	State       string
+	Converter   string   `json:",omitempty"`
+	Backend     string   `json:",omitempty"`
+	Error       string   `json:",omitempty"`
+	Archives    []string `json:",omitempty"`
+	Seq, Level  int
+	Pages       int  `json:",omitempty"`
+	CacheHit    bool `json:",omitempty"`
+	// SMIME is the result of the S/MIME decryption and signature verification.
+	SMIME *SMIMEStatus `json:",omitempty"`
+	// PGP is the result of the PGP/MIME decryption and signature verification.
+	PGP *PGPStatus `json:",omitempty"`
+	// Auth is the result of the DKIM verification, and the recorded authentication results.
+	Auth *AuthStatus `json:",omitempty"`
+
+	output string // the converted (not yet splitted) file
+}
+
+// ProgressFunc is called each time a part changes its state.
+// It must be safe for concurrent use.
+type ProgressFunc func(PartInfo)
+
+type ctxKeyProgress struct{}
+
+// WithProgress returns a context which reports part progress to f.
+func WithProgress(ctx context.Context, f ProgressFunc) context.Context {
+	return context.WithValue(ctx, ctxKeyProgress{}, f)
+}
+
+type ctxKeyPartInfo struct{}
+
+// startPart returns a context carrying the PartInfo of mp,
+// for the converters to record their details.
+func startPart(ctx context.Context, mp i18nmail.MailPart) (context.Context, *PartInfo) {
+	info := &PartInfo{
+		Seq: mp.Seq, Level: mp.Level,
+		Filename:    headerGetFileName(mp.Header),
+		ContentType: mp.ContentType,
+		SMIME:       getSMIMEStatus(mp.Header),
+		PGP:         getPGPStatus(mp.Header),
+		Auth:        getAuthStatus(mp.Header),
+	}
+	ctx = context.WithValue(ctx, ctxKeyPartInfo{}, info)
+	reportProgress(ctx, info, PartConverting, nil)
+	return ctx, info
+}
+
+// finishPart records the final state of the part.
+func finishPart(ctx context.Context, info *PartInfo, state string, err error) {
+	reportProgress(ctx, info, state, err)
+	if m := getManifest(ctx); m != nil {
+		m.add(info)
+	}
+}
+
+func reportProgress(ctx context.Context, info *PartInfo, state string, err error) {
+	info.State = state
+	if err != nil {
+		info.Error = err.Error()
+	}
+	if f, _ := ctx.Value(ctxKeyProgress{}).(ProgressFunc); f != nil {
+		f(*info)
+	}
+}
+
+// setBackend records the name of the program which did the conversion.
+func setBackend(ctx context.Context, backend string) {
+	if info, _ := ctx.Value(ctxKeyPartInfo{}).(*PartInfo); info != nil {
+		info.Backend = backend
+	}
+}
+
+func setCacheHit(ctx context.Context) {
+	if info, _ := ctx.Value(ctxKeyPartInfo{}).(*PartInfo); info != nil {
+		info.CacheHit = true
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tgulacsi/go/i18nmail"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// shorter quotes (after normalization) are kept, even if they repeat the previous message
+const minCollapsedQuote = 80
+
+// the note replacing the collapsed quote
+const collapsedQuoteNote = "[… %d quoted lines of the previous message …]"
+
+type ctxKeyQuotedText struct{}
+
+// withQuotedText returns a context in which QuoteFilter collapses the quotes of prev
+// (the quoteKey of the previous message's text).
+func withQuotedText(ctx context.Context, prev string) context.Context {
+	return context.WithValue(ctx, ctxKeyQuotedText{}, prev)
+}
+
+func quotedText(ctx context.Context) string {
+	s, _ := ctx.Value(ctxKeyQuotedText{}).(string)
+	return s
+}
+
+// QuoteFilter collapses the quoted text (the "> " lines of the text/plain and the
+// blockquotes of the text/html parts) which repeats the previous message of the conversation.
+func QuoteFilter(ctx context.Context,
+	inch <-chan i18nmail.MailPart, outch chan<- i18nmail.MailPart,
+	files chan<- ArchFileItem, errch chan<- error,
+) {
+	logger := getLogger(ctx)
+	defer func() {
+		close(outch)
+	}()
+	prev := quotedText(ctx)
+	for part := range inch {
+		if prev == "" || part.Body == nil ||
+			!(part.ContentType == textPlain || part.ContentType == textHtml && isUTF8Charset(part.MediaType["charset"])) {
+			outch <- part
+			continue
+		}
+		b, err := io.ReadAll(part.GetBody())
+		if err != nil {
+			logger.Warn("read text", "seq", part.Seq, "error", err)
+			outch <- part
+			continue
+		}
+		var n int
+		if part.ContentType == textPlain {
+			b, n = collapseTextQuotes(b, prev)
+		} else {
+			b, n = collapseHTMLQuotes(b, prev)
+		}
+		if n != 0 {
+			logger.Info("collapsed quotes", "seq", part.Seq, "count", n)
+			part.Body = io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b)))
+		}
+		outch <- part
+	}
+}
+
+func isUTF8Charset(charset string) bool {
+	return charset == "" || strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "us-ascii")
+}
+
+// quoteKey returns the text without the quote marks, with the whitespace compressed:
+// the quote is a repetition of the previous message if its quoteKey is contained in the previous' one.
+func quoteKey(s string) string {
+	var buf strings.Builder
+	for line := range strings.Lines(s) {
+		buf.WriteString(unquoteLine(line))
+		buf.WriteByte(' ')
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+func isQuoteLine(line string) bool { return strings.HasPrefix(strings.TrimLeft(line, " \t"), ">") }
+
+func unquoteLine(line string) string {
+	for {
+		s := strings.TrimLeft(line, " \t")
+		if !strings.HasPrefix(s, ">") {
+			return line
+		}
+		line = s[1:]
+	}
+}
+
+// collapseTextQuotes replaces the blocks of quoted lines repeating prev, and returns the number of the replaced blocks.
+func collapseTextQuotes(b []byte, prev string) ([]byte, int) {
+	var buf bytes.Buffer
+	var block []string
+	var n int
+	flush := func() {
+		if len(block) == 0 {
+			return
+		}
+		if s := quoteKey(strings.Join(block, "")); len(s) >= minCollapsedQuote && strings.Contains(prev, s) {
+			fmt.Fprintf(&buf, collapsedQuoteNote+"\n", len(block))
+			n++
+		} else {
+			for _, line := range block {
+				buf.WriteString(line)
+			}
+		}
+		block = block[:0]
+	}
+	for line := range strings.Lines(string(b)) {
+		if isQuoteLine(line) {
+			block = append(block, line)
+			continue
+		}
+		flush()
+		buf.WriteString(line)
+	}
+	flush()
+	return buf.Bytes(), n
+}
+
+// collapseHTMLQuotes replaces the outermost blockquotes repeating prev, and returns the number of the replaced ones.
+func collapseHTMLQuotes(b []byte, prev string) ([]byte, int) {
+	doc, err := html.Parse(bytes.NewReader(b))
+	if err != nil {
+		return b, 0
+	}
+	var n int
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		for c := node.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type != html.ElementNode || c.DataAtom != atom.Blockquote {
+				walk(c)
+				c = next
+				continue
+			}
+			var text strings.Builder
+			nodeText(&text, c)
+			s := text.String()
+			if key := quoteKey(s); len(key) < minCollapsedQuote || !strings.Contains(prev, key) {
+				walk(c)
+				c = next
+				continue
+			}
+			p := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P,
+				Attr: []html.Attribute{{Key: "class", Val: "agostle-collapsed"}}}
+			p.AppendChild(&html.Node{Type: html.TextNode,
+				Data: fmt.Sprintf(collapsedQuoteNote, strings.Count(strings.TrimSpace(s), "\n")+1)})
+			node.InsertBefore(p, c)
+			node.RemoveChild(c)
+			n++
+			c = next
+		}
+	}
+	walk(doc)
+	if n == 0 {
+		return b, 0
+	}
+	var buf bytes.Buffer
+	if err = html.Render(&buf, doc); err != nil {
+		return b, 0
+	}
+	return buf.Bytes(), n
+}
+
+// nodeText writes the text of the node (without scripts and styles), a line per block.
+func nodeText(w *strings.Builder, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		w.WriteString(node.Data)
+		return
+	case html.ElementNode:
+		switch node.DataAtom {
+		case atom.Script, atom.Style, atom.Head:
+			return
+		case atom.Br, atom.P, atom.Div, atom.Li, atom.Tr:
+			defer w.WriteByte('\n')
+		}
+	}
+	for c := node.FirstChild; c != nil; c = c.NextSibling {
+		nodeText(w, c)
+	}
+}
+
+// messageText returns the quoteKey of the text of the message (not descending into the attached mails):
+// its text/plain parts, or the text/html ones if it has no text/plain part.
+func messageText(ctx context.Context, b []byte) string {
+	var plain, htmlText strings.Builder
+	_ = i18nmail.Walk(
+		i18nmail.MailPart{Body: io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b))), ContentType: messageRFC822},
+		func(mp i18nmail.MailPart) error {
+			for p := mp.Parent; p != nil && p.Parent != nil; p = p.Parent {
+				if strings.HasPrefix(p.ContentType, "message/") {
+					return nil
+				}
+			}
+			if mp.ContentType != textPlain && mp.ContentType != textHtml || attachmentName(mp.Header) != "" {
+				return nil
+			}
+			r := NewTextReader(ctx, io.LimitReader(mp.GetBody(), MaxSize), mp.MediaType["charset"])
+			if mp.ContentType == textPlain {
+				_, _ = io.Copy(&plain, r)
+				plain.WriteByte('\n')
+			} else if doc, err := html.Parse(r); err == nil {
+				nodeText(&htmlText, doc)
+			}
+			return nil
+		},
+		false)
+	if plain.Len() != 0 {
+		return quoteKey(plain.String())
+	}
+	return quoteKey(htmlText.String())
+}
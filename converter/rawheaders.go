@@ -0,0 +1,134 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/textproto"
+	"strings"
+
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+// name of the raw headers appendix in the resulting archive (the last one)
+const RawHeadersFn = "raw-headers.pdf"
+
+// Raw headers appendix modes.
+const (
+	// RawHeadersTop appends the raw headers of the top-level message.
+	RawHeadersTop = "top"
+	// RawHeadersAll appends the raw headers of the nested messages, too.
+	RawHeadersAll = "all"
+)
+
+// at most this much of the raw headers is printed
+const maxRawHeaderSize = 1 << 20
+
+// rawHeaders are the raw headers of a message.
+type rawHeaders struct {
+	Subject string
+	Raw     string
+	Nested  bool
+}
+
+type ctxKeyRawHeaders struct{}
+
+// WithRawHeaders returns a context which appends the raw headers of the messages
+// (RawHeadersTop or RawHeadersAll, or none if empty), regardless of ConfRawHeaders.
+func WithRawHeaders(ctx context.Context, mode string) context.Context {
+	return context.WithValue(ctx, ctxKeyRawHeaders{}, mode)
+}
+
+func rawHeadersMode(ctx context.Context) string {
+	if mode, ok := ctx.Value(ctxKeyRawHeaders{}).(string); ok {
+		return mode
+	}
+	return *ConfRawHeaders
+}
+
+// readRawHeaders returns the header of the message as is: undecoded, in the original order.
+func readRawHeaders(r io.Reader) (string, error) {
+	br := bufio.NewReader(io.LimitReader(r, maxRawHeaderSize))
+	var buf strings.Builder
+	for {
+		line, err := br.ReadString('\n')
+		if strings.TrimRight(line, "\r\n") == "" {
+			return buf.String(), nil
+		}
+		buf.WriteString(strings.TrimRight(line, "\r\n"))
+		buf.WriteByte('\n')
+		if err != nil {
+			if err == io.EOF {
+				return buf.String(), nil
+			}
+			return buf.String(), err
+		}
+	}
+}
+
+// seeMessage records the raw headers of the message (nested in another or not) for the appendix,
+// if the mode of ctx asks for them.
+func seeMessage(ctx context.Context, msg i18nmail.MailPart, nested bool) {
+	m := getManifest(ctx)
+	mode := rawHeadersMode(ctx)
+	if m == nil || msg.Body == nil || mode != RawHeadersAll && (mode != RawHeadersTop || nested) {
+		return
+	}
+	raw, err := readRawHeaders(io.NewSectionReader(msg.Body, 0, msg.Body.Size()))
+	if err != nil {
+		getLogger(ctx).Warn("read raw headers", "seq", msg.Seq, "error", err)
+	}
+	if raw == "" {
+		return
+	}
+	rh := rawHeaders{Raw: raw, Nested: nested}
+	if hdr, err := textproto.NewReader(bufio.NewReader(strings.NewReader(raw + "\n"))).ReadMIMEHeader(); err == nil || len(hdr) != 0 {
+		rh.Subject = i18nmail.HeadDecode(hdr.Get("Subject"))
+	}
+	m.mu.Lock()
+	m.rawHeaders = append(m.rawHeaders, rh)
+	m.mu.Unlock()
+}
+
+var rawHeadersTemplate = template.Must(template.New("rawHeaders").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8">
+<style>
+body { font-family: sans-serif; font-size: 10pt; }
+h1 { font-size: 12pt; }
+h1.next { page-break-before: always; }
+pre { font-family: monospace; font-size: 8pt; white-space: pre-wrap; overflow-wrap: anywhere; }
+</style>
+</head>
+<body>
+{{range $i, $h := .}}<h1{{if $i}} class="next"{{end}}>{{if .Nested}}Raw headers of an attached message{{else}}Raw headers{{end}}{{with .Subject}}: {{.}}{{end}}</h1>
+<pre>{{.Raw}}</pre>
+{{end}}</body>
+</html>
+`))
+
+// writeRawHeaders writes the raw headers of the messages into destfn.
+func (m *Manifest) writeRawHeaders(ctx context.Context, destfn string) error {
+	m.mu.Lock()
+	headers := append([]rawHeaders(nil), m.rawHeaders...)
+	m.mu.Unlock()
+	if len(headers) == 0 {
+		return errors.New("no raw headers")
+	}
+	var buf bytes.Buffer
+	if err := rawHeadersTemplate.Execute(&buf, headers); err != nil {
+		return err
+	}
+	if err := HTMLToPdf(ctx, destfn, &buf, textHtml); err != nil {
+		return fmt.Errorf("raw headers: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+func TestRawHeaders(t *testing.T) {
+	const msg = "Received: from mx.example.net\r\n\tby mx.example.org; Mon, 1 Jan 2024 00:00:00 +0000\r\n" +
+		"Subject: =?UTF-8?Q?=C3=A1rv=C3=ADzt=C5=B1r=C5=91?=\r\nFrom: Joe <joe@example.com>\r\n\r\nHello\r\n"
+	raw, err := readRawHeaders(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Received: from mx.example.net\n\tby mx.example.org; Mon, 1 Jan 2024 00:00:00 +0000\n" +
+		"Subject: =?UTF-8?Q?=C3=A1rv=C3=ADzt=C5=B1r=C5=91?=\nFrom: Joe <joe@example.com>\n"
+	if raw != want {
+		t.Errorf("got %q, want %q", raw, want)
+	}
+
+	body, err := i18nmail.MakeSectionReader(strings.NewReader(msg), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := i18nmail.MailPart{Body: body}
+	for i, tc := range []struct {
+		Mode   string
+		Nested bool
+		Want   int
+	}{
+		{"", false, 0},
+		{RawHeadersTop, false, 1},
+		{RawHeadersTop, true, 0},
+		{RawHeadersAll, true, 1},
+	} {
+		ctx, m := withManifest(context.Background())
+		ctx = WithRawHeaders(ctx, tc.Mode)
+		seeMessage(ctx, mp, tc.Nested)
+		if len(m.rawHeaders) != tc.Want {
+			t.Errorf("%d. got %d, want %d", i, len(m.rawHeaders), tc.Want)
+			continue
+		}
+		if tc.Want != 0 && m.rawHeaders[0].Subject != "árvíztűrő" {
+			t.Errorf("%d. got %q, want %q", i, m.rawHeaders[0].Subject, "árvíztűrő")
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MPRelatedToPdf converts multipart/related (such as an MHTML web archive) to PDF:
+// renders the root HTML with the resources referred by cid: or Content-Location.
+//
+// Without a boundary in the contentType, r is read as a whole MIME document (.mht).
+func MPRelatedToPdf(ctx context.Context, destfn string, r io.Reader, contentType string) error {
+	dn, err := os.MkdirTemp(filepath.Dir(destfn), filepath.Base(destfn)+"-related-")
+	if err != nil {
+		return err
+	}
+	if !LeaveTempFiles {
+		defer func() { _ = os.RemoveAll(dn) }()
+	}
+	htmlFn, err := writeRelatedHTML(ctx, dn, r, contentType)
+	if err != nil {
+		return err
+	}
+	fh, err := os.Open(htmlFn)
+	if err != nil {
+		return fmt.Errorf("open html %s: %w", htmlFn, err)
+	}
+	defer fh.Close()
+	return HTMLToPdf(ctx, destfn, fh, textHtml)
+}
+
+// relatedPart is a decoded part of a multipart/related.
+type relatedPart struct {
+	Header      textproto.MIMEHeader
+	ContentType string
+	Params      map[string]string
+	Body        []byte
+}
+
+// writeRelatedHTML writes the root HTML of the multipart/related into dn,
+// and its resources into the images subdirectory, and returns the HTML's file name.
+func writeRelatedHTML(ctx context.Context, dn string, r io.Reader, contentType string) (string, error) {
+	ct, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		msg, err := mail.ReadMessage(r)
+		if err != nil {
+			return "", fmt.Errorf("read MIME document: %w", err)
+		}
+		if ct, params, err = mime.ParseMediaType(msg.Header.Get("Content-Type")); err != nil {
+			return "", fmt.Errorf("parse Content-Type %s: %w", msg.Header.Get("Content-Type"), err)
+		}
+		if !strings.HasPrefix(ct, "multipart/") {
+			part, err := newRelatedPart(textproto.MIMEHeader(msg.Header), msg.Body)
+			if err != nil {
+				return "", err
+			}
+			if part.ContentType != textHtml {
+				return "", fmt.Errorf("%s is not HTML", part.ContentType)
+			}
+			return writeRelatedRoot(ctx, dn, part, nil)
+		}
+		r = msg.Body
+	}
+	if params["boundary"] == "" {
+		return "", fmt.Errorf("no boundary in %s", ct)
+	}
+	parts, err := readRelatedParts(r, params["boundary"])
+	if err != nil {
+		return "", err
+	}
+
+	// the root is the "start" part, or the first HTML part
+	start := strings.Trim(params["start"], "<>")
+	rootIdx := -1
+	for i, p := range parts {
+		if start != "" && strings.Trim(p.Header.Get("Content-ID"), "<>") == start ||
+			start == "" && p.ContentType == textHtml {
+			rootIdx = i
+			break
+		}
+	}
+	if rootIdx < 0 {
+		return "", errors.New("no HTML root part")
+	}
+	root := parts[rootIdx]
+	return writeRelatedRoot(ctx, dn, root, append(parts[:rootIdx:rootIdx], parts[rootIdx+1:]...))
+}
+
+// writeRelatedRoot writes the root HTML part, with the resources referred by it.
+func writeRelatedRoot(ctx context.Context, dn string, root relatedPart, resources []relatedPart) (string, error) {
+	logger := getLogger(ctx)
+	const subDir = "images"
+	body, err := io.ReadAll(decodeHTML(ctx, bytes.NewReader(root.Body), false))
+	if err != nil {
+		return "", err
+	}
+	// the same as HTMLPartFilter does with the mail bodies
+	cids := make(map[string]string, len(resources))
+	if body, err = io.ReadAll(NewCidMapper(cids, subDir, bytes.NewReader(body))); err != nil {
+		return "", err
+	}
+	// MHTML refers to the resources by their Content-Location
+	for i, p := range resources {
+		loc := p.Header.Get("Content-Location")
+		if loc == "" || strings.HasPrefix(loc, "cid:") {
+			continue
+		}
+		nfn := fmt.Sprintf("%s/%03d%s", subDir, i, locationExt(loc))
+		var found bool
+		for _, q := range [][2]string{{`"`, `"`}, {`'`, `'`}, {`(`, `)`}} {
+			old := []byte(q[0] + loc + q[1])
+			if bytes.Contains(body, old) {
+				found = true
+				body = bytes.ReplaceAll(body, old, []byte(q[0]+nfn+q[1]))
+			}
+		}
+		if found {
+			cids["location:"+loc] = nfn
+		}
+	}
+	// nosemgrep: go.lang.correctness.permissions.file_permission.incorrect-default-permission
+	_ = os.Mkdir(filepath.Join(dn, subDir), 0755) // ignore error
+	for _, p := range resources {
+		fn := cids[strings.Trim(p.Header.Get("Content-ID"), "<>")]
+		if fn == "" {
+			if fn = cids["location:"+p.Header.Get("Content-Location")]; fn == "" {
+				logger.Debug("unreferenced resource", "content-id", p.Header.Get("Content-ID"), "location", p.Header.Get("Content-Location"))
+				continue
+			}
+		}
+		if err = os.WriteFile(filepath.Join(dn, fn), p.Body, 0640); err != nil {
+			return "", err
+		}
+	}
+	htmlFn := filepath.Join(dn, "index.html")
+	return htmlFn, os.WriteFile(htmlFn, body, 0640)
+}
+
+// readRelatedParts reads the (decoded) parts of the multipart body,
+// flattening the multipart/alternative ones to their HTML part.
+func readRelatedParts(r io.Reader, boundary string) ([]relatedPart, error) {
+	var parts []relatedPart
+	mr := multipart.NewReader(r, boundary)
+	for {
+		mp, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return parts, nil
+			}
+			return parts, err
+		}
+		part, err := newRelatedPart(mp.Header, mp)
+		if err != nil {
+			return parts, err
+		}
+		if !strings.HasPrefix(part.ContentType, "multipart/") {
+			parts = append(parts, part)
+			continue
+		}
+		sub, err := readRelatedParts(bytes.NewReader(part.Body), part.Params["boundary"])
+		if err != nil {
+			return parts, err
+		}
+		for _, p := range sub {
+			if part.ContentType != "multipart/alternative" || p.ContentType == textHtml {
+				if p.Header.Get("Content-ID") == "" {
+					p.Header.Set("Content-ID", part.Header.Get("Content-ID"))
+				}
+				parts = append(parts, p)
+			}
+		}
+	}
+}
+
+// newRelatedPart reads the part, decoding its Content-Transfer-Encoding
+// (quoted-printable is decoded by mime/multipart already).
+func newRelatedPart(hdr textproto.MIMEHeader, r io.Reader) (relatedPart, error) {
+	part := relatedPart{Header: hdr}
+	part.ContentType, part.Params, _ = mime.ParseMediaType(hdr.Get("Content-Type"))
+	if part.ContentType == "" {
+		part.ContentType = textPlain
+	}
+	switch strings.ToLower(hdr.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		r = NewQuoPriDecoder(r)
+	}
+	var err error
+	if part.Body, err = io.ReadAll(io.LimitReader(r, MaxSize)); err != nil {
+		return part, fmt.Errorf("read part %s: %w", part.ContentType, err)
+	}
+	return part, nil
+}
+
+// locationExt returns the extension of the file the Content-Location URL refers to.
+func locationExt(loc string) string {
+	if u, err := url.Parse(loc); err == nil {
+		loc = u.Path
+	}
+	ext := path.Ext(loc)
+	if len(ext) > 8 || strings.ContainsFunc(ext, func(r rune) bool {
+		return !(r == '.' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		return ""
+	}
+	return ext
+}
@@ -0,0 +1,105 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmlxMessage(t *testing.T) {
+	const msg = "From: a@example.com\nSubject: emlx\n\nbody\n"
+	emlx := "40        \n" + msg + `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict><key>flags</key><integer>8590195713</integer></dict></plist>
+`
+	if len(msg) != 40 {
+		t.Fatalf("message length is %d", len(msg))
+	}
+	sr, err := EmlxMessage(io.NewSectionReader(strings.NewReader(emlx), 0, int64(len(emlx))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != msg {
+		t.Errorf("got %q, want %q", b, msg)
+	}
+
+	for i, tc := range []struct {
+		Body, ContentType, FileName string
+		Want                        string
+	}{
+		{emlx, "", "", MessageEmlx},
+		{emlx, "application/octet-stream", "1234.emlx", MessageEmlx},
+		{"12\nnot: emlx", "text/csv", "a.csv", "text/csv"},
+		{"MIME-Version: 1.0\n", "application/octet-stream", "page.mht", multipartRelated},
+	} {
+		if got := FixContentType([]byte(tc.Body), tc.ContentType, tc.FileName); got != tc.Want {
+			t.Errorf("%d. got %q, want %q", i, got, tc.Want)
+		}
+	}
+}
+
+func TestWriteRelatedHTML(t *testing.T) {
+	const mht = "From: <Saved by Blink>\r\n" +
+		"Snapshot-Content-Location: https://example.com/page.html\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/related;\r\n\ttype=\"text/html\";\r\n\tboundary=\"----MultipartBoundary--x\"\r\n" +
+		"\r\n" +
+		"------MultipartBoundary--x\r\n" +
+		"Content-Type: text/html\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"Content-Location: https://example.com/page.html\r\n" +
+		"\r\n" +
+		"<html><body><img src=3D\"https://example.com/img/logo.png?v=3D1\">" +
+		"<img src=3D\"cid:inline@x\"></body></html>\r\n" +
+		"------MultipartBoundary--x\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"Content-Location: https://example.com/img/logo.png?v=1\r\n" +
+		"\r\n" +
+		"bG9nbw==\r\n" +
+		"------MultipartBoundary--x\r\n" +
+		"Content-Type: image/gif\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"Content-ID: <inline@x>\r\n" +
+		"\r\n" +
+		"aW5saW5l\r\n" +
+		"------MultipartBoundary--x\r\n" +
+		"Content-Type: text/css\r\n" +
+		"Content-Location: https://example.com/unused.css\r\n" +
+		"\r\n" +
+		"body {}\r\n" +
+		"------MultipartBoundary--x--\r\n"
+
+	dn := t.TempDir()
+	htmlFn, err := writeRelatedHTML(context.Background(), dn, strings.NewReader(mht), multipartRelated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(htmlFn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<img src="images/000.png"><img src="images/inline@x">`; !strings.Contains(string(b), want) {
+		t.Errorf("got %q, want %q in it", b, want)
+	}
+	for fn, want := range map[string]string{"000.png": "logo", "inline@x": "inline"} {
+		if b, err := os.ReadFile(filepath.Join(dn, "images", fn)); err != nil {
+			t.Error(err)
+		} else if string(b) != want {
+			t.Errorf("%s: got %q, want %q", fn, b, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dn, "images", "002.css")); err == nil {
+		t.Error("unreferenced resource is written")
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/UNO-SOFT/filecache"
+)
+
+// errPrivateAddress is returned for the remote images on private (or loopback, link-local...) addresses.
+var errPrivateAddress = errors.New("private address")
+
+// errTooManyImages is returned for the remote images of a document above the maximal number.
+var errTooManyImages = errors.New("too many remote images")
+
+// the non-public ranges not covered by the netip.Addr methods
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// publicAddr reports whether the address is a public unicast address.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// imageFetcher downloads the remote images of the HTML mails.
+type imageFetcher struct {
+	client      *http.Client
+	allow, deny []string
+	maxSize     int64
+	proxy       *url.URL
+	// maxCount is the maximal number of images, totalTimeout the time limit of downloading them, per document
+	maxCount     int
+	totalTimeout time.Duration
+	// allowPrivate allows the private addresses (for tests)
+	allowPrivate bool
+}
+
+var (
+	remoteImagesOnce    sync.Once
+	remoteImagesFetcher *imageFetcher
+)
+
+// getImageFetcher returns the fetcher configured by ConfRemoteImages*, or nil if it is disabled.
+func getImageFetcher(ctx context.Context) *imageFetcher {
+	remoteImagesOnce.Do(func() {
+		if !*ConfRemoteImages {
+			return
+		}
+		var err error
+		if remoteImagesFetcher, err = newImageFetcher(
+			*ConfRemoteImagesAllow, *ConfRemoteImagesDeny, *ConfRemoteImagesProxy,
+			*ConfRemoteImagesMaxSize, *ConfRemoteImagesTimeout, false,
+		); err != nil {
+			getLogger(ctx).Error("remote images fetcher", "error", err)
+			return
+		}
+		remoteImagesFetcher.maxCount = *ConfRemoteImagesMaxCount
+		remoteImagesFetcher.totalTimeout = *ConfRemoteImagesTotalTimeout
+	})
+	return remoteImagesFetcher
+}
+
+// newImageFetcher returns a fetcher which downloads from the allowed (all if empty), not denied hosts,
+// through the proxy (if not empty), at most maxSize bytes per image within the timeout.
+func newImageFetcher(allow, deny, proxy string, maxSize int64, timeout time.Duration, allowPrivate bool) (*imageFetcher, error) {
+	f := imageFetcher{
+		allow: splitHosts(allow), deny: splitHosts(deny),
+		maxSize: maxSize, allowPrivate: allowPrivate,
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	// checks the resolved address of the direct connections, so DNS rebinding does not help
+	checked := net.Dialer{Timeout: timeout, Control: func(network, address string, _ syscall.RawConn) error {
+		if f.allowPrivate {
+			return nil
+		}
+		if ap, err := netip.ParseAddrPort(address); err != nil || !publicAddr(ap.Addr()) {
+			return fmt.Errorf("%s: %w", address, errPrivateAddress)
+		}
+		return nil
+	}}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DialContext = checked.DialContext
+	if proxy != "" {
+		var err error
+		if f.proxy, err = url.Parse(proxy); err != nil {
+			return nil, fmt.Errorf("parse proxy %q: %w", proxy, err)
+		}
+		proxyAddr := f.proxy.Host
+		if f.proxy.Port() == "" {
+			if f.proxy.Scheme == "https" {
+				proxyAddr = net.JoinHostPort(f.proxy.Hostname(), "443")
+			} else {
+				proxyAddr = net.JoinHostPort(f.proxy.Hostname(), "80")
+			}
+		}
+		tr.Proxy = http.ProxyURL(f.proxy)
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if addr == proxyAddr {
+				return dialer.DialContext(ctx, network, addr)
+			}
+			return checked.DialContext(ctx, network, addr)
+		}
+	}
+	f.client = &http.Client{
+		Transport: tr,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return f.check(req.Context(), req.URL)
+		},
+	}
+	return &f, nil
+}
+
+func splitHosts(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// matchHost reports whether the host matches any of the patterns:
+// "example.com" matches only itself, "*.example.com" matches the subdomains, too.
+func matchHost(patterns []string, host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, p := range patterns {
+		if s, ok := strings.CutPrefix(p, "*."); ok {
+			if host == s || strings.HasSuffix(host, "."+s) {
+				return true
+			}
+		} else if host == p {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error if the URL is not to be downloaded.
+func (f *imageFetcher) check(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s: scheme %q is not allowed", u, u.Scheme)
+	}
+	host := u.Hostname()
+	if matchHost(f.deny, host) || len(f.allow) != 0 && !matchHost(f.allow, host) {
+		return fmt.Errorf("%s: host %q is not allowed", u, host)
+	}
+	if f.proxy == nil || f.allowPrivate {
+		return nil
+	}
+	// The proxy resolves the name, so check it here - but the proxy resolves it again,
+	// and a rebinding name may resolve to a private address that time:
+	// the proxy must enforce the egress rules itself, this is only a best effort.
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("lookup %q: %w", host, err)
+	}
+	for _, a := range addrs {
+		if !publicAddr(a) {
+			return fmt.Errorf("%s: %s: %w", u, a, errPrivateAddress)
+		}
+	}
+	return nil
+}
+
+// session returns fetch, which downloads the images of one document (as Fetch) into dir,
+// at most maxCount of them, within totalTimeout; and stop, which releases its resources.
+func (f *imageFetcher) session(ctx context.Context, dir string) (fetch func(rawURL string) (string, error), stop func()) {
+	stop = func() {}
+	if f.totalTimeout > 0 {
+		ctx, stop = context.WithTimeout(ctx, f.totalTimeout)
+	}
+	var n int
+	return func(rawURL string) (string, error) {
+		if f.maxCount > 0 && n >= f.maxCount {
+			return "", fmt.Errorf("%s: %w (max %d)", rawURL, errTooManyImages, f.maxCount)
+		}
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("%s: %w", rawURL, err)
+		}
+		n++
+		return f.Fetch(ctx, dir, rawURL)
+	}, stop
+}
+
+// Fetch downloads the image into dir, and returns the file name, relative to dir's parent
+// (as the ones NewCidMapper rewrites the cid: URLs to).
+func (f *imageFetcher) Fetch(ctx context.Context, dir, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if err = f.check(ctx, u); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(u.String()))
+	key := filecache.NewActionID([]byte("remote-image:" + u.String()))
+	var b []byte
+	var contentType string
+	if Cache != nil {
+		if b, _, err = Cache.GetBytes(key); err == nil {
+			getLogger(ctx).Debug("remote image from cache", "url", u)
+		}
+	}
+	if len(b) == 0 {
+		if b, contentType, err = f.download(ctx, u); err != nil {
+			return "", err
+		}
+		if Cache != nil {
+			if _, _, err := Cache.Put(key, bytes.NewReader(b)); err != nil {
+				getLogger(ctx).Warn("cache remote image", "url", u, "error", err)
+			}
+		}
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(b)
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = mime.TypeByExtension(path.Ext(u.Path))
+	}
+	ext := imageExt(contentType)
+	if ext == "" {
+		return "", fmt.Errorf("%s: %q is not an image", u, contentType)
+	}
+	fn := "remote-" + hex.EncodeToString(sum[:8]) + ext
+	// nosemgrep: go.lang.correctness.permissions.file_permission.incorrect-default-permission
+	_ = os.MkdirAll(dir, 0755)
+	if err = os.WriteFile(filepath.Join(dir, fn), b, 0644); err != nil {
+		return "", err
+	}
+	return filepath.Base(dir) + "/" + fn, nil
+}
+
+// download returns the image and its content type.
+func (f *imageFetcher) download(ctx context.Context, u *url.URL) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "image/*")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if contentType != "" && !strings.HasPrefix(contentType, "image/") &&
+		contentType != "application/octet-stream" {
+		return nil, "", fmt.Errorf("%s: %q is not an image", u, contentType)
+	}
+	maxSize := f.maxSize
+	if maxSize <= 0 {
+		maxSize = MaxSize
+	}
+	if resp.ContentLength > maxSize {
+		return nil, "", fmt.Errorf("%s: image is bigger than %d bytes", u, maxSize)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", u, err)
+	}
+	if int64(len(b)) > maxSize {
+		return nil, "", fmt.Errorf("%s: image is bigger than %d bytes", u, maxSize)
+	}
+	return b, contentType, nil
+}
+
+// imageExt returns the extension of the raster image types, "" for the others
+// (SVG may carry scripts and further remote references).
+func imageExt(contentType string) string {
+	switch contentType {
+	case "image/jpeg", "image/jpg", "image/pjpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/bmp":
+		return ".bmp"
+	}
+	return ""
+}
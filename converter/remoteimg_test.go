@@ -0,0 +1,156 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchHost(t *testing.T) {
+	patterns := splitHosts("example.com, *.Example.org")
+	for i, tc := range []struct {
+		Host string
+		Want bool
+	}{
+		{"example.com", true},
+		{"www.example.com", false},
+		{"example.org", true},
+		{"img.EXAMPLE.org.", true},
+		{"badexample.org", false},
+	} {
+		if got := matchHost(patterns, tc.Host); got != tc.Want {
+			t.Errorf("%d. %s: got %t, want %t", i, tc.Host, got, tc.Want)
+		}
+	}
+}
+
+func TestImageFetcher(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect.png":
+			http.Redirect(w, r, "http://localhost.invalid/a.png", http.StatusFound)
+			return
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+		case "/h.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			_, _ = w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+			return
+		default:
+			w.Header().Set("Content-Type", "image/png")
+		}
+		_, _ = w.Write(img.Bytes())
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "images")
+	for i, tc := range []struct {
+		Allow, Deny  string
+		MaxSize      int64
+		AllowPrivate bool
+		Path         string
+		WantErr      bool
+	}{
+		{AllowPrivate: true, Path: "/a.png"},
+		{AllowPrivate: true, Path: "/b.png", Allow: "127.0.0.1"},
+		{AllowPrivate: true, Path: "/c.png", Allow: "*.example.com", WantErr: true},
+		{AllowPrivate: true, Path: "/d.png", Deny: "127.0.0.1", WantErr: true},
+		{AllowPrivate: true, Path: "/e.png", MaxSize: 10, WantErr: true},
+		{AllowPrivate: true, Path: "/page.html", WantErr: true},
+		{AllowPrivate: true, Path: "/h.svg", WantErr: true},
+		{AllowPrivate: true, Path: "/redirect.png", Deny: "*.invalid", WantErr: true},
+		{Path: "/f.png", WantErr: true},
+	} {
+		f, err := newImageFetcher(tc.Allow, tc.Deny, "", tc.MaxSize, 5*time.Second, tc.AllowPrivate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn, err := f.Fetch(ctx, dir, srv.URL+tc.Path)
+		if tc.WantErr {
+			if err == nil {
+				t.Errorf("%d. %s: wanted error, got %q", i, tc.Path, fn)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d. %s: %+v", i, tc.Path, err)
+			continue
+		}
+		if !strings.HasPrefix(fn, "images/remote-") || !strings.HasSuffix(fn, ".png") {
+			t.Errorf("%d. got %q, want images/remote-*.png", i, fn)
+		}
+		if b, err := os.ReadFile(filepath.Join(filepath.Dir(dir), fn)); err != nil || !bytes.Equal(b, img.Bytes()) {
+			t.Errorf("%d. read %q: %+v", i, fn, err)
+		}
+	}
+
+	f, err := newImageFetcher("", "", "", 0, time.Second, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Fetch(ctx, dir, srv.URL+"/g.png"); !errors.Is(err, errPrivateAddress) {
+		t.Errorf("got %v, want %v", err, errPrivateAddress)
+	}
+}
+
+func TestImageFetcherSession(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow.png" {
+			time.Sleep(time.Second)
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(img.Bytes())
+	}))
+	defer srv.Close()
+
+	f, err := newImageFetcher("", "", "", 0, 5*time.Second, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.maxCount, f.totalTimeout = 2, 100*time.Millisecond
+	dir := filepath.Join(t.TempDir(), "images")
+	fetch, stop := f.session(context.Background(), dir)
+	defer stop()
+	for i, tc := range []struct {
+		Path    string
+		WantErr error
+	}{
+		{Path: "/a.png"},
+		{Path: "/slow.png", WantErr: context.DeadlineExceeded},
+		{Path: "/b.png", WantErr: errTooManyImages},
+	} {
+		_, err := fetch(srv.URL + tc.Path)
+		if tc.WantErr == nil && err != nil || tc.WantErr != nil && !errors.Is(err, tc.WantErr) {
+			t.Errorf("%d. %s: got %v, want %v", i, tc.Path, err, tc.WantErr)
+		}
+	}
+
+	// a new document starts a new session
+	fetch, stop = f.session(context.Background(), dir)
+	defer stop()
+	if _, err = fetch(srv.URL + "/c.png"); err != nil {
+		t.Errorf("new session: %+v", err)
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hhrutter/pkcs7"
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+// smimeHeader carries the JSON encoded SMIMEStatus of the part.
+const smimeHeader = "X-Agostle-Smime"
+
+// SMIMEStatus is the result of the S/MIME processing of a part.
+type SMIMEStatus struct {
+	Encrypted bool   `json:",omitempty"`
+	Signed    bool   `json:",omitempty"`
+	Signer    string `json:",omitempty"`
+	Valid     bool   `json:",omitempty"`
+	Trusted   bool   `json:",omitempty"`
+	// Error is the signature verification error.
+	Error string `json:",omitempty"`
+	// Chain is the trust chain verification error.
+	Chain string `json:",omitempty"`
+}
+
+func (st SMIMEStatus) String() string {
+	var parts []string
+	if st.Encrypted {
+		parts = append(parts, "encrypted")
+	}
+	if st.Signed {
+		s := "signed"
+		if st.Signer != "" {
+			s += " by " + st.Signer
+		}
+		switch {
+		case !st.Valid:
+			s += ", INVALID signature: " + st.Error
+		case st.Trusted:
+			s += ", valid signature, trusted certificate"
+		default:
+			s += ", valid signature, untrusted certificate: " + st.Chain
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (st SMIMEStatus) isZero() bool { return !st.Encrypted && !st.Signed }
+
+// merge returns st with the signature of inner, if that is signed.
+func (st SMIMEStatus) merge(inner SMIMEStatus) SMIMEStatus {
+	st.Encrypted = st.Encrypted || inner.Encrypted
+	if inner.Signed {
+		st.Signed, st.Signer, st.Valid, st.Trusted = true, inner.Signer, inner.Valid, inner.Trusted
+		st.Error, st.Chain = inner.Error, inner.Chain
+	}
+	return st
+}
+
+// getSMIMEStatus returns the S/MIME status recorded in the header by SMIMEFilter.
+func getSMIMEStatus(hdr map[string][]string) *SMIMEStatus {
+	vv := hdr[smimeHeader]
+	if len(vv) == 0 {
+		return nil
+	}
+	var st SMIMEStatus
+	if err := json.Unmarshal([]byte(vv[0]), &st); err != nil {
+		return nil
+	}
+	return &st
+}
+
+type smimeKeys struct {
+	cert  *x509.Certificate
+	key   crypto.PrivateKey
+	roots *x509.CertPool
+}
+
+// loadSMIMEKeys reads the trusted roots, and the recipient certificate and key (if configured).
+func loadSMIMEKeys() (*smimeKeys, error) {
+	var k smimeKeys
+	if fn := *ConfSMIMECA; fn != "" {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, fmt.Errorf("smime.ca: %w", err)
+		}
+		k.roots = x509.NewCertPool()
+		if !k.roots.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("smime.ca: no certificate found in %q", fn)
+		}
+	}
+	if *ConfSMIMECert == "" {
+		return &k, nil
+	}
+	pair, err := tls.LoadX509KeyPair(*ConfSMIMECert, *ConfSMIMEKey)
+	if err != nil {
+		return nil, fmt.Errorf("smime.cert: %w", err)
+	}
+	if k.cert = pair.Leaf; k.cert == nil {
+		if k.cert, err = x509.ParseCertificate(pair.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("smime.cert: %w", err)
+		}
+	}
+	k.key = pair.PrivateKey
+	return &k, nil
+}
+
+// isSMIMEPart reports whether the part is an S/MIME (smime.p7m) encrypted or signed entity.
+func isSMIMEPart(part i18nmail.MailPart) bool {
+	// the content type may be sniffed as application/pkcs7-signature
+	if part.MediaType["smime-type"] != "" ||
+		strings.EqualFold(filepath.Ext(headerGetFileName(part.Header)), ".p7m") {
+		return true
+	}
+	return part.ContentType == "application/pkcs7-mime" || part.ContentType == "application/x-pkcs7-mime"
+}
+
+// walkMail is i18nmail.Walk, but leaves the top-level opaque signed message for SMIMEFilter to verify:
+// i18nmail.Walk unpacks it with openssl, without checking the signature.
+func walkMail(mp i18nmail.MailPart, todo i18nmail.TodoFunc, dontDescend bool) error {
+	msg, err := mail.ReadMessage(io.MultiReader(mp.GetBody(), strings.NewReader("\r\n\r\n")))
+	if err != nil || !strings.HasPrefix(msg.Header.Get("Content-Type"), "application/x-pkcs7-mime") {
+		return i18nmail.Walk(mp, todo, dontDescend)
+	}
+	// the same X-Hash as i18nmail.Walk sets
+	h := sha512.New512_224()
+	if _, err = io.Copy(h, mp.GetBody()); err != nil {
+		return fmt.Errorf("read part: %w", err)
+	}
+	msg.Header["X-Hash"] = []string{base64.URLEncoding.EncodeToString(h.Sum(nil))}
+	return i18nmail.WalkMessage(msg, todo, dontDescend, &mp)
+}
+
+// multipartAncestor returns the nearest ancestor with the given content type,
+// whose protocol parameter contains protocol.
+func multipartAncestor(part i18nmail.MailPart, contentType, protocol string) *i18nmail.MailPart {
+	parent := part.Parent
+	for i := 0; parent != nil && i < 32; i++ {
+		if parent.ContentType == contentType &&
+			strings.Contains(parent.MediaType["protocol"], protocol) {
+			return parent
+		}
+		parent = parent.Parent
+	}
+	return nil
+}
+
+// SMIMEFilter decrypts S/MIME encrypted parts (with smime.cert and smime.key),
+// verifies the opaque (smime.p7m) and detached (multipart/signed) signatures,
+// and records the result in the parts' header, for PrependHeaderFilter and the manifest.
+func SMIMEFilter(ctx context.Context,
+	inch <-chan i18nmail.MailPart, outch chan<- i18nmail.MailPart,
+	files chan<- ArchFileItem, errch chan<- error,
+) {
+	logger := getLogger(ctx)
+	defer close(outch)
+
+	var (
+		keys    *smimeKeys
+		keysErr error
+	)
+	getKeys := func() (*smimeKeys, error) {
+		if keys == nil && keysErr == nil {
+			keys, keysErr = loadSMIMEKeys()
+		}
+		return keys, keysErr
+	}
+	detached := make(map[int]SMIMEStatus)
+
+	var process func(part i18nmail.MailPart, st SMIMEStatus)
+	process = func(part i18nmail.MailPart, st SMIMEStatus) {
+		if part.Header != nil {
+			part.Header.Del(smimeHeader) // do not trust the sender
+		}
+		if signed := multipartAncestor(part, "multipart/signed", "pkcs7-signature"); signed != nil {
+			dst, ok := detached[signed.Seq]
+			if !ok {
+				var roots *x509.CertPool
+				k, err := getKeys()
+				if err != nil {
+					errch <- err
+				} else {
+					roots = k.roots
+				}
+				dst = verifyDetached(*signed, roots)
+				detached[signed.Seq] = dst
+				logger.Info("SMIMEFilter verify", "seq", signed.Seq, "status", dst.String())
+			}
+			st = st.merge(dst)
+		}
+		if isSMIMEPart(part) {
+			inner, ist, err := unwrapSMIME(part, getKeys)
+			if err != nil {
+				logger.Warn("SMIMEFilter", "seq", part.Seq, "error", err)
+				errch <- fmt.Errorf("S/MIME of %02d: %w", part.Seq, err)
+			} else {
+				logger.Info("SMIMEFilter unwrap", "seq", part.Seq, "status", ist.String())
+				st = st.merge(ist)
+				msg, err := mail.ReadMessage(io.MultiReader(bytes.NewReader(inner), strings.NewReader("\r\n\r\n")))
+				if err == nil {
+					err = i18nmail.WalkMessage(msg, func(child i18nmail.MailPart) error {
+						var head [4096]byte
+						n, _ := child.Body.ReadAt(head[:], 0)
+						child.ContentType = FixContentType(head[:n], child.ContentType, headerGetFileName(child.Header))
+						process(child, st)
+						return nil
+					}, false, &part)
+				}
+				if err == nil {
+					return
+				}
+				errch <- fmt.Errorf("walk decoded S/MIME of %02d: %w", part.Seq, err)
+			}
+		}
+		if !st.isZero() {
+			if part.Header == nil {
+				part.Header = make(map[string][]string, 1)
+			}
+			b, _ := json.Marshal(st)
+			part.Header.Set(smimeHeader, string(b))
+		}
+		outch <- part
+	}
+
+	for part := range inch {
+		process(part, SMIMEStatus{})
+	}
+}
+
+// unwrapSMIME decrypts or unpacks the signed smime.p7m part.
+func unwrapSMIME(part i18nmail.MailPart, getKeys func() (*smimeKeys, error)) ([]byte, SMIMEStatus, error) {
+	var st SMIMEStatus
+	b, err := io.ReadAll(io.LimitReader(part.GetBody(), MaxSize))
+	if err != nil {
+		return nil, st, err
+	}
+	p7, err := pkcs7.Parse(b)
+	if err != nil {
+		return nil, st, err
+	}
+	keys, err := getKeys()
+	if err != nil {
+		return nil, st, err
+	}
+	if len(p7.Signers) != 0 {
+		return p7.Content, verifyPKCS7(p7, keys.roots), nil
+	}
+	if keys.cert == nil {
+		return nil, st, errors.New("encrypted, but no smime.cert and smime.key is configured")
+	}
+	st.Encrypted = true
+	b, err = p7.Decrypt(keys.cert, keys.key)
+	return b, st, err
+}
+
+// verifyDetached verifies the multipart/signed part's signature.
+func verifyDetached(signed i18nmail.MailPart, roots *x509.CertPool) SMIMEStatus {
+	st := SMIMEStatus{Signed: true}
+	b, err := io.ReadAll(io.LimitReader(signed.GetBody(), MaxSize))
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	content, sig, err := splitSigned(b, signed.MediaType["boundary"])
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	p7, err := pkcs7.Parse(sig)
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	p7.Content = content
+	return verifyPKCS7(p7, roots)
+}
+
+// verifyPKCS7 checks the signature, and the signer's certificate chain.
+func verifyPKCS7(p7 *pkcs7.PKCS7, roots *x509.CertPool) SMIMEStatus {
+	st := SMIMEStatus{Signed: true}
+	ee := p7.GetOnlySigner()
+	if ee != nil {
+		st.Signer = ee.Subject.CommonName
+		if len(ee.EmailAddresses) != 0 {
+			st.Signer = strings.TrimSpace(st.Signer + " <" + ee.EmailAddresses[0] + ">")
+		}
+	}
+	if err := p7.Verify(); err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	st.Valid = true
+	if ee == nil {
+		st.Chain = "not exactly one signer"
+		return st
+	}
+	t := time.Now()
+	var signingTime time.Time
+	if err := p7.UnmarshalSignedAttribute(pkcs7.OIDAttributeSigningTime, &signingTime); err == nil {
+		t = signingTime
+	}
+	if _, err := pkcs7.VerifyCertChain(ee, p7.Certificates, roots, t); err != nil {
+		st.Chain = err.Error()
+	} else {
+		st.Trusted = true
+	}
+	return st
+}
+
+// splitSigned returns the canonicalized (CRLF) first part,
+// and the decoded signature (the second part) of the multipart/signed body.
+func splitSigned(b []byte, boundary string) (content, signature []byte, err error) {
+	if boundary == "" {
+		return nil, nil, errors.New("no boundary")
+	}
+	delim := []byte("--" + boundary)
+	// the delimiter must be at the beginning of a line
+	next := func(b []byte) int {
+		for off := 0; ; {
+			i := bytes.Index(b[off:], delim)
+			if i < 0 {
+				return -1
+			}
+			if i += off; i == 0 || b[i-1] == '\n' {
+				return i
+			}
+			off = i + 1
+		}
+	}
+	skipLine := func(b []byte) []byte {
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			return b[i+1:]
+		}
+		return nil
+	}
+	trimEOL := func(b []byte) []byte {
+		b = bytes.TrimSuffix(b, []byte{'\n'})
+		return bytes.TrimSuffix(b, []byte{'\r'})
+	}
+
+	i := next(b)
+	if i < 0 {
+		return nil, nil, errors.New("no first part")
+	}
+	b = skipLine(b[i:])
+	if i = next(b); i < 0 {
+		return nil, nil, errors.New("no signature part")
+	}
+	content = bytes.ReplaceAll(bytes.ReplaceAll(trimEOL(b[:i]), []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+	b = skipLine(b[i:])
+	if i = next(b); i >= 0 {
+		b = trimEOL(b[:i])
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read signature part: %w", err)
+	}
+	if signature, err = io.ReadAll(msg.Body); err != nil {
+		return nil, nil, err
+	}
+	if strings.EqualFold(msg.Header.Get("Content-Transfer-Encoding"), "base64") {
+		signature = bytes.Join(bytes.Fields(signature), nil)
+		if signature, err = base64.StdEncoding.DecodeString(string(signature)); err != nil {
+			return nil, nil, fmt.Errorf("decode signature: %w", err)
+		}
+	}
+	return content, signature, nil
+}
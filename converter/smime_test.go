@@ -0,0 +1,159 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hhrutter/pkcs7"
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+func TestSMIMEFilter(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: "Alice"},
+		EmailAddresses: []string{"alice@example.com"},
+		NotBefore:      time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFn, keyFn := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err = os.WriteFile(certFn, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFn, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	oldCert, oldKey, oldCA := *ConfSMIMECert, *ConfSMIMEKey, *ConfSMIMECA
+	*ConfSMIMECert, *ConfSMIMEKey, *ConfSMIMECA = certFn, keyFn, certFn
+	defer func() { *ConfSMIMECert, *ConfSMIMEKey, *ConfSMIMECA = oldCert, oldKey, oldCA }()
+
+	const inner = "Content-Type: text/plain; charset=utf-8\r\n\r\nsecret text\r\n"
+	sign := func(content string, detach bool) string {
+		sd, err := pkcs7.NewSignedData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := sha256.Sum256([]byte(content))
+		if err = sd.AddSigner(cert, key, digest[:], pkcs7.OIDDigestAlgorithmSHA256, pkcs7.SignerInfoConfig{}); err != nil {
+			t.Fatal(err)
+		}
+		if detach {
+			sd.Detach()
+		} else {
+			octets, err := asn1.Marshal([]byte(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sd.GetSignedData().ContentInfo.Content = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets}
+		}
+		b, err := sd.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	signed := func(content, signedContent string) string {
+		return "From: alice@example.com\r\nSubject: signed\r\nMIME-Version: 1.0\r\n" +
+			"Content-Type: multipart/signed; protocol=\"application/pkcs7-signature\"; micalg=sha-256; boundary=\"BND\"\r\n\r\n" +
+			"--BND\r\n" + content + "\r\n--BND\r\n" +
+			"Content-Type: application/pkcs7-signature; name=smime.p7s\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+			sign(signedContent, true) + "\r\n--BND--\r\n"
+	}
+	// i18nmail.Walk unpacks the top-level application/x-pkcs7-mime with openssl, if it can
+	opaque := func(contentType string) string {
+		var buf strings.Builder
+		buf.WriteString("From: alice@example.com\r\nSubject: opaque\r\nMIME-Version: 1.0\r\n" +
+			"Content-Type: " + contentType + "; smime-type=signed-data; name=smime.p7m\r\nContent-Transfer-Encoding: base64\r\n\r\n")
+		// openssl does not read overlong base64 lines
+		for s := sign(inner, false); s != ""; {
+			n := min(len(s), 76)
+			buf.WriteString(s[:n] + "\r\n")
+			s = s[n:]
+		}
+		return buf.String()
+	}
+	enc, err := pkcs7.Encrypt([]byte(inner), []*x509.Certificate{cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := "From: alice@example.com\r\nSubject: encrypted\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=smime.p7m\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString(enc) + "\r\n"
+
+	for i, tc := range []struct {
+		Name, Mail string
+		Want       SMIMEStatus
+	}{
+		{"signed", signed(inner, inner), SMIMEStatus{Signed: true, Signer: "Alice <alice@example.com>", Valid: true, Trusted: true}},
+		{"tampered", signed(inner, strings.Replace(inner, "secret", "public", 1)), SMIMEStatus{Signed: true, Signer: "Alice <alice@example.com>"}},
+		{"encrypted", encrypted, SMIMEStatus{Encrypted: true}},
+		{"opaque", opaque("application/pkcs7-mime"), SMIMEStatus{Signed: true, Signer: "Alice <alice@example.com>", Valid: true, Trusted: true}},
+		{"opaque x-", opaque("application/x-pkcs7-mime"), SMIMEStatus{Signed: true, Signer: "Alice <alice@example.com>", Valid: true, Trusted: true}},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		rawch := make(chan i18nmail.MailPart)
+		outch := make(chan i18nmail.MailPart)
+		errch := make(chan error, 16)
+		go SlurpMail(ctx, rawch, errch, strings.NewReader(tc.Mail), messageRFC822)
+		go SMIMEFilter(ctx, rawch, outch, nil, errch)
+		var text *i18nmail.MailPart
+		for part := range outch {
+			if part.ContentType == textPlain {
+				text = &part
+			}
+		}
+		cancel()
+		close(errch)
+		for err := range errch {
+			t.Errorf("%d. %s: %+v", i, tc.Name, err)
+		}
+		if text == nil {
+			t.Errorf("%d. %s: no text part", i, tc.Name)
+			continue
+		}
+		if b, _ := io.ReadAll(text.GetBody()); !strings.Contains(string(b), "secret text") {
+			t.Errorf("%d. %s: got body %q", i, tc.Name, b)
+		}
+		got := getSMIMEStatus(text.Header)
+		if got == nil {
+			t.Errorf("%d. %s: no status", i, tc.Name)
+			continue
+		}
+		got.Error = ""
+		if *got != tc.Want {
+			t.Errorf("%d. %s: got %+v, want %+v", i, tc.Name, *got, tc.Want)
+		}
+	}
+}
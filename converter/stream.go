@@ -0,0 +1,115 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MailToPdfStream converts the mail as MailToSplittedPdfZip does, but instead of
+// zipping the results, calls emit with each PDF (or page, or page image) as soon as
+// it is ready. The errors (ErrTextFn) and the manifest (ManifestFn) are emitted last.
+//
+// The files are removed after emit returns. The parts failed to convert are emitted
+// with their original content in File (and without Filename).
+func MailToPdfStream(ctx context.Context, body io.Reader,
+	contentType string, split bool, imgmime, imgsize string,
+	pages []uint16,
+	emit func(ArchFileItem) error,
+) error {
+	logger := getLogger(ctx)
+	ctx, wd := PrepareContext(ctx, "")
+	ctx, manifest := withManifest(ctx)
+	var (
+		errs    []string
+		emitted []ArchFileItem
+		emitErr error
+	)
+	sources := make(map[string]string)
+	send := func(item ArchFileItem) error {
+		if item.Archive == "" {
+			item.Archive = unsafeFn(filepath.Base(item.Filename), true)
+		}
+		emitted = append(emitted, item)
+		emitErr = emit(item)
+		return emitErr
+	}
+
+	files, err := mailToPdfFiles(ctx, body, contentType, func(item ArchFileItem) error {
+		if item.Error != nil {
+			if isCanceled(item.Error) {
+				return item.Error
+			}
+			errs = append(errs, item.ArchiveName()+": "+item.Error.Error()+"\n")
+		}
+		// the failed parts are sent as is (File), not split
+		if item.Filename == "" || !split && imgmime == "" {
+			return send(item)
+		}
+		rch := make(chan maybeArchItems, 1)
+		go splitPdfMulti(ctx, []string{item.Filename}, imgmime, imgsize, rch, pages)
+		for ms := range rch {
+			if ms.Error != nil {
+				if isCanceled(ms.Error) {
+					return ms.Error
+				}
+				errs = append(errs, ms.Error.Error()+"\n")
+			}
+			for _, item := range ms.Items {
+				sources[item.Filename] = ms.Source
+				if err := send(item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	defer func() { cleanupFiles(ctx, files, emitted) }()
+	if emitErr != nil {
+		return emitErr
+	}
+	if err != nil {
+		if isCanceled(err) || len(emitted) == 0 {
+			return err
+		}
+		errs = append([]string{err.Error() + "\n"}, errs...)
+	}
+	if len(emitted) == 0 {
+		return errors.New("no files to convert")
+	}
+	logger.Info("MailToPdfStream", "error", errs, "emitted", len(emitted))
+
+	if len(errs) != 0 {
+		efn := filepath.Join(wd, "stream-"+ErrTextFn)
+		if err = os.WriteFile(efn, []byte(strings.Join(errs, "")), 0640); err != nil {
+			return err
+		}
+		if err = send(ArchFileItem{Filename: efn, Archive: ErrTextFn}); err != nil {
+			return err
+		}
+	}
+
+	if rawHeadersMode(ctx) != "" {
+		rfn := filepath.Join(wd, "stream-"+RawHeadersFn)
+		if err = manifest.writeRawHeaders(ctx, rfn); err != nil {
+			logger.Warn("write raw headers", "dest", rfn, "error", err)
+		} else if err = send(ArchFileItem{Filename: rfn, Archive: RawHeadersFn}); err != nil {
+			return err
+		}
+	}
+
+	manifest.setArchives(emitted, sources)
+	mfn := filepath.Join(wd, "stream-"+ManifestFn)
+	if err = manifest.WriteFile(mfn); err != nil {
+		logger.Warn("write manifest", "dest", mfn, "error", err)
+		return nil
+	}
+	return send(ArchFileItem{Filename: mfn, Archive: ManifestFn})
+}
@@ -0,0 +1,266 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/tgulacsi/go/i18nmail"
+	"golang.org/x/sync/errgroup"
+)
+
+// ThreadMessage is a message of a conversation.
+type ThreadMessage struct {
+	parent *ThreadMessage
+	// Date is the Date header of the message, zero if missing.
+	Date                 time.Time
+	MessageID, InReplyTo string
+	Subject, From        string
+	Error                string
+	References           []string
+	body                 []byte
+	Seq, Pages           int
+}
+
+// NewThreadMessage returns the message (the seq'th of the conversation) with the data from its header.
+func NewThreadMessage(seq int, b []byte) *ThreadMessage {
+	m := ThreadMessage{Seq: seq, body: b}
+	if IsEmlx(b) {
+		if sr, err := EmlxMessage(io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b)))); err == nil {
+			m.body = make([]byte, sr.Size())
+			n, _ := sr.ReadAt(m.body, 0)
+			m.body = m.body[:n]
+		}
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(m.body))
+	if err != nil {
+		return &m
+	}
+	hdr := msg.Header
+	m.Subject = i18nmail.HeadDecode(hdr.Get("Subject"))
+	m.From = i18nmail.HeadDecode(hdr.Get("From"))
+	if addr, err := mail.ParseAddress(m.From); err == nil {
+		if m.From = addr.Name; m.From == "" {
+			m.From = addr.Address
+		}
+	}
+	m.Date, _ = mail.ParseDate(hdr.Get("Date"))
+	m.MessageID = firstMessageID(hdr.Get("Message-Id"))
+	m.InReplyTo = firstMessageID(hdr.Get("In-Reply-To"))
+	m.References = messageIDs(hdr.Get("References"))
+	return &m
+}
+
+// messageIDs returns the <message-id>s of the header value.
+func messageIDs(s string) []string {
+	var ids []string
+	for {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			return ids
+		}
+		j := strings.IndexByte(s[i:], '>')
+		if j < 0 {
+			return ids
+		}
+		if id := strings.TrimSpace(s[i+1 : i+j]); id != "" {
+			ids = append(ids, id)
+		}
+		s = s[i+j+1:]
+	}
+}
+
+func firstMessageID(s string) string {
+	if ids := messageIDs(s); len(ids) != 0 {
+		return ids[0]
+	}
+	return strings.Trim(strings.TrimSpace(s), "<>")
+}
+
+// Title is the title of the message's bookmark.
+func (m *ThreadMessage) Title() string {
+	var buf strings.Builder
+	if !m.Date.IsZero() {
+		buf.WriteString(m.Date.Format("2006-01-02 15:04"))
+		buf.WriteByte(' ')
+	}
+	if m.From != "" {
+		buf.WriteString(m.From)
+		buf.WriteString(": ")
+	}
+	if m.Subject != "" {
+		buf.WriteString(m.Subject)
+	} else {
+		fmt.Fprintf(&buf, "#%d", m.Seq)
+	}
+	return buf.String()
+}
+
+// OrderThread orders the messages chronologically (by their Date), but a reply
+// (by In-Reply-To or References) always after the message it answers.
+// The messages without Date come first, the ties keep their original order.
+func OrderThread(msgs []*ThreadMessage) []*ThreadMessage {
+	byID := make(map[string]*ThreadMessage, len(msgs))
+	for _, m := range msgs {
+		if m.MessageID != "" && byID[m.MessageID] == nil {
+			byID[m.MessageID] = m
+		}
+	}
+	for _, m := range msgs {
+		m.parent = nil
+		ids := make([]string, 0, 1+len(m.References))
+		ids = append(ids, m.InReplyTo)
+		for i := len(m.References) - 1; i >= 0; i-- { // the nearest ancestor is the last
+			ids = append(ids, m.References[i])
+		}
+		for _, id := range ids {
+			if p := byID[id]; p != nil && p != m {
+				m.parent = p
+				break
+			}
+		}
+	}
+
+	done := make(map[*ThreadMessage]bool, len(msgs))
+	ordered := make([]*ThreadMessage, 0, len(msgs))
+	earliest := func(ready bool) *ThreadMessage {
+		var next *ThreadMessage
+		for _, m := range msgs {
+			if done[m] || ready && m.parent != nil && !done[m.parent] {
+				continue
+			}
+			if next == nil || m.Date.Before(next.Date) {
+				next = m
+			}
+		}
+		return next
+	}
+	for len(ordered) < len(msgs) {
+		next := earliest(true)
+		if next == nil { // the replies form a cycle: break it at the earliest
+			next = earliest(false)
+		}
+		done[next] = true
+		ordered = append(ordered, next)
+	}
+	return ordered
+}
+
+// ThreadToPdf converts the messages of a conversation into one PDF (destfn), in the order of OrderThread,
+// with a bookmark for each message.
+//
+// With collapseQuotes, the quoted text repeating the previous message
+// (the one answered, or the preceding one) is replaced by a short note.
+//
+// It returns the messages in that order; the failed ones have their Error on their page.
+// At most ConfMboxParallel messages are converted in parallel.
+func ThreadToPdf(ctx context.Context, destfn string, messages [][]byte, collapseQuotes bool) ([]*ThreadMessage, error) {
+	logger := getLogger(ctx)
+	if len(messages) == 0 {
+		return nil, errors.New("no messages")
+	}
+	ctx, wd := PrepareContext(ctx, "")
+	msgs := make([]*ThreadMessage, len(messages))
+	for i, b := range messages {
+		msgs[i] = NewThreadMessage(i+1, b)
+	}
+	msgs = OrderThread(msgs)
+	defer func() {
+		for _, m := range msgs {
+			_ = os.RemoveAll(filepath.Join(wd, threadWorkDir(m.Seq)))
+		}
+	}()
+
+	parallel := *ConfMboxParallel
+	if parallel <= 0 {
+		parallel = Concurrency
+	}
+	grp, grpCtx := errgroup.WithContext(ctx)
+	grp.SetLimit(parallel)
+	fns := make([]string, len(msgs))
+	for i, m := range msgs {
+		var prev *ThreadMessage
+		if m.parent != nil {
+			prev = m.parent
+		} else if i > 0 {
+			prev = msgs[i-1]
+		}
+		grp.Go(func() error {
+			mctx, mwd := PrepareContext(grpCtx, threadWorkDir(m.Seq))
+			if collapseQuotes && prev != nil {
+				mctx = withQuotedText(mctx, messageText(mctx, prev.body))
+			}
+			fn := filepath.Join(mwd, "message.pdf")
+			if err := threadMessageToPdf(mctx, fn, m); err != nil {
+				if isCanceled(err) {
+					return err
+				}
+				logger.Warn("convert message", "seq", m.Seq, "subject", m.Subject, "error", err)
+				m.Error = err.Error()
+				if err = TextToPdf(mctx, fn, strings.NewReader(m.Title()+"\n\n"+m.Error), textPlain); err != nil {
+					return fmt.Errorf("%s: %w", m.Title(), err)
+				}
+			}
+			var err error
+			if m.Pages, err = PdfPageNum(mctx, fn); err != nil {
+				return fmt.Errorf("%s: %w", m.Title(), err)
+			}
+			fns[i] = fn
+			return nil
+		})
+	}
+	if err := grp.Wait(); err != nil {
+		return msgs, err
+	}
+
+	mfn := filepath.Join(wd, "thread-merged.pdf")
+	defer os.Remove(mfn)
+	if err := PdfMerge(ctx, mfn, fns...); err != nil {
+		return msgs, err
+	}
+	bms := make([]pdfcpu.Bookmark, len(msgs))
+	page := 1
+	for i, m := range msgs {
+		bms[i] = pdfcpu.Bookmark{Title: m.Title(), PageFrom: page}
+		page += m.Pages
+	}
+	if err := api.AddBookmarksFile(mfn, destfn, bms, true, nil); err != nil {
+		return msgs, fmt.Errorf("add bookmarks: %w", err)
+	}
+	return msgs, nil
+}
+
+// threadMessageToPdf converts the message into one PDF.
+func threadMessageToPdf(ctx context.Context, destfn string, m *ThreadMessage) error {
+	files, err := MailToPdfFiles(ctx, bytes.NewReader(m.body), messageRFC822)
+	defer cleanupFiles(ctx, files, nil)
+	fns := make([]string, 0, len(files))
+	for _, item := range files {
+		if item.Error == nil {
+			fns = append(fns, item.Filename)
+		}
+	}
+	if len(fns) == 0 {
+		if err == nil {
+			err = errors.New("no convertable part")
+		}
+		return err
+	}
+	return PdfMerge(ctx, destfn, fns...)
+}
+
+// threadWorkDir is the name of the message's working (sub)directory.
+func threadWorkDir(seq int) string { return fmt.Sprintf("thread-%06d", seq) }
@@ -0,0 +1,98 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestOrderThread(t *testing.T) {
+	msg := func(id, inReplyTo, refs, date, subject string) []byte {
+		s := "From: Joe <joe@example.com>\r\nSubject: " + subject + "\r\nMessage-ID: <" + id + ">\r\n"
+		if inReplyTo != "" {
+			s += "In-Reply-To: <" + inReplyTo + ">\r\n"
+		}
+		if refs != "" {
+			s += "References: " + refs + "\r\n"
+		}
+		if date != "" {
+			s += "Date: " + date + "\r\n"
+		}
+		return []byte(s + "\r\nHello\r\n")
+	}
+	for i, tc := range []struct {
+		Messages [][]byte
+		Want     string
+	}{
+		{[][]byte{
+			msg("c@x", "b@x", "<a@x> <b@x>", "Mon, 1 Jan 2024 12:00:00 +0000", "c"),
+			msg("a@x", "", "", "Mon, 1 Jan 2024 10:00:00 +0000", "a"),
+			msg("b@x", "a@x", "<a@x>", "Mon, 1 Jan 2024 11:00:00 +0000", "b"),
+		}, "a b c"},
+		// the reply's clock is wrong: still after the answered one
+		{[][]byte{
+			msg("b@x", "a@x", "", "Mon, 1 Jan 2024 09:00:00 +0000", "b"),
+			msg("a@x", "", "", "Mon, 1 Jan 2024 10:00:00 +0000", "a"),
+			msg("d@x", "", "", "Mon, 1 Jan 2024 09:30:00 +0000", "d"),
+		}, "d a b"},
+		// References only, with a missing message
+		{[][]byte{
+			msg("c@x", "", "<a@x> <b@x>", "Mon, 1 Jan 2024 08:00:00 +0000", "c"),
+			msg("a@x", "", "", "Mon, 1 Jan 2024 10:00:00 +0000", "a"),
+		}, "a c"},
+		// no dates: the original order, a cycle is broken after the others
+		{[][]byte{
+			msg("a@x", "b@x", "", "", "a"),
+			msg("b@x", "a@x", "", "", "b"),
+			msg("c@x", "", "", "", "c"),
+		}, "c a b"},
+	} {
+		msgs := make([]*ThreadMessage, len(tc.Messages))
+		for j, b := range tc.Messages {
+			msgs[j] = NewThreadMessage(j+1, b)
+		}
+		var subjects []string
+		for _, m := range OrderThread(msgs) {
+			subjects = append(subjects, m.Subject)
+		}
+		if got := strings.Join(subjects, " "); got != tc.Want {
+			t.Errorf("%d. got %q, want %q", i, got, tc.Want)
+		}
+	}
+}
+
+func TestCollapseQuotes(t *testing.T) {
+	const prevText = "Hi Sue,\r\n\r\nthe meeting is moved to Tuesday, 10 o'clock, in the small room\r\n" +
+		"on the second floor. Please bring the quarterly report.\r\n\r\nJoe\r\n"
+	prev := messageText(context.Background(), []byte(
+		"From: Joe <joe@example.com>\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n"+prevText))
+
+	const reply = "OK, thanks!\n\nOn Monday, Joe wrote:\n" +
+		"> Hi Sue,\n>\n> the meeting is moved to Tuesday, 10 o'clock, in the small room\n" +
+		"> on the second floor. Please bring the quarterly report.\n>\n> Joe\n"
+	for i, tc := range []struct {
+		Text, Want string
+	}{
+		{reply, "OK, thanks!\n\nOn Monday, Joe wrote:\n[… 6 quoted lines of the previous message …]\n"},
+		// interleaved short quotes are kept
+		{"> the meeting is moved to Tuesday\nFine.\n", "> the meeting is moved to Tuesday\nFine.\n"},
+		// not from the previous message
+		{strings.Replace(reply, "Tuesday", "Friday", 1), strings.Replace(reply, "Tuesday", "Friday", 1)},
+	} {
+		got, _ := collapseTextQuotes([]byte(tc.Text), prev)
+		if string(got) != tc.Want {
+			t.Errorf("%d. got %q, want %q", i, got, tc.Want)
+		}
+	}
+
+	got, n := collapseHTMLQuotes([]byte(`<html><body><p>OK, thanks!</p><div class="gmail_quote">Joe wrote:<blockquote>`+
+		`<div>Hi Sue,</div><div>the meeting is moved to Tuesday, 10 o'clock, in the small room on the second floor.</div>`+
+		`<div>Please bring the quarterly report.</div></blockquote></div></body></html>`), prev)
+	if n != 1 || !strings.Contains(string(got), `<p class="agostle-collapsed">`) || strings.Contains(string(got), "quarterly") {
+		t.Errorf("got %d %q", n, got)
+	}
+}
@@ -0,0 +1,465 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/tgulacsi/go/i18nmail"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// TNEF (Transport Neutral Encapsulation Format, winmail.dat), see [MS-OXTNEF].
+
+const tnefSignature = 0x223E9F78
+
+// TNEF attribute IDs (without the type in the high word).
+const (
+	tnefAttBody           = 0x800C
+	tnefAttAttachData     = 0x800F
+	tnefAttAttachTitle    = 0x8010
+	tnefAttAttachRendData = 0x9002
+	tnefAttMsgProps       = 0x9003
+	tnefAttAttachment     = 0x9005
+)
+
+// MAPI property IDs and types.
+const (
+	mapiBody            = 0x1000
+	mapiRTFCompressed   = 0x1009
+	mapiBodyHTML        = 0x1013
+	mapiAttachDataBin   = 0x3701
+	mapiAttachLongFn    = 0x3707
+	mapiAttachMimeTag   = 0x370E
+	mapiAttachFilename  = 0x3704
+	mapiTypeString8     = 0x001E
+	mapiTypeUnicode     = 0x001F
+	mapiTypeBinary      = 0x0102
+	mapiTypeObject      = 0x000D
+	mapiTypeMultiValued = 0x1000
+)
+
+// TNEFAttachment is a file embedded in a TNEF stream.
+type TNEFAttachment struct {
+	Filename, ContentType string
+	Data                  []byte
+}
+
+// TNEF is the decoded content of a TNEF stream.
+type TNEF struct {
+	// Body is the plain text body.
+	Body string
+	// HTML is the HTML body.
+	HTML []byte
+	// RTF is the decompressed RTF body.
+	RTF         []byte
+	Attachments []TNEFAttachment
+}
+
+// IsTNEF reports whether b starts with the TNEF signature.
+func IsTNEF(b []byte) bool {
+	return len(b) >= 4 && binary.LittleEndian.Uint32(b) == tnefSignature
+}
+
+// DecodeTNEF decodes the TNEF stream.
+func DecodeTNEF(b []byte) (*TNEF, error) {
+	if !IsTNEF(b) {
+		return nil, errors.New("not TNEF: bad signature")
+	}
+	if len(b) < 6 {
+		return nil, errors.New("TNEF: truncated header")
+	}
+	b = b[6:] // signature, key
+	var t TNEF
+	var att *TNEFAttachment
+	for len(b) != 0 {
+		if len(b) < 9 {
+			return &t, fmt.Errorf("TNEF: truncated attribute header (%d bytes)", len(b))
+		}
+		level, id := b[0], binary.LittleEndian.Uint32(b[1:5])&0xFFFF
+		length := binary.LittleEndian.Uint32(b[5:9])
+		b = b[9:]
+		if uint64(len(b)) < uint64(length)+2 {
+			return &t, fmt.Errorf("TNEF: attribute %04x is truncated", id)
+		}
+		data := b[:length]
+		b = b[length+2:] // checksum
+		switch id {
+		case tnefAttAttachRendData:
+			t.Attachments = append(t.Attachments, TNEFAttachment{})
+			att = &t.Attachments[len(t.Attachments)-1]
+		case tnefAttAttachTitle:
+			if att != nil && att.Filename == "" {
+				att.Filename = tnefString8(data)
+			}
+		case tnefAttAttachData:
+			if att != nil {
+				att.Data = data
+			}
+		case tnefAttBody:
+			if level == 1 {
+				t.Body = tnefString8(data)
+			}
+		case tnefAttAttachment, tnefAttMsgProps:
+			props, err := parseMAPIProps(data)
+			if err != nil {
+				return &t, fmt.Errorf("TNEF: MAPI properties of %04x: %w", id, err)
+			}
+			if id == tnefAttMsgProps {
+				if err = t.setMsgProps(props); err != nil {
+					return &t, err
+				}
+			} else if att != nil {
+				att.setProps(props)
+			}
+		}
+	}
+	// drop the empty ones (such as embedded messages)
+	atts := t.Attachments[:0]
+	for _, a := range t.Attachments {
+		if len(a.Data) != 0 {
+			atts = append(atts, a)
+		}
+	}
+	t.Attachments = atts
+	return &t, nil
+}
+
+func (t *TNEF) setMsgProps(props []mapiProp) error {
+	for _, p := range props {
+		if len(p.Values) == 0 {
+			continue
+		}
+		switch p.ID {
+		case mapiBody:
+			if t.Body == "" {
+				t.Body = p.String()
+			}
+		case mapiBodyHTML:
+			t.HTML = p.Values[0]
+		case mapiRTFCompressed:
+			rtf, err := DecompressRTF(p.Values[0])
+			if err != nil {
+				return fmt.Errorf("TNEF: RTF body: %w", err)
+			}
+			t.RTF = rtf
+		}
+	}
+	return nil
+}
+
+func (a *TNEFAttachment) setProps(props []mapiProp) {
+	for _, p := range props {
+		if len(p.Values) == 0 {
+			continue
+		}
+		switch p.ID {
+		case mapiAttachLongFn:
+			a.Filename = p.String()
+		case mapiAttachFilename:
+			if a.Filename == "" {
+				a.Filename = p.String()
+			}
+		case mapiAttachMimeTag:
+			a.ContentType = p.String()
+		case mapiAttachDataBin:
+			if len(a.Data) == 0 && p.Type == mapiTypeBinary {
+				a.Data = p.Values[0]
+			}
+		}
+	}
+}
+
+type mapiProp struct {
+	Values   [][]byte
+	ID, Type uint16
+}
+
+// String returns the first value as string.
+func (p mapiProp) String() string {
+	if p.Type&^mapiTypeMultiValued == mapiTypeUnicode {
+		b := p.Values[0]
+		u := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			u = append(u, binary.LittleEndian.Uint16(b[i:]))
+		}
+		return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+	}
+	return tnefString8(p.Values[0])
+}
+
+func tnefString8(b []byte) string {
+	b = bytes.TrimRight(b, "\x00")
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	s, _ := charmap.Windows1252.NewDecoder().Bytes(b)
+	return string(s)
+}
+
+// parseMAPIProps parses the MAPI property list of attMsgProps and attAttachment.
+func parseMAPIProps(b []byte) ([]mapiProp, error) {
+	rd := tnefReader{b: b}
+	count := rd.uint32()
+	props := make([]mapiProp, 0, min(int(count), 1024))
+	for i := uint32(0); i < count && rd.err == nil; i++ {
+		p := mapiProp{Type: rd.uint16(), ID: rd.uint16()}
+		if p.ID >= 0x8000 { // named property
+			rd.bytes(16) // GUID
+			if rd.uint32() == 0 {
+				rd.uint32()
+			} else {
+				rd.padded(rd.uint32())
+			}
+		}
+		typ := p.Type &^ mapiTypeMultiValued
+		n := uint32(1)
+		if p.Type&mapiTypeMultiValued != 0 {
+			n = rd.uint32()
+		}
+		switch typ {
+		case mapiTypeString8, mapiTypeUnicode, mapiTypeBinary, mapiTypeObject:
+			if p.Type&mapiTypeMultiValued == 0 {
+				n = rd.uint32()
+			}
+			for j := uint32(0); j < n && rd.err == nil; j++ {
+				v := rd.padded(rd.uint32())
+				if typ == mapiTypeObject && len(v) >= 16 {
+					v = v[16:] // IID
+				}
+				p.Values = append(p.Values, v)
+			}
+		default:
+			size, ok := mapiFixedSize[typ]
+			if !ok {
+				return props, fmt.Errorf("unknown MAPI type %04x of %04x", typ, p.ID)
+			}
+			for j := uint32(0); j < n && rd.err == nil; j++ {
+				p.Values = append(p.Values, rd.padded(size))
+			}
+		}
+		props = append(props, p)
+	}
+	return props, rd.err
+}
+
+var mapiFixedSize = map[uint16]uint32{
+	0x0001: 0, 0x0002: 2, 0x0003: 4, 0x0004: 4, 0x0005: 8, 0x0006: 8, 0x0007: 8,
+	0x000A: 4, 0x000B: 2, 0x0014: 8, 0x0040: 8, 0x0048: 16,
+}
+
+type tnefReader struct {
+	err error
+	b   []byte
+}
+
+func (rd *tnefReader) bytes(n uint32) []byte {
+	if rd.err != nil {
+		return nil
+	}
+	if uint64(len(rd.b)) < uint64(n) {
+		rd.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	p := rd.b[:n]
+	rd.b = rd.b[n:]
+	return p
+}
+
+// padded reads n bytes, and skips the padding to 4 bytes.
+func (rd *tnefReader) padded(n uint32) []byte {
+	p := rd.bytes(n)
+	if pad := (4 - n%4) % 4; pad != 0 && uint32(len(rd.b)) >= pad {
+		rd.b = rd.b[pad:]
+	}
+	return p
+}
+
+func (rd *tnefReader) uint16() uint16 {
+	if p := rd.bytes(2); p != nil {
+		return binary.LittleEndian.Uint16(p)
+	}
+	return 0
+}
+
+func (rd *tnefReader) uint32() uint32 {
+	if p := rd.bytes(4); p != nil {
+		return binary.LittleEndian.Uint32(p)
+	}
+	return 0
+}
+
+// rtfPrebuf is the initial dictionary of the compressed RTF, see [MS-OXRTFCP].
+const rtfPrebuf = `{\rtf1\ansi\mac\deff0\deftab720{\fonttbl;}{\f0\fnil \froman ` +
+	`\fswiss \fmodern \fscript \fdecor MS Sans SerifSymbolArialTimes New RomanCourier` +
+	`{\colortbl\red0\green0\blue0` + "\r\n" + `\par \pard\plain\f0\fs20\b\i\u\tab\tx`
+
+// DecompressRTF decompresses the PR_RTF_COMPRESSED property.
+func DecompressRTF(b []byte) ([]byte, error) {
+	if len(b) < 16 {
+		return nil, errors.New("compressed RTF: short header")
+	}
+	compSize := binary.LittleEndian.Uint32(b)
+	rawSize := binary.LittleEndian.Uint32(b[4:])
+	switch string(b[8:12]) {
+	case "MELA": // uncompressed
+		if uint64(rawSize) < uint64(len(b)-16) {
+			return b[16 : 16+int(rawSize)], nil
+		}
+		return b[16:], nil
+	case "LZFu":
+	default:
+		return nil, fmt.Errorf("compressed RTF: unknown type %q", b[8:12])
+	}
+	// compSize counts from the rawSize field (after compSize)
+	if compSize < 12 || 4+uint64(compSize) > uint64(len(b)) {
+		return nil, fmt.Errorf("compressed RTF: bad size %d (have %d bytes)", compSize, len(b))
+	}
+	src := b[16 : 4+int(compSize)]
+	var dict [4096]byte
+	wpos := copy(dict[:], rtfPrebuf)
+	// a reference of the dictionary may repeat up to 17 bytes: stop at the declared size
+	limit := int64(rawSize)
+	if limit > MaxSize {
+		limit = MaxSize
+	}
+	errTooLong := fmt.Errorf("compressed RTF: longer than %d bytes", limit)
+	out := make([]byte, 0, limit)
+	for i := 0; i < len(src); {
+		control := src[i]
+		i++
+		for bit := 0; bit < 8 && i < len(src); bit++ {
+			if control&(1<<bit) == 0 {
+				if int64(len(out)) >= limit {
+					return nil, errTooLong
+				}
+				c := src[i]
+				i++
+				out = append(out, c)
+				dict[wpos] = c
+				wpos = (wpos + 1) % len(dict)
+				continue
+			}
+			if i+1 >= len(src) {
+				return out, io.ErrUnexpectedEOF
+			}
+			ref := int(src[i])<<8 | int(src[i+1])
+			i += 2
+			offset, length := ref>>4, ref&0xF+2
+			if offset == wpos {
+				return out, nil
+			}
+			if int64(len(out)+length) > limit {
+				return nil, errTooLong
+			}
+			for j := 0; j < length; j++ {
+				c := dict[(offset+j)%len(dict)]
+				out = append(out, c)
+				dict[wpos] = c
+				wpos = (wpos + 1) % len(dict)
+			}
+		}
+	}
+	return out, nil
+}
+
+func isTNEFPart(part i18nmail.MailPart) bool {
+	switch part.ContentType {
+	case "application/ms-tnef", "application/vnd.ms-tnef":
+		return true
+	}
+	if part.Body == nil {
+		return false
+	}
+	var head [4]byte
+	n, _ := part.Body.ReadAt(head[:], 0)
+	return IsTNEF(head[:n])
+}
+
+// TNEFFilter decodes the TNEF (winmail.dat) parts,
+// and sends the bodies and attachments found in them as child parts.
+func TNEFFilter(ctx context.Context,
+	inch <-chan i18nmail.MailPart, outch chan<- i18nmail.MailPart,
+	files chan<- ArchFileItem, errch chan<- error,
+) {
+	logger := getLogger(ctx)
+	defer close(outch)
+	for part := range inch {
+		if !isTNEFPart(part) {
+			outch <- part
+			continue
+		}
+		b, err := io.ReadAll(io.LimitReader(part.GetBody(), MaxSize))
+		var t *TNEF
+		if err == nil {
+			t, err = DecodeTNEF(b)
+		}
+		if err != nil {
+			logger.Warn("TNEFFilter", "seq", part.Seq, "error", err)
+			errch <- fmt.Errorf("decode TNEF of %02d: %w", part.Seq, err)
+			if t == nil {
+				outch <- part
+				continue
+			}
+		}
+		// the decoded files count into the extraction limits, as the files of archives
+		limits := getExtractLimits(ctx)
+		var extracted int64
+		send := func(name, contentType string, data []byte) error {
+			if err := limits.addEntry(name); err != nil {
+				return err
+			}
+			if err := limits.charge(name, int64(len(data)), int64(len(b)), extracted); err != nil {
+				return err
+			}
+			extracted += int64(len(data))
+			child := part.Spawn()
+			child.ContentType = FixContentType(data, contentType, name)
+			if child.ContentType == textPlain {
+				child.MediaType = map[string]string{"charset": "utf-8"}
+			}
+			child.Body = io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))
+			child.Header = textproto.MIMEHeader{"X-FileName": {safeFn(name, true)}}
+			outch <- child
+			return nil
+		}
+		switch {
+		case len(t.HTML) != 0:
+			err = send("winmail.html", textHtml, t.HTML)
+		case len(t.RTF) != 0:
+			err = send("winmail.rtf", "application/rtf", t.RTF)
+		case strings.TrimSpace(t.Body) != "":
+			err = send("winmail.txt", textPlain, []byte(t.Body))
+		}
+		for i, a := range t.Attachments {
+			if err != nil {
+				break
+			}
+			name := a.Filename
+			if name == "" {
+				name = fmt.Sprintf("attachment-%d", i+1)
+			}
+			ct := a.ContentType
+			if ct == "" {
+				ct = "application/octet-stream"
+			}
+			err = send(name, ct, a.Data)
+		}
+		logger.Info("TNEFFilter", "seq", part.Seq, "attachments", len(t.Attachments), "error", err)
+		if err != nil {
+			errch <- fmt.Errorf("TNEF of %02d: %w", part.Seq, err)
+			failPart(ctx, part, err)
+		}
+	}
+}
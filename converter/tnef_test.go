@@ -0,0 +1,173 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/tgulacsi/go/i18nmail"
+)
+
+func TestDecompressRTF(t *testing.T) {
+	// from [MS-OXRTFCP] 4.1
+	comp := []byte{
+		0x2d, 0x00, 0x00, 0x00, 0x2b, 0x00, 0x00, 0x00, 0x4c, 0x5a, 0x46, 0x75, 0xf1, 0xc5, 0xc7, 0xa7,
+		0x03, 0x00, 0x0a, 0x00, 0x72, 0x63, 0x70, 0x67, 0x31, 0x32, 0x35, 0x42, 0x32, 0x0a, 0xf3, 0x20,
+		0x68, 0x65, 0x6c, 0x09, 0x00, 0x20, 0x62, 0x77, 0x05, 0xb0, 0x6c, 0x64, 0x7d, 0x0a, 0x80, 0x0f,
+		0xa0,
+	}
+	got, err := DecompressRTF(comp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// testTNEF returns a TNEF with a "Hello" body, and a long.txt attachment.
+func testTNEF() []byte {
+	var buf bytes.Buffer
+	le := func(v any) { _ = binary.Write(&buf, binary.LittleEndian, v) }
+	attr := func(level byte, id uint32, data []byte) {
+		buf.WriteByte(level)
+		le(id)
+		le(uint32(len(data)))
+		buf.Write(data)
+		var sum uint16
+		for _, c := range data {
+			sum += uint16(c)
+		}
+		le(sum)
+	}
+	le(uint32(tnefSignature))
+	le(uint16(0x1234))
+	attr(1, 0x00078008, []byte("IPM.Microsoft Mail.Note\x00"))
+	attr(1, 0x0002800C, []byte("Hello\x00"))
+	attr(2, 0x00069002, make([]byte, 14))
+	attr(2, 0x00018010, []byte("SHORT.TXT\x00"))
+	attr(2, 0x0006800F, []byte("attached text"))
+
+	// MAPI props with the long filename (PT_UNICODE) and the mime type (PT_STRING8)
+	var props bytes.Buffer
+	ple := func(v any) { _ = binary.Write(&props, binary.LittleEndian, v) }
+	ple(uint32(2))
+	ple(uint16(mapiTypeUnicode))
+	ple(uint16(mapiAttachLongFn))
+	ple(uint32(1))
+	name := []byte{'l', 0, 'o', 0, 'n', 0, 'g', 0, '.', 0, 't', 0, 'x', 0, 't', 0, 0, 0}
+	ple(uint32(len(name)))
+	props.Write(name)
+	props.Write([]byte{0, 0}) // padding
+	ple(uint16(mapiTypeString8))
+	ple(uint16(mapiAttachMimeTag))
+	ple(uint32(1))
+	ple(uint32(11))
+	props.WriteString("text/plain\x00\x00")
+	attr(2, 0x00069005, props.Bytes())
+	return buf.Bytes()
+}
+
+func TestDecodeTNEF(t *testing.T) {
+	b := testTNEF()
+	if !IsTNEF(b) {
+		t.Fatal("not TNEF")
+	}
+	tnef, err := DecodeTNEF(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tnef.Body != "Hello" {
+		t.Errorf("got body %q, want Hello", tnef.Body)
+	}
+	if len(tnef.Attachments) != 1 {
+		t.Fatalf("got %d attachments, want 1", len(tnef.Attachments))
+	}
+	a := tnef.Attachments[0]
+	if a.Filename != "long.txt" || a.ContentType != "text/plain" || string(a.Data) != "attached text" {
+		t.Errorf("got %q (%q): %q", a.Filename, a.ContentType, a.Data)
+	}
+}
+
+func TestTNEFTruncated(t *testing.T) {
+	sig := binary.LittleEndian.AppendUint32(nil, tnefSignature)
+	lzfu := func(compSize, rawSize uint32, n int) []byte {
+		b := binary.LittleEndian.AppendUint32(nil, compSize)
+		b = binary.LittleEndian.AppendUint32(b, rawSize)
+		return append(append(b, "LZFu\x00\x00\x00\x00"...), make([]byte, n)...)
+	}
+	for i, b := range [][]byte{
+		sig, append(sig, 0x01),
+		append(sig, 0x01, 0x02, 0x01),
+	} {
+		if _, err := DecodeTNEF(b); err == nil {
+			t.Errorf("%d. DecodeTNEF(%q): no error", i, b)
+		}
+	}
+	for i, b := range [][]byte{
+		lzfu(0, 0, 0), lzfu(11, 0, 4),
+		lzfu(100, 0, 4),
+		lzfu(12, 0xFFFFFFFF, 0),
+		// 8 literals, but only 5 bytes declared
+		lzfu(21, 5, 9),
+	} {
+		if _, err := DecompressRTF(b); err != nil && i == 3 {
+			t.Errorf("%d. DecompressRTF(%q): %+v", i, b, err)
+		} else if err == nil && i != 3 {
+			t.Errorf("%d. DecompressRTF(%q): no error", i, b)
+		}
+	}
+}
+
+func TestTNEFFilterLimits(t *testing.T) {
+	defer func(entries int) { *ConfLimitEntries = entries }(*ConfLimitEntries)
+	for i, tc := range []struct {
+		Entries, WantParts int
+		WantErr            bool
+	}{
+		{Entries: 2, WantParts: 2},
+		{Entries: 1, WantParts: 1, WantErr: true},
+	} {
+		*ConfLimitEntries = tc.Entries
+		body, err := i18nmail.MakeSectionReader(bytes.NewReader(testTNEF()), 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inch, outch := make(chan i18nmail.MailPart, 1), make(chan i18nmail.MailPart, 4)
+		errch := make(chan error, 4)
+		inch <- i18nmail.MailPart{ContentType: "application/ms-tnef", Body: body}
+		close(inch)
+		TNEFFilter(WithExtractLimits(context.Background()), inch, outch, nil, errch)
+		close(errch)
+		var n int
+		for range outch {
+			n++
+		}
+		err = <-errch
+		if n != tc.WantParts || tc.WantErr != errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%d. got %d parts (%v), want %d (%t)", i, n, err, tc.WantParts, tc.WantErr)
+		}
+	}
+}
+
+func FuzzDecodeTNEF(f *testing.F) {
+	f.Add(binary.LittleEndian.AppendUint32(nil, tnefSignature))
+	f.Add(append(binary.LittleEndian.AppendUint32(nil, tnefSignature), 0x34, 0x12, 2, 0x03, 0x90, 0x06, 0, 4, 0, 0, 0, 1, 2, 3, 4, 0, 0))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		_, _ = DecodeTNEF(b)
+	})
+}
+
+func FuzzDecompressRTF(f *testing.F) {
+	f.Add([]byte("\x2d\x00\x00\x00\x2b\x00\x00\x00LZFu\xf1\xc5\xc7\xa7\x03\x00\x0a\x00rcpg125B2\x0a\xf3 hel\x09\x00 bw\x05\xb0ld}\x0a\x80\x0f\xa0"))
+	f.Add([]byte("\x0c\x00\x00\x00\xff\xff\xff\xffMELA\x00\x00\x00\x00"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		_, _ = DecompressRTF(b)
+	})
+}
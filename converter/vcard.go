@@ -0,0 +1,303 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"iter"
+	"mime/quotedprintable"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/tgulacsi/go/text"
+)
+
+// VCard is a parsed vCard (2.1, 3.0 or 4.0).
+type VCard struct {
+	FullName, Name, Org, Title, Birthday, Note string
+	Phones, Emails, Addresses, URLs            []VCardValue
+	// Photo is the embedded photo, PhotoType is its content type.
+	Photo     []byte
+	PhotoType string
+}
+
+// VCardValue is a value with its types (WORK, HOME, CELL...).
+type VCardValue struct {
+	Types []string
+	Value string
+}
+
+// ParseVCards parses all the cards from r.
+func ParseVCards(r io.Reader) ([]VCard, error) {
+	var (
+		cards []VCard
+		card  *VCard
+	)
+	for line := range unfoldVCardLines(r) {
+		name, params, value := parseCalendarLine(line)
+		if i := strings.IndexByte(name, '.'); i >= 0 { // item1.TEL
+			name = name[i+1:]
+		}
+		switch name {
+		case "BEGIN":
+			if strings.EqualFold(value, "VCARD") {
+				cards = append(cards, VCard{})
+				card = &cards[len(cards)-1]
+			}
+			continue
+		case "END":
+			card = nil
+			continue
+		}
+		if card == nil {
+			continue
+		}
+		if name == "PHOTO" {
+			card.Photo, card.PhotoType = decodeVCardPhoto(params, value)
+			continue
+		}
+		value = decodeVCardValue(params, value)
+		switch name {
+		case "FN":
+			card.FullName = unescapeCalendarText(value)
+		case "N":
+			// Family;Given;Additional;Prefix;Suffix
+			f := splitVCardValue(value)
+			for len(f) < 5 {
+				f = append(f, "")
+			}
+			card.Name = joinNonEmpty(" ", f[3], f[1], f[2], f[0], f[4])
+		case "ORG":
+			card.Org = joinNonEmpty(", ", splitVCardValue(value)...)
+		case "TITLE":
+			card.Title = unescapeCalendarText(value)
+		case "BDAY":
+			card.Birthday = value
+		case "NOTE":
+			card.Note = unescapeCalendarText(value)
+		case "TEL":
+			card.Phones = append(card.Phones, VCardValue{Types: vcardTypes(params), Value: strings.TrimPrefix(value, "tel:")})
+		case "EMAIL":
+			card.Emails = append(card.Emails, VCardValue{Types: vcardTypes(params), Value: value})
+		case "URL":
+			card.URLs = append(card.URLs, VCardValue{Types: vcardTypes(params), Value: unescapeCalendarText(value)})
+		case "ADR":
+			// PO box;extended;street;locality;region;postal code;country
+			f := splitVCardValue(value)
+			for len(f) < 7 {
+				f = append(f, "")
+			}
+			adr := joinNonEmpty("\n", f[0], f[1], f[2],
+				joinNonEmpty(" ", f[5], joinNonEmpty(", ", f[3], f[4])), f[6])
+			if adr != "" {
+				card.Addresses = append(card.Addresses, VCardValue{Types: vcardTypes(params), Value: adr})
+			}
+		}
+	}
+	if len(cards) == 0 {
+		return nil, errors.New("no VCARD found")
+	}
+	for i, c := range cards {
+		if c.FullName == "" {
+			cards[i].FullName = c.Name
+		}
+	}
+	return cards, nil
+}
+
+// unfoldVCardLines unfolds the lines, also joining the quoted-printable soft line breaks of vCard 2.1.
+func unfoldVCardLines(r io.Reader) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		var pending string
+		for line := range unfoldCalendarLines(r) {
+			line = pending + line
+			pending = ""
+			if strings.HasSuffix(line, "=") {
+				if i := strings.IndexByte(line, ':'); i >= 0 &&
+					strings.Contains(strings.ToUpper(line[:i]), "QUOTED-PRINTABLE") {
+					pending = line[:len(line)-1]
+					continue
+				}
+			}
+			if !yield(line) {
+				return
+			}
+		}
+		if pending != "" {
+			yield(pending)
+		}
+	}
+}
+
+// decodeVCardValue decodes the quoted-printable and non-UTF-8 values (vCard 2.1).
+func decodeVCardValue(params map[string]string, value string) string {
+	b := []byte(value)
+	if strings.EqualFold(params["ENCODING"], "QUOTED-PRINTABLE") || hasVCardParam(params, "QUOTED-PRINTABLE") {
+		if d, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(value))); err == nil {
+			b = d
+		}
+	}
+	if cs := params["CHARSET"]; cs != "" && !strings.EqualFold(cs, "utf-8") {
+		if enc := text.GetEncoding(cs); enc != nil {
+			if s, err := text.Decode(b, enc); err == nil {
+				return s
+			}
+		}
+	}
+	return string(b)
+}
+
+// decodeVCardPhoto returns the embedded photo - the data: URI (4.0) or the base64 encoded (2.1, 3.0) one.
+func decodeVCardPhoto(params map[string]string, value string) ([]byte, string) {
+	var typ string
+	if rest, ok := strings.CutPrefix(value, "data:"); ok {
+		meta, data, _ := strings.Cut(rest, ",")
+		typ, _, _ = strings.Cut(meta, ";")
+		if !strings.HasSuffix(meta, ";base64") {
+			return nil, ""
+		}
+		value = data
+	} else if enc := strings.ToUpper(params["ENCODING"]); enc != "B" && enc != "BASE64" && !hasVCardParam(params, "BASE64") {
+		return nil, "" // URI
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil || len(b) == 0 {
+		return nil, ""
+	}
+	if !strings.HasPrefix(typ, "image/") {
+		typ = http.DetectContentType(b)
+	}
+	if !strings.HasPrefix(typ, "image/") {
+		return nil, ""
+	}
+	return b, typ
+}
+
+// hasVCardParam reports whether the vCard 2.1 style, value-less param (TEL;WORK;VOICE:) is present.
+func hasVCardParam(params map[string]string, name string) bool {
+	v, ok := params[name]
+	return ok && v == ""
+}
+
+// vcardTypes returns the TYPE=a,b and the vCard 2.1 style types, lowercased.
+func vcardTypes(params map[string]string) []string {
+	var types []string
+	for k, v := range params {
+		switch {
+		case k == "TYPE":
+			for _, t := range strings.Split(v, ",") {
+				types = append(types, strings.ToLower(t))
+			}
+		case v == "" && k != "QUOTED-PRINTABLE" && k != "BASE64":
+			types = append(types, strings.ToLower(k))
+		}
+	}
+	sort.Strings(types) // map iteration order is random
+	return types
+}
+
+// splitVCardValue splits the structured value at the unescaped semicolons, and unescapes the fields.
+func splitVCardValue(value string) []string {
+	var (
+		fields []string
+		start  int
+	)
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ';':
+			fields = append(fields, unescapeCalendarText(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(fields, unescapeCalendarText(value[start:]))
+}
+
+func joinNonEmpty(sep string, ss ...string) string {
+	var buf strings.Builder
+	for _, s := range ss {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if buf.Len() != 0 {
+			buf.WriteString(sep)
+		}
+		buf.WriteString(s)
+	}
+	return buf.String()
+}
+
+var vcardTemplate = template.Must(template.New("vcard").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8">
+<style>
+body { font-family: sans-serif; }
+.card { border: 1px solid #999; border-radius: 8px; padding: 1em; margin-bottom: 1em; page-break-inside: avoid; overflow: hidden; }
+.card img { float: right; max-width: 120px; max-height: 160px; margin-left: 1em; }
+.card h2 { margin: 0; }
+.card .org { color: #555; margin-bottom: 0.5em; }
+th { text-align: left; vertical-align: top; padding-right: 1em; font-weight: normal; color: #555; }
+td { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+{{range .}}<div class="card">
+{{if .PhotoURL}}<img src="{{.PhotoURL}}">{{end}}
+<h2>{{.FullName}}</h2>
+{{if or .Title .Org}}<div class="org">{{.Title}}{{if and .Title .Org}}, {{end}}{{.Org}}</div>{{end}}
+<table>
+{{range .Phones}}<tr><th>Phone{{if .Types}} ({{join .Types ", "}}){{end}}</th><td>{{.Value}}</td></tr>
+{{end}}{{range .Emails}}<tr><th>E-mail{{if .Types}} ({{join .Types ", "}}){{end}}</th><td>{{.Value}}</td></tr>
+{{end}}{{range .Addresses}}<tr><th>Address{{if .Types}} ({{join .Types ", "}}){{end}}</th><td>{{.Value}}</td></tr>
+{{end}}{{range .URLs}}<tr><th>Web</th><td>{{.Value}}</td></tr>
+{{end}}{{if .Birthday}}<tr><th>Birthday</th><td>{{.Birthday}}</td></tr>
+{{end}}{{if .Note}}<tr><th>Note</th><td>{{.Note}}</td></tr>
+{{end}}</table>
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+type vcardView struct {
+	VCard
+	PhotoURL template.URL
+}
+
+// WriteVCardHTML renders the cards as HTML.
+func WriteVCardHTML(w io.Writer, cards []VCard) error {
+	views := make([]vcardView, len(cards))
+	for i, c := range cards {
+		views[i].VCard = c
+		if len(c.Photo) != 0 {
+			// the data is ours, and the type is an image/ one
+			views[i].PhotoURL = template.URL("data:" + c.PhotoType + ";base64," + base64.StdEncoding.EncodeToString(c.Photo))
+		}
+	}
+	return vcardTemplate.Execute(w, views)
+}
+
+// VCardToPdf converts vCard (text/vcard) contacts to PDF.
+func VCardToPdf(ctx context.Context, destfn string, r io.Reader, contentType string) error {
+	cards, err := ParseVCards(r)
+	if err != nil {
+		return fmt.Errorf("parse vCard: %w", err)
+	}
+	var buf bytes.Buffer
+	if err = WriteVCardHTML(&buf, cards); err != nil {
+		return err
+	}
+	return HTMLToPdf(ctx, destfn, &buf, textHtml)
+}
@@ -0,0 +1,70 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseVCards(t *testing.T) {
+	gif := base64.StdEncoding.EncodeToString([]byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"))
+	src := "BEGIN:VCARD\r\nVERSION:2.1\r\n" +
+		"N;CHARSET=ISO-8859-2;ENCODING=QUOTED-PRINTABLE:Kov=E1cs;=C1rp=\r\n=E1d;;Dr.;\r\n" +
+		"TEL;WORK;VOICE:+36 1 234 5678\r\n" +
+		"ADR;HOME;ENCODING=QUOTED-PRINTABLE:;;F=C5=91 utca 1.;Budapest;;1011;Hungary\r\n" +
+		"END:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Jane Doe\r\nORG:Example\\, Inc.;R&D\r\n" +
+		"EMAIL;TYPE=INTERNET,WORK:jane@example.com\r\n" +
+		"PHOTO;ENCODING=b;TYPE=GIF:" + gif[:10] + "\r\n " + gif[10:] + "\r\n" +
+		"NOTE:first line\\nsecond line\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nFN:John <Doe>\r\n" +
+		"item1.TEL;VALUE=uri;TYPE=\"cell,voice\":tel:+1-555-0100\r\n" +
+		"PHOTO:data:image/png;base64,iVBORw0K\r\n" +
+		"URL:https://example.com/\r\nEND:VCARD\r\n"
+
+	cards, err := ParseVCards(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 3 {
+		t.Fatalf("got %d cards, want 3", len(cards))
+	}
+	for i, tc := range []struct {
+		Got, Want any
+	}{
+		{cards[0].FullName, "Dr. Árpád Kovács"},
+		{cards[0].Phones, []VCardValue{{Types: []string{"voice", "work"}, Value: "+36 1 234 5678"}}},
+		{cards[0].Addresses, []VCardValue{{Types: []string{"home"}, Value: "Fő utca 1.\n1011 Budapest\nHungary"}}},
+		{cards[1].Org, "Example, Inc., R&D"},
+		{cards[1].Emails, []VCardValue{{Types: []string{"internet", "work"}, Value: "jane@example.com"}}},
+		{cards[1].PhotoType, "image/gif"},
+		{cards[1].Note, "first line\nsecond line"},
+		{cards[2].Phones, []VCardValue{{Types: []string{"cell", "voice"}, Value: "+1-555-0100"}}},
+		{cards[2].PhotoType, "image/png"},
+	} {
+		if !reflect.DeepEqual(tc.Got, tc.Want) {
+			t.Errorf("%d. got %q, want %q", i, tc.Got, tc.Want)
+		}
+	}
+
+	var buf strings.Builder
+	if err = WriteVCardHTML(&buf, cards); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for i, want := range []string{
+		"<h2>Dr. Árpád Kovács</h2>",
+		"John &lt;Doe&gt;",
+		`<img src="data:image/gif;base64,` + gif + `">`,
+		"Phone (voice, work)",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("%d. %q not found in\n%s", i, want, html)
+		}
+	}
+}
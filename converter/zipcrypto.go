@@ -0,0 +1,247 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// errZipPassword is returned by readZipFile for a bad password.
+var errZipPassword = errors.New("bad password")
+
+// zipEncrypted reports whether any file of the ZIP is encrypted.
+func zipEncrypted(zr *zip.Reader) bool {
+	for _, f := range zr.File {
+		if f.Flags&0x1 != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// readZipFile reads the content of the (possibly encrypted) file of the ZIP with read,
+// decrypted with the password (traditional PKWARE or WinZip AES encryption).
+//
+// The file is decrypted (and decompressed) while read reads it, so its limits apply;
+// but the content is authentic only if readZipFile returns no error.
+func readZipFile(f *zip.File, password string, read func(io.Reader) error) error {
+	if f.Flags&0x1 == 0 {
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return read(rc)
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+	var r io.Reader
+	var ar *zipAESReader
+	method, checkCRC := f.Method, true
+	if f.Method == 99 {
+		if ar, method, checkCRC, err = newZipAESReader(f, raw, password); err != nil {
+			return err
+		}
+		r = ar
+	} else if r, err = newZipCryptoReader(f, raw, password); err != nil {
+		return err
+	}
+
+	switch method {
+	case zip.Store:
+	case zip.Deflate:
+		fr := flate.NewReader(r)
+		defer fr.Close()
+		r = fr
+	default:
+		return fmt.Errorf("%s: %w", f.Name, zip.ErrAlgorithm)
+	}
+	crc := crc32.NewIEEE()
+	err = read(io.TeeReader(r, crc))
+	if errors.Is(err, ErrLimitExceeded) {
+		return err
+	} else if err != nil {
+		// a bad password may pass the one-byte check of the traditional encryption
+		return fmt.Errorf("%s: %w: %w", f.Name, errZipPassword, err)
+	}
+	if ar != nil {
+		if err = ar.verify(); err != nil {
+			return fmt.Errorf("%s: %w: %w", f.Name, errZipPassword, err)
+		}
+	}
+	if checkCRC && crc.Sum32() != f.CRC32 {
+		return fmt.Errorf("%s: %w: %w", f.Name, errZipPassword, zip.ErrChecksum)
+	}
+	return nil
+}
+
+// zipCryptoReader decrypts the traditional PKWARE encryption.
+type zipCryptoReader struct {
+	r    io.Reader
+	keys [3]uint32
+}
+
+// newZipCryptoReader reads and checks the encryption header of the file, and returns the decrypting reader of the rest.
+func newZipCryptoReader(f *zip.File, raw io.Reader, password string) (*zipCryptoReader, error) {
+	zr := &zipCryptoReader{r: raw, keys: [3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for _, c := range []byte(password) {
+		zr.update(c)
+	}
+	var hdr [12]byte
+	if _, err := io.ReadFull(zr, hdr[:]); err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", f.Name, zip.ErrFormat, err)
+	}
+	// the last byte of the 12 bytes encryption header is a check byte
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&0x8 != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if hdr[11] != check {
+		return nil, fmt.Errorf("%s: %w", f.Name, errZipPassword)
+	}
+	return zr, nil
+}
+
+func (zr *zipCryptoReader) update(c byte) {
+	zr.keys[0] = crc32.IEEETable[byte(zr.keys[0])^c] ^ (zr.keys[0] >> 8)
+	zr.keys[1] = (zr.keys[1]+zr.keys[0]&0xff)*134775813 + 1
+	zr.keys[2] = crc32.IEEETable[byte(zr.keys[2])^byte(zr.keys[1]>>24)] ^ (zr.keys[2] >> 8)
+}
+
+func (zr *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := zr.r.Read(p)
+	for i, c := range p[:n] {
+		t := zr.keys[2] | 2
+		p[i] = c ^ byte((t*(t^1))>>8)
+		zr.update(p[i])
+	}
+	return n, err
+}
+
+// zipAESReader decrypts the WinZip AES encryption, computing the authentication code of the encrypted data.
+type zipAESReader struct {
+	raw, r io.Reader
+	mac    hash.Hash
+	ctr    *zipAESCTR
+}
+
+// newZipAESReader reads the salt and the password verifier of the file, and returns the decrypting reader of the rest,
+// the real compression method, and whether the CRC is to be checked (AE-1).
+func newZipAESReader(f *zip.File, raw io.Reader, password string) (*zipAESReader, uint16, bool, error) {
+	// the 0x9901 extra field: version, vendor ID ("AE"), strength, compression method
+	var extra []byte
+	for b := f.Extra; len(b) >= 4; {
+		tag, size := binary.LittleEndian.Uint16(b), int(binary.LittleEndian.Uint16(b[2:]))
+		if len(b) < 4+size {
+			break
+		}
+		if tag == 0x9901 && size >= 7 {
+			extra = b[4 : 4+size]
+			break
+		}
+		b = b[4+size:]
+	}
+	if extra == nil {
+		return nil, 0, false, fmt.Errorf("%s: no AES extra field: %w", f.Name, zip.ErrFormat)
+	}
+	version, method := binary.LittleEndian.Uint16(extra), binary.LittleEndian.Uint16(extra[5:])
+	var keyLen int
+	switch extra[4] {
+	case 1:
+		keyLen = 16
+	case 2:
+		keyLen = 24
+	case 3:
+		keyLen = 32
+	default:
+		return nil, 0, false, fmt.Errorf("%s: unknown AES strength %d: %w", f.Name, extra[4], zip.ErrFormat)
+	}
+	saltLen := keyLen / 2
+	if f.CompressedSize64 < uint64(saltLen+2+10) {
+		return nil, 0, false, fmt.Errorf("%s: %w", f.Name, zip.ErrFormat)
+	}
+	head := make([]byte, saltLen+2)
+	if _, err := io.ReadFull(raw, head); err != nil {
+		return nil, 0, false, fmt.Errorf("%s: %w: %w", f.Name, zip.ErrFormat, err)
+	}
+	salt, verifier := head[:saltLen], head[saltLen:]
+
+	key, err := pbkdf2.Key(sha1.New, password, salt, 1000, 2*keyLen+2)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if !bytes.Equal(key[2*keyLen:], verifier) {
+		return nil, 0, false, fmt.Errorf("%s: %w", f.Name, errZipPassword)
+	}
+	block, err := aes.NewCipher(key[:keyLen])
+	if err != nil {
+		return nil, 0, false, err
+	}
+	ar := &zipAESReader{
+		raw: raw, r: io.LimitReader(raw, int64(f.CompressedSize64)-int64(saltLen+2+10)),
+		mac: hmac.New(sha1.New, key[keyLen:2*keyLen]),
+		ctr: &zipAESCTR{block: block},
+	}
+	// AE-2 does not store the CRC
+	return ar, method, version == 1, nil
+}
+
+func (ar *zipAESReader) Read(p []byte) (int, error) {
+	n, err := ar.r.Read(p)
+	ar.mac.Write(p[:n])
+	ar.ctr.XORKeyStream(p[:n], p[:n])
+	return n, err
+}
+
+// verify reads the rest of the encrypted data (the decompressor may stop before its end),
+// and checks the authentication code following it.
+func (ar *zipAESReader) verify() error {
+	if _, err := io.Copy(io.Discard, ar); err != nil {
+		return err
+	}
+	var mac [10]byte
+	if _, err := io.ReadFull(ar.raw, mac[:]); err != nil {
+		return fmt.Errorf("%w: %w", zip.ErrFormat, err)
+	}
+	if !hmac.Equal(ar.mac.Sum(nil)[:10], mac[:]) {
+		return errors.New("authentication failed")
+	}
+	return nil
+}
+
+// zipAESCTR is the CTR mode of WinZip AES: with a little endian counter, starting from 1.
+type zipAESCTR struct {
+	block       cipher.Block
+	ctr, stream [aes.BlockSize]byte
+	n           uint64
+	pos         int
+}
+
+func (c *zipAESCTR) XORKeyStream(dst, src []byte) {
+	for i, b := range src {
+		if c.pos == 0 {
+			c.n++
+			binary.LittleEndian.PutUint64(c.ctr[:], c.n)
+			c.block.Encrypt(c.stream[:], c.ctr[:])
+		}
+		dst[i] = b ^ c.stream[c.pos]
+		c.pos = (c.pos + 1) % aes.BlockSize
+	}
+}
@@ -1,4 +1,4 @@
-// Copyright 2017, 2022 The Agostle Authors. All rights reserved.
+// Copyright 2017, 2026 The Agostle Authors. All rights reserved.
 // Use of this source code is governed by an Apache 2.0
 // license that can be found in the LICENSE file.
 
@@ -9,6 +9,7 @@ package main
 
 import (
 	"archive/zip"
+	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -44,7 +45,12 @@ var emailConvertServer = kithttp.NewServer(
 type convertParams struct {
 	ContentType, OutImg, ImgSize string
 	Pages                        []uint16
-	Splitted, Merged             bool
+	Splitted, Merged, Cover      bool
+	Header                       converter.HeaderOptions
+	// RawHeaders is the raw headers appendix: converter.RawHeadersTop, RawHeadersAll or none.
+	RawHeaders string
+	// Passwords of the encrypted archives - only their hash goes into String.
+	Passwords []string `json:"-"`
 }
 
 func (p convertParams) String() string {
@@ -91,6 +97,22 @@ func (p convertParams) String() string {
 			buf.Write(b)
 		}
 	}
+	if p.Cover {
+		buf.WriteString("_c")
+	}
+	if p.RawHeaders != "" {
+		buf.WriteString("_r")
+		buf.WriteString(p.RawHeaders)
+	}
+	if !p.Header.IsZero() {
+		buf.WriteString("_h")
+		w64(p.Header.String())
+	}
+	if len(p.Passwords) != 0 {
+		buf.WriteString("_p")
+		sum := sha256.Sum256([]byte(strings.Join(p.Passwords, "\x00")))
+		w64(string(sum[:6]))
+	}
 	return buf.String()
 }
 
@@ -101,6 +123,8 @@ type emailConvertRequest struct {
 	Input       reqFile
 	IfNoneMatch []string
 	r           *http.Request
+	// Stream the results as multipart/mixed, as soon as they are ready.
+	Stream bool
 }
 
 func emailConvertDecode(ctx context.Context, r *http.Request) (any, error) {
@@ -110,29 +134,27 @@ func emailConvertDecode(ctx context.Context, r *http.Request) (any, error) {
 	if r.MultipartForm != nil {
 		defer func() { _ = r.MultipartForm.RemoveAll() }()
 	}
-	req := emailConvertRequest{r: r, Params: convertParams{
-		OutImg:  r.Form.Get("outimg"),
-		ImgSize: r.Form.Get("imgsize"),
-		Pages:   parseUint16s(r.Form["page"]),
-		Merged:  r.Form.Get("merged") == "1" || r.Header.Get("Accept") == "application/pdf",
-	}}
-	req.Params.Splitted = len(req.Params.Pages) != 0 || r.Form.Get("splitted") == "1"
-	if req.Params.ImgSize == "" {
-		req.Params.ImgSize = defaultImageSize
-	} else if strings.IndexByte(req.Params.ImgSize, 'x') < 0 {
-		req.Params.ImgSize += "x" + req.Params.ImgSize
+	inp, err := getOneRequestFile(ctx, r)
+	if err != nil {
+		return nil, err
 	}
-	for _, a := range r.Header["Accept"] {
-		if strings.HasPrefix(a, "image/") {
-			req.Params.OutImg = a
+	return newEmailConvertRequest(ctx, r, inp), nil
+}
+
+// newEmailConvertRequest returns the request for converting inp,
+// with the parameters read from the (already parsed) r.Form.
+func newEmailConvertRequest(ctx context.Context, r *http.Request, inp reqFile) emailConvertRequest {
+	req := emailConvertRequest{r: r, Input: inp, Params: getConvertParams(r)}
+	for _, a := range r.Header.Values("Accept") {
+		if strings.HasPrefix(a, "multipart/mixed") {
+			req.Stream = true
 			break
 		}
 	}
-	inp, err := getOneRequestFile(ctx, r)
-	if err != nil {
-		return nil, err
+	if req.Stream && r.Form.Get("cover") != "1" {
+		// the streamed parts are not merged, so the cover-page default does not apply
+		req.Params.Cover = false
 	}
-	req.Input = inp
 	getLogger(ctx).Info("emailConvertDecode", "input", req.Input)
 	contentType := req.Input.Header.Get("Content-Type")
 	if contentType == "" || contentType == "application/octet-stream" {
@@ -151,13 +173,61 @@ func emailConvertDecode(ctx context.Context, r *http.Request) (any, error) {
 		}
 	}
 
-	return req, nil
+	return req
+}
+
+// getConvertParams returns the conversion parameters (without ContentType) from r.Form.
+func getConvertParams(r *http.Request) convertParams {
+	params := convertParams{
+		Pages:  parseUint16s(r.Form["page"]),
+		Merged: r.Form.Get("merged") == "1" || r.Header.Get("Accept") == "application/pdf",
+	}
+	params.Splitted = len(params.Pages) != 0 || r.Form.Get("splitted") == "1"
+	params.OutImg, params.ImgSize = getImageParams(r)
+	params.Header = getHeaderOptions(r)
+	params.Cover = r.Form.Get("cover") == "1" || *converter.ConfCoverPage && r.Form.Get("cover") != "0"
+	params.RawHeaders = getRawHeaders(r.Form.Get("rawheaders"))
+	params.Passwords = r.Form["password"]
+	return params
+}
+
+// getRawHeaders returns the raw headers appendix mode of the rawheaders form value
+// (top or 1, all, 0 to switch off), ConfRawHeaders by default.
+func getRawHeaders(s string) string {
+	switch s {
+	case "":
+		return *converter.ConfRawHeaders
+	case "1", converter.RawHeadersTop:
+		return converter.RawHeadersTop
+	case converter.RawHeadersAll:
+		return converter.RawHeadersAll
+	}
+	return ""
+}
+
+// getHeaderOptions returns the options of the header block printed before the mail body,
+// from the header (0 to switch off, 1 to switch on), headers and lang form values.
+func getHeaderOptions(r *http.Request) converter.HeaderOptions {
+	opts := converter.HeaderOptions{
+		Headers: converter.ParseHeaderList(strings.Join(r.Form["headers"], ",")),
+		Lang:    r.Form.Get("lang"),
+	}
+	switch r.Form.Get("header") {
+	case "0":
+		opts.Disabled = new(true)
+	case "1":
+		opts.Disabled = new(false)
+	}
+	return opts
 }
 
 func emailConvertEP(ctx context.Context, request any) (response any, err error) {
 	logger := getLogger(ctx).With("f", "emailConvertEP")
 	req := request.(emailConvertRequest)
 	defer func() { _ = req.Input.Close() }()
+	ctx = converter.WithCoverPage(converter.WithHeaderOptions(ctx, req.Params.Header), req.Params.Cover)
+	ctx = converter.WithRawHeaders(ctx, req.Params.RawHeaders)
+	ctx = converter.WithExtractLimits(converter.WithArchivePasswords(ctx, req.Params.Passwords))
 
 	getOutFn := func(params convertParams, hsh string) string {
 		return filepath.Join(converter.Workdir,
@@ -242,8 +312,19 @@ func emailConvertEP(ctx context.Context, request any) (response any, err error)
 	resp.outFn = getOutFn(req.Params, hsh)
 	var head [1024]byte
 	n, _ := sr.ReadAt(head[:], 0)
-	req.Params.ContentType = converter.FixContentType(head[:n], req.Params.ContentType, req.Input.Filename)
+	if isMboxInput(req.Params.ContentType, req.Input.Filename) {
+		req.Params.ContentType = converter.ApplicationMbox
+	} else {
+		req.Params.ContentType = converter.FixContentType(head[:n], req.Params.ContentType, req.Input.Filename)
+	}
 	logger.Info("fixed", "params", req.Params)
+	if req.Stream && req.Params.ContentType != converter.ApplicationMbox {
+		if req.Params.Cover {
+			return resp, httpError{Code: http.StatusBadRequest,
+				Err: errors.New("the streaming (multipart/mixed) response has no cover page")}
+		}
+		return mailStreamResponse{Params: req.Params, input: sr}, nil
+	}
 	if fh, err := getCached(req.Params, hsh); err == nil {
 		resp.outFn, resp.content = fh.Name(), fh
 		logger.Info("use cached", "file", resp.outFn)
@@ -251,7 +332,14 @@ func emailConvertEP(ctx context.Context, request any) (response any, err error)
 		return resp, err
 	}
 	input := io.NewSectionReader(sr, 0, sr.Size())
-	if !req.Params.Splitted && req.Params.OutImg == "" {
+	if req.Params.ContentType == converter.ApplicationMbox {
+		err = converter.MboxToPdfZip(ctx, resp.outFn, input,
+			req.Params.Splitted, req.Params.OutImg, req.Params.ImgSize, req.Params.Pages)
+		logger.Info("MboxToPdfZip from", "from", input, "out", resp.outFn, "params", req.Params, "error", err)
+		if err == nil {
+			err = resp.mergeIfRequested(ctx, req.Params)
+		}
+	} else if !req.Params.Splitted && req.Params.OutImg == "" {
 		err = converter.MailToPdfZip(ctx, resp.outFn, input, req.Params.ContentType)
 		logger.Info("MailToPdfZip from", "from", input, "out", resp.outFn, "params", req.Params, "error", err)
 		if err == nil {
@@ -290,6 +378,9 @@ type emailConvertResponse struct {
 
 func emailConvertEncode(ctx context.Context, w http.ResponseWriter, response any) error {
 	logger := getLogger(ctx)
+	if resp, ok := response.(mailStreamResponse); ok {
+		return mailStreamEncode(ctx, w, resp)
+	}
 	resp, ok := response.(emailConvertResponse)
 	if !ok {
 		return fmt.Errorf("wanted emailConvertResponse, got %T", response)
@@ -389,6 +480,34 @@ func (resp *emailConvertResponse) mergeIfRequested(ctx context.Context, params c
 	return nil
 }
 
+// isMboxInput reports whether the input is an mbox file - by its content type or extension.
+//
+// The content is not sniffed: a single mail may start with a "From " line, too.
+func isMboxInput(contentType, fileName string) bool {
+	if ct, _, _ := strings.Cut(contentType, ";"); ct == converter.ApplicationMbox {
+		return true
+	}
+	return strings.EqualFold(filepath.Ext(fileName), ".mbox")
+}
+
+// getImageParams returns the requested image mime type and size,
+// from the outimg and imgsize form values, or the Accept header.
+func getImageParams(r *http.Request) (outImg, imgSize string) {
+	outImg, imgSize = r.Form.Get("outimg"), r.Form.Get("imgsize")
+	if imgSize == "" {
+		imgSize = defaultImageSize
+	} else if strings.IndexByte(imgSize, 'x') < 0 {
+		imgSize += "x" + imgSize
+	}
+	for _, a := range r.Header["Accept"] {
+		if strings.HasPrefix(a, "image/") {
+			outImg = a
+			break
+		}
+	}
+	return outImg, imgSize
+}
+
 func parseUint16s(ss []string) []uint16 {
 	us := make([]uint16, 0, len(ss))
 	for _, s := range ss {
@@ -0,0 +1,390 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UNO-SOFT/zlog/v2"
+	"github.com/google/renameio"
+	"github.com/rogpeppe/retry"
+	"github.com/tgulacsi/agostle/converter"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// Asynchronous job states.
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+var jobSubmitServer = kithttp.NewServer(
+	jobSubmitEP,
+	jobSubmitDecode,
+	jobSubmitEncode,
+	kithttp.ServerBefore(defaultBeforeFuncs...),
+	kithttp.ServerAfter(kithttp.SetContentType("application/json")),
+)
+
+var jobServer = kithttp.NewServer(
+	jobEP,
+	jobDecode,
+	jobEncode,
+	kithttp.ServerBefore(defaultBeforeFuncs...),
+)
+
+type job struct {
+	Created, Started, Finished time.Time
+	ID, State                  string
+	Error                      string               `json:",omitempty"`
+	Result                     string               `json:",omitempty"`
+	Parts                      []converter.PartInfo `json:",omitempty"`
+
+	resultFn, contentType string
+	// owner is the identity which submitted the job, the only one who sees it
+	owner string
+	mu    sync.Mutex
+}
+
+// progress records the state of a part.
+func (j *job) progress(info converter.PartInfo) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, p := range j.Parts {
+		if p.Level == info.Level && p.Seq == info.Seq && p.ContentType == info.ContentType {
+			j.Parts[i] = info
+			return
+		}
+	}
+	j.Parts = append(j.Parts, info)
+}
+
+func (j *job) setState(state string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.State = state
+	switch state {
+	case jobRunning:
+		j.Started = time.Now()
+	case jobDone, jobFailed:
+		j.Finished = time.Now()
+	}
+	if err != nil {
+		j.Error = err.Error()
+	}
+}
+
+// snapshot returns a copy of the job, safe to be marshaled.
+func (j *job) snapshot() *job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return &job{
+		ID: j.ID, State: j.State, Error: j.Error, Result: j.Result,
+		Created: j.Created, Started: j.Started, Finished: j.Finished,
+		Parts:    append([]converter.PartInfo(nil), j.Parts...),
+		resultFn: j.resultFn, contentType: j.contentType, owner: j.owner,
+	}
+}
+
+type jobStore struct {
+	jobs map[string]*job
+	mu   sync.Mutex
+}
+
+var jobs = jobStore{jobs: make(map[string]*job)}
+
+func (s *jobStore) Get(id string) *job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+func (s *jobStore) Add(j *job) {
+	s.mu.Lock()
+	s.jobs[j.ID] = j
+	s.mu.Unlock()
+}
+
+// Sweep removes the jobs finished before threshold, with their results.
+func (s *jobStore) Sweep(threshold time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, j := range s.jobs {
+		j.mu.Lock()
+		old := !j.Finished.IsZero() && j.Finished.Before(threshold)
+		fn := j.resultFn
+		j.mu.Unlock()
+		if !old {
+			continue
+		}
+		logger.Info("Remove", "job", id, "file", fn)
+		if fn != "" {
+			_ = os.Remove(fn)
+		}
+		delete(s.jobs, id)
+	}
+}
+
+type jobSubmitRequest struct {
+	emailConvertRequest
+}
+
+func jobSubmitDecode(ctx context.Context, r *http.Request) (any, error) {
+	if r.Method != "POST" {
+		return nil, httpError{Code: http.StatusMethodNotAllowed, Err: errors.New("POST is required")}
+	}
+	request, err := emailConvertDecode(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	req := request.(emailConvertRequest)
+	req.IfNoneMatch, req.Stream = nil, false
+	if r.Form.Get("kind") == "convert" {
+		if ct := req.Input.Header.Get("Content-Type"); ct == "" || ct == "application/octet-stream" {
+			req.Params.ContentType = ""
+		}
+	}
+	return jobSubmitRequest{emailConvertRequest: req}, nil
+}
+
+// jobSubmitEP saves the input and starts the conversion in the background.
+func jobSubmitEP(ctx context.Context, request any) (response any, err error) {
+	req := request.(jobSubmitRequest)
+	defer func() { _ = req.Input.Close() }()
+	j := &job{ID: converter.NewULID().String(), State: jobQueued, Created: time.Now(), owner: getIdentity(ctx)}
+	j.Result = "/jobs/" + j.ID + "/result"
+	logger := getLogger(ctx).With("job", j.ID)
+
+	inp, err := readerToFile(io.LimitReader(req.Input, converter.MaxSize+1), req.Input.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("save input: %w", err)
+	}
+	if size, err := inp.Seek(0, io.SeekEnd); err != nil || size > converter.MaxSize {
+		_ = inp.Cleanup()
+		if err != nil {
+			return nil, fmt.Errorf("save input: %w", err)
+		}
+		return nil, httpError{Code: http.StatusRequestEntityTooLarge,
+			Err: fmt.Errorf("input is bigger than %d bytes", converter.MaxSize)}
+	}
+	if _, err = inp.Seek(0, io.SeekStart); err != nil {
+		_ = inp.Cleanup()
+		return nil, fmt.Errorf("save input: %w", err)
+	}
+	ecr := req.emailConvertRequest
+	ecr.Input = reqFile{ReadCloser: inp, FileHeader: req.Input.FileHeader}
+	ecr.r = nil
+	jobs.Add(j)
+
+	// the request's context (and its workdir) ends with the request
+	jctx := zlog.NewSContext(context.Background(), logger)
+	jctx = converter.SetRequestID(jctx, j.ID)
+	jctx, wd := converter.PrepareContext(jctx, "job-"+j.ID)
+	jctx = converter.WithProgress(jctx, j.progress)
+	snap := j.snapshot()
+	go func() {
+		jctx, cancel := context.WithTimeout(jctx, *converter.ConfJobTimeout)
+		defer cancel()
+		defer func() {
+			_ = inp.Cleanup()
+			_ = os.RemoveAll(wd)
+		}()
+		// wait in the admission queue as long as needed
+		release, err := getAdmission().acquire(jctx, 0)
+		if err != nil {
+			j.setState(jobFailed, err)
+			return
+		}
+		defer release()
+		j.setState(jobRunning, nil)
+		err = runJob(jctx, j, ecr)
+		logger.Info("job finished", "error", err)
+		if err != nil {
+			j.setState(jobFailed, err)
+		} else {
+			j.setState(jobDone, nil)
+		}
+	}()
+	return snap, nil
+}
+
+// runJob runs the conversion and saves the result as the job's result file.
+func runJob(ctx context.Context, j *job, req emailConvertRequest) error {
+	response, err := emailConvertEP(ctx, req)
+	resp, _ := response.(emailConvertResponse)
+	if resp.outFn != "" {
+		defer os.Remove(resp.outFn)
+	}
+	if err != nil {
+		if resp.content != nil {
+			_ = resp.content.Close()
+		}
+		return err
+	}
+	var content io.ReadCloser = resp.content
+	if content == nil {
+		if content, err = os.Open(resp.outFn); err != nil {
+			return err
+		}
+	}
+	defer content.Close()
+
+	ext, contentType := ".zip", "application/zip"
+	if req.Params.Merged {
+		ext, contentType = ".pdf", "application/pdf"
+	}
+	fn := filepath.Join(converter.Workdir, "job-"+j.ID+ext)
+	fh, err := renameio.TempFile("", fn)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fh.Cleanup() }()
+	if _, err = io.Copy(fh, content); err != nil {
+		return err
+	}
+	if err = fh.CloseAtomicallyReplace(); err != nil {
+		return err
+	}
+	j.mu.Lock()
+	j.resultFn, j.contentType = fn, contentType
+	j.mu.Unlock()
+	return nil
+}
+
+type jobRequest struct {
+	ID     string
+	Result bool
+	r      *http.Request
+}
+
+func jobDecode(ctx context.Context, r *http.Request) (any, error) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return nil, httpError{Code: http.StatusMethodNotAllowed, Err: errors.New("GET is required")}
+	}
+	id, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	switch rest {
+	case "":
+		return jobRequest{ID: id, r: r}, nil
+	case "result":
+		return jobRequest{ID: id, Result: true, r: r}, nil
+	}
+	return nil, httpError{Code: http.StatusNotFound, Err: fmt.Errorf("unknown path %q", r.URL.Path)}
+}
+
+func jobEP(ctx context.Context, request any) (response any, err error) {
+	req := request.(jobRequest)
+	j := jobs.Get(req.ID)
+	// the jobs of the others do not exist for the caller
+	if j == nil || j.owner != getIdentity(ctx) {
+		return nil, httpError{Code: http.StatusNotFound, Err: fmt.Errorf("no such job %q", req.ID)}
+	}
+	snap := j.snapshot()
+	if !req.Result {
+		return snap, nil
+	}
+	switch snap.State {
+	case jobDone:
+	case jobFailed:
+		return nil, httpError{Code: http.StatusUnprocessableEntity, Err: fmt.Errorf("job %s failed: %s", snap.ID, snap.Error)}
+	default:
+		return nil, httpError{Code: http.StatusConflict, Err: fmt.Errorf("job %s is %s", snap.ID, snap.State)}
+	}
+	fh, err := os.Open(snap.resultFn)
+	if err != nil {
+		return nil, err
+	}
+	return jobResultResponse{job: snap, content: fh, r: req.r}, nil
+}
+
+type jobResultResponse struct {
+	job     *job
+	content *os.File
+	r       *http.Request
+}
+
+func jobEncode(ctx context.Context, w http.ResponseWriter, response any) error {
+	if resp, ok := response.(jobResultResponse); ok {
+		defer resp.content.Close()
+		w.Header().Set("Content-Type", resp.job.contentType)
+		http.ServeContent(w, resp.r, filepath.Base(resp.job.resultFn), resp.job.Finished, resp.content)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return jobStatusEncode(ctx, w, response)
+}
+
+func jobStatusEncode(ctx context.Context, w http.ResponseWriter, response any) error {
+	j, ok := response.(*job)
+	if !ok {
+		return fmt.Errorf("wanted *job, got %T", response)
+	}
+	return json.NewEncoder(w).Encode(j)
+}
+
+func jobSubmitEncode(ctx context.Context, w http.ResponseWriter, response any) error {
+	j, ok := response.(*job)
+	if !ok {
+		return fmt.Errorf("wanted *job, got %T", response)
+	}
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	w.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(w).Encode(j)
+}
+
+// sweepResults removes the result-*.zip and the job-* (job result) files, and the finished jobs
+// older than ConfResultRetention.
+func sweepResults(ctx context.Context) {
+	retention := *converter.ConfResultRetention
+	if retention <= 0 {
+		retention = time.Hour
+	}
+	strategy := retry.Strategy{Delay: min(5*time.Minute, retention)}
+	var iter *retry.Iter
+	for {
+		threshold := time.Now().Add(-retention)
+		wd := converter.Workdir
+		logger.Info("clear result-*.zip and job-* files", "dir", wd, "threshold", threshold)
+		sweepResultFiles(wd, threshold)
+		jobs.Sweep(threshold)
+		if iter == nil {
+			iter = strategy.Start()
+		}
+		if !iter.Next(ctx.Done()) {
+			break
+		}
+	}
+}
+
+// sweepResultFiles removes the result-*.zip and the job-* files of wd modified before threshold -
+// the job results of a previous run, too.
+func sweepResultFiles(wd string, threshold time.Time) {
+	dis, _ := os.ReadDir(wd)
+	for _, di := range dis {
+		bn := di.Name()
+		if !(di.Type().IsRegular() &&
+			(strings.HasPrefix(bn, "result-") && strings.HasSuffix(bn, ".zip") ||
+				strings.HasPrefix(bn, "job-"))) {
+			continue
+		}
+		if fi, err := di.Info(); err == nil && fi.ModTime().Before(threshold) {
+			fn := filepath.Join(wd, bn)
+			logger.Info("Remove", "file", fn)
+			os.Remove(fn)
+		}
+	}
+}
@@ -29,6 +29,24 @@ func mailToPdfZip(ctx context.Context, outfn, inpfn string, splitted bool, outim
 		splitted, outimg, imgsize, pages)
 }
 
+// mboxToPdfZip converts the messages of the mbox file or Maildir directory.
+func mboxToPdfZip(ctx context.Context, outfn, inpfn string, splitted bool, outimg string, imgsize string, pages []uint16) error {
+	splitted = splitted || len(pages) != 0
+	if isDir(inpfn) {
+		if !converter.IsMaildir(inpfn) {
+			return fmt.Errorf("%s is not a Maildir (no cur or new subdirectory)", inpfn)
+		}
+		return converter.MailboxToPdfZip(ctx, outfn, converter.MaildirMessages(inpfn),
+			splitted, outimg, imgsize, pages)
+	}
+	input, err := openIn(inpfn)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = input.Close() }()
+	return converter.MboxToPdfZip(ctx, outfn, input, splitted, outimg, imgsize, pages)
+}
+
 func mailToTree(ctx context.Context, outdir, inpfn string) error {
 	input, err := openIn(inpfn)
 	if err != nil {
@@ -78,9 +96,12 @@ func init() {
 	}
 	{
 		var (
-			split         bool
-			outimg, pageS string
-			imgsize       = "640x640"
+			split, noHeader, cover bool
+			outimg, pageS, headers string
+			rawHeaders             string
+			imgsize                = "640x640"
+			header                 converter.HeaderOptions
+			passwords              []string
 		)
 		fs := withOutFlag("mail")
 		fs.BoolVar(&split, 0, "split", "split PDF to pages")
@@ -88,9 +109,15 @@ func init() {
 		fs.StringVar(&outimg, 0, "outimg", "", "output image format")
 		fs.StringVar(&imgsize, 0, "imgsize", imgsize, "image size")
 		fs.StringVar(&pageS, 0, "pages", "", "pages (comma separated)")
+		fs.BoolVar(&cover, 0, "cover", "add a cover page listing the parts")
+		fs.StringVar(&rawHeaders, 0, "raw-headers", "", "append the raw headers of the top-level (top) or all (all) messages")
+		fs.BoolVar(&noHeader, 0, "no-header", "do not print the header block before the mail body")
+		fs.StringVar(&headers, 0, "headers", "", "headers to print before the mail body (comma separated)")
+		fs.StringVar(&header.Lang, 0, "lang", "", "language of the header labels (en, hu, de)")
+		fs.StringListVar(&passwords, 0, "password", "password of the encrypted attached archives (repeatable)")
 		mailToPdfZipCmd := ff.Command{Name: "mail", Flags: fs,
 			ShortHelp: "convert mail to zip of PDFs",
-			Usage:     "mail [-split] [-outimg=image/gif] [-imgsize=640x640] mailfile.eml",
+			Usage:     "mail [-split] [-outimg=image/gif] [-imgsize=640x640] [-headers=From,To,Subject] [-lang=hu] mailfile.eml",
 			LongHelp: `reads a message/rfc822 email, converts all of it to PDF files
 (including attachments), and outputs a zip file containing these pdfs,
 optionally splits the PDFs to separate pages, and converts these pages to images.
@@ -106,6 +133,16 @@ Examples:
 					inp = args[0]
 				}
 				pages := parseUint16s(strings.Split(pageS, ","))
+				if header.Headers = converter.ParseHeaderList(headers); noHeader {
+					header.Disabled = new(true)
+				}
+				ctx = converter.WithArchivePasswords(converter.WithHeaderOptions(ctx, header), passwords)
+				if cover {
+					ctx = converter.WithCoverPage(ctx, true)
+				}
+				if rawHeaders != "" {
+					ctx = converter.WithRawHeaders(ctx, getRawHeaders(rawHeaders))
+				}
 				if outimg != "" && strings.IndexByte(outimg, '/') < 0 {
 					outimg = "image/" + outimg
 				}
@@ -118,6 +155,79 @@ Examples:
 		subcommands = append(subcommands, &mailToPdfZipCmd)
 	}
 
+	{
+		var (
+			split         bool
+			outimg, pageS string
+			imgsize       = "640x640"
+			parallel      int
+		)
+		fs := withOutFlag("mbox")
+		fs.BoolVar(&split, 0, "split", "split PDF to pages")
+		fs.StringVar(&outimg, 0, "outimg", "", "output image format")
+		fs.StringVar(&imgsize, 0, "imgsize", imgsize, "image size")
+		fs.StringVar(&pageS, 0, "pages", "", "pages (comma separated)")
+		fs.IntVar(&parallel, 'P', "parallel", 0, "number of messages converted in parallel")
+		mboxToPdfZipCmd := ff.Command{Name: "mbox", Flags: fs,
+			ShortHelp: "convert all messages of an mbox file or Maildir to a zip of PDFs",
+			Usage:     "mbox [-split] [-outimg=image/gif] [-imgsize=640x640] [-parallel=4] -o=out.zip mailbox.mbox|Maildir",
+			LongHelp: `reads an mbox file (or a Maildir directory), converts each message as the mail
+command does, and outputs a zip file with one folder per message, and an index.json
+listing the messages (folder, subject, from, date, message-id, files, error).`,
+			Exec: func(ctx context.Context, args []string) error {
+				if len(args) != 0 {
+					inp = args[0]
+				}
+				if parallel > 0 {
+					*converter.ConfMboxParallel = parallel
+				}
+				pages := parseUint16s(strings.Split(pageS, ","))
+				if outimg != "" && strings.IndexByte(outimg, '/') < 0 {
+					outimg = "image/" + outimg
+				}
+				if err := mboxToPdfZip(ctx, out, inp, split, outimg, imgsize, pages); err != nil {
+					return fmt.Errorf("mboxToPdfZip out=%s: %w", out, err)
+				}
+				return nil
+			},
+		}
+		subcommands = append(subcommands, &mboxToPdfZipCmd)
+	}
+
+	{
+		var (
+			collapse, noHeader bool
+			headers            string
+			header             converter.HeaderOptions
+		)
+		fs := withOutFlag("thread")
+		fs.BoolVar(&collapse, 0, "collapse", "collapse the quoted text repeating the previous message")
+		fs.BoolVar(&noHeader, 0, "no-header", "do not print the header block before the mail bodies")
+		fs.StringVar(&headers, 0, "headers", "", "headers to print before the mail bodies (comma separated)")
+		fs.StringVar(&header.Lang, 0, "lang", "", "language of the header labels (en, hu, de)")
+		threadToPdfCmd := ff.Command{Name: "thread", Flags: fs,
+			ShortHelp: "convert the mails of a conversation to one PDF",
+			Usage:     "thread [-collapse] [-headers=From,To,Subject] [-lang=hu] -o=thread.pdf a.eml b.eml...|mailbox.mbox|Maildir",
+			LongHelp: `reads the mails (or the messages of mbox files and Maildir directories),
+orders them chronologically by their In-Reply-To, References and Date headers,
+converts each as the mail command does, and outputs one PDF with a bookmark for each message.`,
+			Exec: func(ctx context.Context, args []string) error {
+				if len(args) == 0 {
+					args = []string{inp}
+				}
+				if header.Headers = converter.ParseHeaderList(headers); noHeader {
+					header.Disabled = new(true)
+				}
+				ctx = converter.WithHeaderOptions(ctx, header)
+				if err := threadToPdf(ctx, out, args, collapse); err != nil {
+					return fmt.Errorf("threadToPdf out=%s: %w", out, err)
+				}
+				return nil
+			},
+		}
+		subcommands = append(subcommands, &threadToPdfCmd)
+	}
+
 	fs := withOutFlag("mail2tree")
 	mailToTreeCmd := ff.Command{Name: "mail2tree", Flags: fs,
 		ShortHelp: "extract mail tree to a directory",
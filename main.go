@@ -31,7 +31,6 @@ import (
 	tufclient "github.com/theupdateframework/go-tuf/client"
 
 	"github.com/kardianos/osext"
-	"github.com/rogpeppe/retry"
 	"github.com/tgulacsi/agostle/converter"
 	"github.com/tgulacsi/go/i18nmail"
 	"github.com/tgulacsi/go/version"
@@ -199,36 +198,11 @@ func Main() error {
 				listenAddr = *converter.ConfListenAddr
 			}
 			logger.Info("serve", "listeners", len(listeners), "listenAddr", listenAddr)
+			if _, err := loadAuth(); err != nil {
+				return err
+			}
 
-			go func() {
-				strategy := retry.Strategy{Delay: 5 * time.Minute}
-				var iter *retry.Iter
-				for {
-					threshold := time.Now().Add(-time.Hour)
-					wd := converter.Workdir
-					logger.Info("clear result-*.zip files", "dir", wd, "threshold", threshold)
-					dis, _ := os.ReadDir(wd)
-					for _, di := range dis {
-						bn := di.Name()
-						if !(di.Type().IsRegular() &&
-							strings.HasPrefix(bn, "result-") &&
-							strings.HasSuffix(bn, ".zip")) {
-							continue
-						}
-						if fi, err := di.Info(); err == nil && fi.ModTime().Before(threshold) {
-							fn := filepath.Join(wd, bn)
-							logger.Info("Remove", "file", fn)
-							os.Remove(fn)
-						}
-					}
-					if iter == nil {
-						iter = strategy.Start()
-					}
-					if !iter.Next(ctx.Done()) {
-						break
-					}
-				}
-			}()
+			go sweepResults(ctx)
 
 			grp, grpCtx := errgroup.WithContext(ctx)
 			grp.SetLimit(converter.Concurrency)
@@ -238,7 +212,7 @@ func Main() error {
 					logger.Info("listening", "address", listenAddr)
 					s := newHTTPServer(listenAddr, savereq)
 					srvs = append(srvs, s)
-					return s.ListenAndServe()
+					return serveHTTP(s, nil)
 				})
 			}
 			for _, l := range listeners {
@@ -246,7 +220,7 @@ func Main() error {
 					logger.Info("listening", "listener", l)
 					s := newHTTPServer("", savereq)
 					srvs = append(srvs, s)
-					return s.Serve(l)
+					return serveHTTP(s, l)
 				})
 			}
 			grp.Go(func() error { return sdNotify(grpCtx.Done()) })
@@ -0,0 +1,668 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/tgulacsi/agostle/client"
+	"github.com/tgulacsi/agostle/converter"
+)
+
+var testDir string
+
+func TestMain(m *testing.M) {
+	var err error
+	testDir, err = os.MkdirTemp("", "agostle-test-")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(13)
+	}
+	*converter.ConfWorkdir = testDir
+	_ = converter.LoadConfig(context.Background(), "")
+	code := m.Run()
+	_ = os.RemoveAll(testDir)
+	os.Exit(code)
+}
+
+// newTestClient starts newHTTPServer in-process, and returns a client for it.
+func newTestClient(t *testing.T) *client.Client {
+	t.Helper()
+	srv := httptest.NewServer(newHTTPServer("", false).Handler)
+	t.Cleanup(srv.Close)
+	return client.New(srv.URL, srv.Client())
+}
+
+// testPDF returns a one-page PDF, created from a PNG image.
+func testPDF(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for x := range 32 {
+		img.Set(x, x, color.Black)
+	}
+	var imgBuf, pdfBuf bytes.Buffer
+	if err := png.Encode(&imgBuf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := converter.ImageToPdfPdfCPU(&pdfBuf, &imgBuf); err != nil {
+		t.Fatal(err)
+	}
+	return pdfBuf.Bytes()
+}
+
+func TestOpenAPI(t *testing.T) {
+	cl := newTestClient(t)
+	resp, err := cl.HTTPClient.Get(cl.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var spec struct {
+		OpenAPI string
+		Paths   map[string]map[string]json.RawMessage
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		"/email/convert", "/email/thread", "/convert",
+		"/jobs", "/jobs/{id}", "/jobs/{id}/result",
+		"/pdf/merge", "/pdf/split", "/pdf/fields", "/pdf/fill",
+		"/outlook", "/stem",
+	} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("%s is missing from the OpenAPI document", path)
+		}
+	}
+}
+
+func TestClientPdfMerge(t *testing.T) {
+	cl := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	pdf := testPDF(t)
+	rc, err := cl.PdfMerge(ctx, []client.File{
+		{Name: "a.pdf", ContentType: "application/pdf", Body: bytes.NewReader(pdf)},
+		{Name: "b.pdf", ContentType: "application/pdf", Body: bytes.NewReader(pdf)},
+	}, client.MergeOptions{Sort: client.SortNo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := api.PageCount(bytes.NewReader(b), model.NewDefaultConfiguration()); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Errorf("got %d pages, want 2", n)
+	}
+}
+
+func TestClientPdfSplit(t *testing.T) {
+	if *converter.ConfMutool == "" && *converter.ConfPdftk == "" {
+		t.Skip("page counting needs mutool or pdftk")
+	}
+	cl := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	rc, err := cl.PdfSplit(ctx, client.File{
+		Name: "a.pdf", ContentType: "application/pdf", Body: bytes.NewReader(testPDF(t)),
+	}, client.SplitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 {
+		t.Errorf("got %d files, want 1", len(zr.File))
+	}
+}
+
+func TestClientConvertFiles(t *testing.T) {
+	cl := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	pdf := testPDF(t)
+	rc, err := cl.ConvertFiles(ctx, []client.File{
+		{Name: "b.pdf", ContentType: "application/pdf", Body: bytes.NewReader(pdf)},
+		{Name: "a.mp3", ContentType: "audio/mpeg", Body: bytes.NewReader([]byte("ID3"))},
+		{Name: "c.pdf", ContentType: "application/pdf", Body: bytes.NewReader(pdf)},
+	}, client.ConvertOptions{}, client.SortNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var manifest converter.Manifest
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Name != converter.ManifestFn {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.NewDecoder(rc).Decode(&manifest)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	slices.Sort(names)
+	if want := []string{"001-b.pdf", "003-c.pdf", converter.ErrTextFn, converter.ManifestFn}; !slices.Equal(names, want) {
+		t.Errorf("got %q, want %q", names, want)
+	}
+	var states []string
+	for _, p := range manifest.Parts {
+		states = append(states, p.Filename+":"+p.State)
+	}
+	if want := []string{"b.pdf:done", "a.mp3:failed", "c.pdf:done"}; !slices.Equal(states, want) {
+		t.Errorf("got %q, want %q", states, want)
+	}
+}
+
+func TestClientConvertStream(t *testing.T) {
+	cl := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var names []string
+	if err := cl.ConvertStream(ctx, client.File{
+		Name: "a.pdf", ContentType: "application/pdf", Body: bytes.NewReader(testPDF(t)),
+	}, client.ConvertOptions{}, func(name, contentType string, r io.Reader) error {
+		names = append(names, name)
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) < 2 || names[len(names)-1] != converter.ManifestFn {
+		t.Errorf("got %q, want the PDFs and %q last", names, converter.ManifestFn)
+	}
+}
+
+func TestClientEmailConvertStreamFailed(t *testing.T) {
+	cl := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	buf.WriteString("From: Joe <joe@example.com>\r\nSubject: failed\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n\r\n")
+	for _, f := range []struct{ Name, ContentType, Body string }{
+		{"a.pdf", "application/pdf", base64.StdEncoding.EncodeToString(testPDF(t))},
+		{"b.mp3", "audio/mpeg", base64.StdEncoding.EncodeToString([]byte("ID3\x03\x00not really an mp3"))},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {f.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {`attachment; filename="` + f.Name + `"`},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = pw.Write([]byte(f.Body))
+	}
+	_ = mw.Close()
+
+	var names []string
+	var errText string
+	if err := cl.EmailConvertStream(ctx, client.File{
+		Name: "a.eml", ContentType: "message/rfc822", Body: &buf,
+	}, client.ConvertOptions{}, func(name, contentType string, r io.Reader) error {
+		names = append(names, name)
+		b, err := io.ReadAll(r)
+		if name == converter.ErrTextFn {
+			errText = string(b)
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(names, func(s string) bool { return strings.Contains(s, "audio--mpeg") }) {
+		t.Errorf("got %q, want the failed audio part", names)
+	}
+	if !strings.Contains(errText, "audio") {
+		t.Errorf("got errors %q, want the failed audio part", errText)
+	}
+	if names[len(names)-1] != converter.ManifestFn {
+		t.Errorf("got %q, want %q last", names, converter.ManifestFn)
+	}
+}
+
+// testMail returns a mail with a one-page PDF attachment.
+func testMail(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	buf.WriteString("From: Joe <joe@example.com>\r\nSubject: raw\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n\r\n")
+	pw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"application/pdf"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {`attachment; filename="a.pdf"`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = pw.Write([]byte(base64.StdEncoding.EncodeToString(testPDF(t))))
+	_ = mw.Close()
+	return buf.Bytes()
+}
+
+func TestClientCoverRawHeaders(t *testing.T) {
+	if err := converter.HTMLToPdf(context.Background(), filepath.Join(testDir, "html.pdf"),
+		strings.NewReader("<html><body>x</body></html>"), "text/html"); err != nil {
+		t.Skip("the cover page and the raw headers need HTML to PDF conversion:", err)
+	}
+	cl := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	mail := testMail(t)
+
+	// the streamed raw headers come before the manifest
+	var names []string
+	if err := cl.EmailConvertStream(ctx, client.File{
+		Name: "a.eml", ContentType: "message/rfc822", Body: bytes.NewReader(mail),
+	}, client.ConvertOptions{RawHeaders: converter.RawHeadersTop}, func(name, contentType string, r io.Reader) error {
+		names = append(names, name)
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(names, converter.RawHeadersFn) || names[len(names)-1] != converter.ManifestFn {
+		t.Errorf("got %q, want %q and %q last", names, converter.RawHeadersFn, converter.ManifestFn)
+	}
+
+	// the converted mail of the files gets the cover page and the raw headers
+	pages := func(opts client.ConvertOptions) int {
+		rc, err := cl.ConvertFiles(ctx, []client.File{
+			{Name: "a.eml", ContentType: "message/rfc822", Body: bytes.NewReader(mail)},
+			{Name: "b.pdf", ContentType: "application/pdf", Body: bytes.NewReader(testPDF(t))},
+		}, opts, client.SortNo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		b, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := api.PageCount(bytes.NewReader(b), model.NewDefaultConfiguration())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	plain := pages(client.ConvertOptions{Merged: true})
+	if got := pages(client.ConvertOptions{Merged: true, Cover: true, RawHeaders: converter.RawHeadersTop}); got != plain+2 {
+		t.Errorf("got %d pages, want %d", got, plain+2)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	defer func(keys string) { *converter.ConfAuthKeys = keys }(*converter.ConfAuthKeys)
+	*converter.ConfAuthKeys = "conv:convert:s3cret, ops:admin+convert:t0ken"
+	srv := httptest.NewServer(newHTTPServer("", false).Handler)
+	defer srv.Close()
+	for i, tc := range []struct {
+		Path, Header, Value string
+		Want                int
+	}{
+		{"/openapi.json", "", "", http.StatusOK},
+		{"/metrics", "", "", http.StatusUnauthorized},
+		{"/metrics", "X-API-Key", "bad", http.StatusUnauthorized},
+		{"/metrics", "X-API-Key", "s3cret", http.StatusForbidden},
+		{"/metrics", "Authorization", "Bearer t0ken", http.StatusOK},
+		{"/jobs/nonexistent", "Authorization", "Bearer s3cret", http.StatusNotFound},
+		{"/jobs/nonexistent", "", "", http.StatusUnauthorized},
+	} {
+		req, err := http.NewRequest("GET", srv.URL+tc.Path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.Header != "" {
+			req.Header.Set(tc.Header, tc.Value)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.Want {
+			t.Errorf("%d. %s %s: got %d, want %d", i, tc.Path, tc.Header, resp.StatusCode, tc.Want)
+		}
+	}
+}
+
+// keyTransport sets the API key of the requests.
+type keyTransport string
+
+func (k keyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("X-API-Key", string(k))
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestJobOwner(t *testing.T) {
+	defer func(keys string) { *converter.ConfAuthKeys = keys }(*converter.ConfAuthKeys)
+	*converter.ConfAuthKeys = "alice:convert:s3cret, bob:convert:t0ken"
+	srv := httptest.NewServer(newHTTPServer("", false).Handler)
+	defer srv.Close()
+	alice := client.New(srv.URL, &http.Client{Transport: keyTransport("s3cret")})
+	bob := client.New(srv.URL, &http.Client{Transport: keyTransport("t0ken")})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	job, err := alice.SubmitJob(ctx, client.File{
+		Name: "a.pdf", ContentType: "application/pdf", Body: bytes.NewReader(testPDF(t)),
+	}, client.JobOptions{Convert: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = alice.Job(ctx, job.ID); err != nil {
+		t.Errorf("owner: %+v", err)
+	}
+	for i, call := range []func() error{
+		func() error { _, err := bob.Job(ctx, job.ID); return err },
+		func() error { _, err := bob.JobResult(ctx, job.ID); return err },
+	} {
+		var cErr *client.Error
+		if err := call(); !errors.As(err, &cErr) || cErr.StatusCode != http.StatusNotFound {
+			t.Errorf("%d. got %v, want %d", i, err, http.StatusNotFound)
+		}
+	}
+	_, _ = alice.Wait(ctx, job.ID, 10*time.Millisecond)
+}
+
+func TestAdmission(t *testing.T) {
+	a := &admission{
+		slots: make(chan struct{}, 1), depth: 1, timeout: time.Second,
+		mWait:     metrics.NewHistogram(`test_admission_wait_seconds`),
+		mRejected: metrics.NewCounter(`test_admission_rejected_total`),
+	}
+	ctx := context.Background()
+	release, err := a.acquire(ctx, a.timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one may wait
+	done := make(chan error, 1)
+	go func() {
+		release, err := a.acquire(ctx, 10*time.Second)
+		if err == nil {
+			release()
+		}
+		done <- err
+	}()
+	for a.queued.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// the next is rejected
+	if _, err = a.acquire(ctx, a.timeout); !errors.Is(err, errQueueFull) {
+		t.Errorf("got %v, want %v", err, errQueueFull)
+	}
+	w := httptest.NewRecorder()
+	a.check(func(w http.ResponseWriter, r *http.Request) {})(w, httptest.NewRequest("POST", "/jobs", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("got %d (Retry-After=%q), want 429", w.Code, w.Header().Get("Retry-After"))
+	}
+	release()
+	if err = <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	cl := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for i, tc := range []struct {
+		Call func() error
+		Want int
+	}{
+		{func() error { _, err := cl.Job(ctx, "nonexistent"); return err }, http.StatusNotFound},
+		{func() error { _, err := cl.JobResult(ctx, "nonexistent"); return err }, http.StatusNotFound},
+		{func() error {
+			_, err := cl.Stem(ctx, client.File{Body: bytes.NewReader([]byte("alma"))}, client.StemOptions{})
+			return err
+		}, http.StatusBadRequest},
+		{func() error {
+			return cl.EmailConvertStream(ctx, client.File{
+				Name: "a.eml", ContentType: "message/rfc822", Body: bytes.NewReader(testMail(t)),
+			}, client.ConvertOptions{Cover: true}, func(string, string, io.Reader) error { return nil })
+		}, http.StatusBadRequest},
+		{func() error {
+			_, err := cl.ConvertFiles(ctx, []client.File{
+				{Name: "a.txt", Body: strings.NewReader("alma"), ContentType: "text/plain"},
+				{Name: "empty.txt", Body: strings.NewReader(""), ContentType: "text/plain"},
+			}, client.ConvertOptions{}, client.SortDefault)
+			return err
+		}, http.StatusBadRequest},
+	} {
+		var cErr *client.Error
+		if err := tc.Call(); !errors.As(err, &cErr) {
+			t.Errorf("%d. got %v, want client.Error", i, err)
+		} else if cErr.StatusCode != tc.Want {
+			t.Errorf("%d. got %d, want %d", i, cErr.StatusCode, tc.Want)
+		}
+	}
+}
+
+func TestGetRequestFiles(t *testing.T) {
+	defer func(parts int, total int64) {
+		*converter.ConfUploadMaxParts, *converter.ConfUploadMaxTotalSize = parts, total
+	}(*converter.ConfUploadMaxParts, *converter.ConfUploadMaxTotalSize)
+	big := bytes.Repeat([]byte("x"), converter.InMemorySize+10)
+	newRequest := func(sizes ...int) *http.Request {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		_ = mw.WriteField("sort", "0")
+		for i, n := range sizes {
+			w, _ := mw.CreateFormFile("file", fmt.Sprintf("%d.txt", i))
+			_, _ = w.Write(big[:n])
+		}
+		_ = mw.Close()
+		r := httptest.NewRequest("POST", "/convert", &buf)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		return r
+	}
+	spooled := func() []string {
+		fns, _ := filepath.Glob(filepath.Join(testDir, "part-*"))
+		return fns
+	}
+	for i, tc := range []struct {
+		Sizes     []int
+		MaxParts  int
+		MaxTotal  int64
+		WantFiles int
+		WantCode  int
+		Spooled   int
+	}{
+		{Sizes: []int{1, 2, 3}, WantFiles: 3},
+		{Sizes: []int{1, len(big)}, WantFiles: 2, Spooled: 1},
+		{Sizes: []int{1, 2, 3}, MaxParts: 3, WantCode: http.StatusRequestEntityTooLarge},
+		{Sizes: []int{10, 10, 10}, MaxTotal: 25, WantCode: http.StatusRequestEntityTooLarge},
+		{Sizes: []int{len(big), len(big)}, MaxTotal: int64(len(big)) + 5, WantCode: http.StatusRequestEntityTooLarge},
+	} {
+		*converter.ConfUploadMaxParts, *converter.ConfUploadMaxTotalSize = tc.MaxParts, tc.MaxTotal
+		files, err := getRequestFiles(newRequest(tc.Sizes...))
+		if tc.WantCode != 0 {
+			var hErr httpError
+			if !errors.As(err, &hErr) || hErr.Code != tc.WantCode {
+				t.Errorf("%d. got %v, want %d", i, err, tc.WantCode)
+			}
+		} else if err != nil {
+			t.Errorf("%d. %+v", i, err)
+		} else if len(files) != tc.WantFiles {
+			t.Errorf("%d. got %d files, want %d", i, len(files), tc.WantFiles)
+		} else {
+			for j, f := range files {
+				if b, err := io.ReadAll(f); err != nil || len(b) != tc.Sizes[j] || f.Size != int64(len(b)) {
+					t.Errorf("%d. %d: got %d bytes (%d), want %d: %+v", i, j, len(b), f.Size, tc.Sizes[j], err)
+				}
+			}
+			if fns := spooled(); len(fns) != tc.Spooled {
+				t.Errorf("%d. got %d spooled files, want %d", i, len(fns), tc.Spooled)
+			}
+		}
+		for _, f := range files {
+			_ = f.Close()
+		}
+		if fns := spooled(); len(fns) != 0 {
+			t.Errorf("%d. spooled files left: %q", i, fns)
+		}
+	}
+}
+
+func TestStemDecode(t *testing.T) {
+	for i, tc := range []struct {
+		Query, ContentLanguage string
+		Want                   []string
+		Code                   int
+	}{
+		{"lang=en_US&lang=hu-HU,en_US", "", []string{"en_US", "hu-HU"}, 0},
+		{"", "de, en", []string{"de", "en"}, 0},
+		{"lang=hun", "en", []string{"hun"}, 0},
+		{"", "", nil, http.StatusBadRequest},
+		{"lang=en_US&lang=-d", "", nil, http.StatusBadRequest},
+		{"lang=../../tmp/x", "", nil, http.StatusBadRequest},
+		{"lang=en_US.UTF-8", "", nil, http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest("POST", "/stem?"+tc.Query, strings.NewReader("alma"))
+		r.Header.Set("Content-Type", "text/plain")
+		if tc.ContentLanguage != "" {
+			r.Header.Set("Content-Language", tc.ContentLanguage)
+		}
+		req, err := stemConvertDecode(context.Background(), r)
+		if tc.Code != 0 {
+			var hErr httpError
+			if !errors.As(err, &hErr) || hErr.Code != tc.Code {
+				t.Errorf("%d. got %v, want %d", i, err, tc.Code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d. %+v", i, err)
+			continue
+		}
+		if got := req.(stemRequest).Languages; !slices.Equal(got, tc.Want) {
+			t.Errorf("%d. got %q, want %q", i, got, tc.Want)
+		}
+	}
+}
+
+func TestClientStem(t *testing.T) {
+	if _, err := exec.LookPath("hunspell"); err != nil {
+		t.Skip(err)
+	}
+	cl := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	res, err := cl.Stem(ctx, client.File{Body: strings.NewReader("The cats are walking\n"), ContentType: "text/plain"},
+		client.StemOptions{Languages: []string{"en_US"}})
+	if err != nil {
+		var cErr *client.Error
+		if errors.As(err, &cErr) && strings.Contains(cErr.Error(), "Can't open affix or dictionary") {
+			t.Skip(err)
+		}
+		t.Fatal(err)
+	}
+	m := res["en_US"]
+	for word, stem := range map[string]string{"cats": "cat", "walking": "walk"} {
+		if !slices.Contains(m[word], stem) {
+			t.Errorf("%s: got %q, want %q", word, m[word], stem)
+		}
+	}
+}
+
+func TestSweepResultFiles(t *testing.T) {
+	wd := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	for fn, mtime := range map[string]time.Time{
+		"result-old.zip": old, "job-old.zip": old, "job-old.pdf": old,
+		"result-new.zip": time.Now(), "job-new.zip": time.Now(),
+		"other.zip": old,
+	} {
+		fn = filepath.Join(wd, fn)
+		if err := os.WriteFile(fn, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(fn, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sweepResultFiles(wd, time.Now().Add(-time.Hour))
+	dis, err := os.ReadDir(wd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, di := range dis {
+		names = append(names, di.Name())
+	}
+	if got, want := strings.Join(names, " "), "job-new.zip other.zip result-new.zip"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestIsMboxInput(t *testing.T) {
+	for i, tc := range []struct {
+		ContentType, FileName string
+		Want                  bool
+	}{
+		{"application/mbox", "", true},
+		{"application/mbox; format=mboxrd", "a.eml", true},
+		{"application/octet-stream", "Archive.MBOX", true},
+		// a single mail, even if it starts with a "From " line
+		{"message/rfc822", "a.eml", false},
+		{"", "", false},
+	} {
+		if got := isMboxInput(tc.ContentType, tc.FileName); got != tc.Want {
+			t.Errorf("%d. got %t, want %t", i, got, tc.Want)
+		}
+	}
+}
@@ -61,7 +61,7 @@ func (p *program) Start(S service.Service) error {
 func (p *program) run() {
 	p.Server = newHTTPServer(listenAddr, false)
 	logger.Info("run")
-	if err := p.Server.ListenAndServe(); err != nil {
+	if err := serveHTTP(p.Server, nil); err != nil {
 		logger.Error("run", "error", err)
 		os.Exit(1)
 	}
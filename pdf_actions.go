@@ -51,6 +51,8 @@ func init() {
 
 	fs := withOutFlag("split")
 	flagSplitPages := fs.StringLong("pages", "", "pages (comma separated)")
+	flagSplitOutImg := fs.StringLong("outimg", "", "output image format (also render the pages)")
+	flagSplitImgSize := fs.StringLong("imgsize", defaultImageSize, "image size")
 	splitCmd := ff.Command{Name: "split", Flags: fs,
 		ShortHelp: "splits the given PDF into one per page",
 		Exec: func(ctx context.Context, args []string) error {
@@ -61,7 +63,11 @@ func init() {
 			if splitInp == "" {
 				splitInp = "-"
 			}
-			if err := splitPdfZip(ctx, out, splitInp, parseUint16s(strings.Split(*flagSplitPages, ","))); err != nil {
+			outimg := *flagSplitOutImg
+			if outimg != "" && strings.IndexByte(outimg, '/') < 0 {
+				outimg = "image/" + outimg
+			}
+			if err := splitPdfZip(ctx, out, splitInp, parseUint16s(strings.Split(*flagSplitPages, ",")), outimg, *flagSplitImgSize); err != nil {
 				return fmt.Errorf("splitPdfZip out=%q inp=%q: %w", out, splitInp, err)
 			}
 			return nil
@@ -121,6 +127,7 @@ func init() {
 	}
 
 	fs = withOutFlag("fill")
+	flagFillFlatten := fs.BoolLong("flatten", "flatten the filled form")
 	fillPdfCmd := ff.Command{Name: "fill", Flags: fs,
 		ShortHelp: "fill PDF form",
 		Usage: `fill PDF form
@@ -132,7 +139,7 @@ input.pdf key1=value1 key2=value2...`,
 				fillInp = args[0]
 				fillKeyvals = args[1:]
 			}
-			if err := fillFdf(ctx, out, fillInp, fillKeyvals...); err != nil {
+			if err := fillFdf(ctx, out, fillInp, *flagFillFlatten, fillKeyvals...); err != nil {
 				return fmt.Errorf("fillPdf out=%q inp=%q keyvals=%q: %w", out, fillInp, fillKeyvals, err)
 			}
 			return nil
@@ -141,7 +148,9 @@ input.pdf key1=value1 key2=value2...`,
 	pdfCmd.Subcommands = append(pdfCmd.Subcommands, &fillPdfCmd)
 }
 
-func splitPdfZip(ctx context.Context, outfn, inpfn string, pages []uint16) error {
+// splitPdfZip splits the PDF into pages, and zips them, with the page images
+// if imgmime is not empty.
+func splitPdfZip(ctx context.Context, outfn, inpfn string, pages []uint16, imgmime, imgsize string) error {
 	var changed bool
 	if inpfn, changed = ensureFilename(inpfn, false); changed {
 		defer func() { _ = os.Remove(inpfn) }()
@@ -151,13 +160,28 @@ func splitPdfZip(ctx context.Context, outfn, inpfn string, pages []uint16) error
 		return err
 	}
 	defer func() { _ = cleanup() }()
+	var imgfilenames []string
+	if imgmime != "" {
+		imgfilenames, err = converter.PdfToImageMulti(ctx, filenames, imgmime, imgsize)
+		defer func() {
+			for _, nm := range imgfilenames {
+				_ = os.Remove(nm)
+			}
+		}()
+		if err != nil {
+			if len(imgfilenames) == 0 {
+				return fmt.Errorf("PdfToImageMulti: %w", err)
+			}
+			getLogger(ctx).Warn("PdfToImageMulti", "error", err)
+		}
+	}
 	outfh, err := openOut(outfn)
 	if err != nil {
 		return err
 	}
-	files := make([]converter.ArchFileItem, len(filenames))
-	for i, nm := range filenames {
-		files[i] = converter.ArchFileItem{Filename: nm}
+	files := make([]converter.ArchFileItem, 0, len(filenames)+len(imgfilenames))
+	for _, nm := range append(filenames, imgfilenames...) {
+		files = append(files, converter.ArchFileItem{Filename: nm})
 	}
 	ze := converter.ZipFiles(outfh, false, false, files...)
 	closeErr := outfh.Close()
@@ -210,7 +234,7 @@ func countPdf(ctx context.Context, inpfn string) error {
 	return nil
 }
 
-func fillFdf(ctx context.Context, outfn, inpfn string, kv ...string) error {
+func fillFdf(ctx context.Context, outfn, inpfn string, flatten bool, kv ...string) error {
 	values := make(map[string]string, len(kv))
 	for _, txt := range kv {
 		i := strings.IndexByte(txt, '=')
@@ -220,5 +244,5 @@ func fillFdf(ctx context.Context, outfn, inpfn string, kv ...string) error {
 		}
 		values[txt[:i]] = txt[i+1:]
 	}
-	return converter.PdfFillFdf(ctx, outfn, inpfn, values)
+	return converter.PdfFillForm(ctx, outfn, inpfn, values, flatten)
 }
@@ -0,0 +1,151 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/tgulacsi/agostle/converter"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+var pdfFieldsServer = kithttp.NewServer(
+	pdfFieldsEP,
+	pdfFieldsDecode,
+	pdfFieldsEncode,
+	kithttp.ServerBefore(defaultBeforeFuncs...),
+	kithttp.ServerAfter(kithttp.SetContentType("application/json")),
+)
+
+var pdfFillServer = kithttp.NewServer(
+	pdfFillEP,
+	pdfFillDecode,
+	pdfMergeEncode,
+	kithttp.ServerBefore(defaultBeforeFuncs...),
+	kithttp.ServerAfter(kithttp.SetContentType("application/pdf")),
+)
+
+func pdfFieldsDecode(ctx context.Context, r *http.Request) (any, error) {
+	return getOneRequestFile(ctx, r)
+}
+
+func pdfFieldsEP(ctx context.Context, request any) (response any, err error) {
+	f := request.(reqFile)
+	defer func() { _ = f.Close() }()
+	tfh, err := readerToFile(f, f.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("error saving %q: %w", f.Filename, err)
+	}
+	defer func() { _ = tfh.Cleanup() }()
+	return converter.PdfFields(ctx, tfh.Name())
+}
+
+func pdfFieldsEncode(ctx context.Context, w http.ResponseWriter, response any) error {
+	fields := response.([]converter.PdfField)
+	if fields == nil {
+		fields = []converter.PdfField{}
+	}
+	return json.NewEncoder(w).Encode(fields)
+}
+
+type pdfFillRequest struct {
+	Values  map[string]any
+	Input   reqFile
+	Flatten bool
+}
+
+// pdfFillDecode reads the PDF, and the values as JSON object from the "values" form field.
+func pdfFillDecode(ctx context.Context, r *http.Request) (any, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	inp, err := getOneRequestFile(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	req := pdfFillRequest{Input: inp, Flatten: r.Form.Get("flatten") == "1"}
+	if s := r.Form.Get("values"); s != "" {
+		if err = json.Unmarshal([]byte(s), &req.Values); err != nil {
+			_ = inp.Close()
+			return nil, httpError{Code: http.StatusBadRequest, Err: fmt.Errorf("parse values %q: %w", s, err)}
+		}
+	}
+	return req, nil
+}
+
+func pdfFillEP(ctx context.Context, request any) (response any, err error) {
+	req := request.(pdfFillRequest)
+	defer func() { _ = req.Input.Close() }()
+	logger := getLogger(ctx).With("fn", "pdfFillEP")
+	tfh, err := readerToFile(req.Input, req.Input.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("error saving %q: %w", req.Input.Filename, err)
+	}
+	defer func() { _ = tfh.Cleanup() }()
+
+	var values map[string]string
+	if len(req.Values) != 0 {
+		fields, err := converter.PdfFields(ctx, tfh.Name())
+		if err != nil {
+			return nil, err
+		}
+		if values, err = pdfFormValues(fields, req.Values); err != nil {
+			return nil, httpError{Code: http.StatusBadRequest, Err: err}
+		}
+	}
+
+	dst, err := tempFilename("pdffill-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(dst)
+	logger.Info("PdfFillForm", "dst", dst, "values", values, "flatten", req.Flatten)
+	if err = converter.PdfFillForm(ctx, dst, tfh.Name(), values, req.Flatten); err != nil {
+		return nil, err
+	}
+	return os.Open(dst)
+}
+
+// pdfFormValues converts the JSON values to field values:
+// a bool turns the checkbox on (its first non-Off state) or Off.
+func pdfFormValues(fields []converter.PdfField, values map[string]any) (map[string]string, error) {
+	m := make(map[string]string, len(values))
+	for k, v := range values {
+		i := slices.IndexFunc(fields, func(f converter.PdfField) bool { return f.Name == k })
+		if i < 0 {
+			return nil, fmt.Errorf("field %q does not exist", k)
+		}
+		f := fields[i]
+		switch x := v.(type) {
+		case string:
+			m[k] = x
+		case float64:
+			m[k] = strconv.FormatFloat(x, 'f', -1, 64)
+		case nil:
+			m[k] = ""
+		case bool:
+			m[k] = "Off"
+			if !x {
+				break
+			}
+			for _, o := range f.Options {
+				if o != "Off" {
+					m[k] = o
+					break
+				}
+			}
+		default:
+			return nil, fmt.Errorf("field %q: unsupported value %v (%T)", k, v, v)
+		}
+	}
+	return m, nil
+}
@@ -33,16 +33,19 @@ func pdfMergeDecode(ctx context.Context, r *http.Request) (any, error) {
 		logger.Error("getRequestFiles", "error", err)
 		return nil, err
 	}
-	req := pdfMergeRequest{Inputs: inputs}
+	return pdfMergeRequest{Inputs: inputs, Sort: getSortMode(r)}, nil
+}
+
+// getSortMode returns the sort mode asked with the "sort" query parameter.
+func getSortMode(r *http.Request) sortMode {
 	switch r.URL.Query().Get("sort") {
 	case "0":
-		req.Sort = NoSort
+		return NoSort
 	case "1":
-		req.Sort = DoSort
+		return DoSort
 	default:
-		req.Sort = DefaultSort
+		return DefaultSort
 	}
-	return req, nil
 }
 
 func pdfMergeEP(ctx context.Context, request any) (response any, err error) {
@@ -57,9 +60,8 @@ func pdfMergeEP(ctx context.Context, request any) (response any, err error) {
 	}()
 
 	logger := logger.With("fn", "pdfMergeEP")
-	if sortBeforeMerge && req.Sort != NoSort || !sortBeforeMerge && req.Sort != DoSort {
+	if req.Sort.sortFiles(req.Inputs) {
 		logger.Info("sorting filenames, as requested", "ask", req.Sort, "config", sortBeforeMerge)
-		sort.Sort(ByName(req.Inputs))
 	}
 
 	filenames := make([]string, len(req.Inputs))
@@ -146,6 +148,15 @@ const (
 	DoSort
 )
 
+// sortFiles sorts the files by name, if asked, or by default when sortBeforeMerge is set.
+func (s sortMode) sortFiles(files []reqFile) bool {
+	if s == DoSort || s == DefaultSort && sortBeforeMerge {
+		sort.Sort(ByName(files))
+		return true
+	}
+	return false
+}
+
 type ByName []reqFile
 
 func (b ByName) Len() int           { return len(b) }
@@ -0,0 +1,74 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+var pdfSplitServer = kithttp.NewServer(
+	pdfSplitEP,
+	pdfSplitDecode,
+	pdfMergeEncode,
+	kithttp.ServerBefore(defaultBeforeFuncs...),
+	kithttp.ServerAfter(kithttp.SetContentType("application/zip")),
+)
+
+type pdfSplitRequest struct {
+	Input           reqFile
+	OutImg, ImgSize string
+	Pages           []uint16
+}
+
+func pdfSplitDecode(ctx context.Context, r *http.Request) (any, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	var req pdfSplitRequest
+	for _, s := range r.Form["page"] {
+		req.Pages = append(req.Pages, parseUint16s(strings.Split(s, ","))...)
+	}
+	req.OutImg, req.ImgSize = getImageParams(r)
+	inp, err := getOneRequestFile(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Input = inp
+	return req, nil
+}
+
+// pdfSplitEP splits the PDF into pages, and returns them (and the images of them) zipped.
+func pdfSplitEP(ctx context.Context, request any) (response any, err error) {
+	req, ok := request.(pdfSplitRequest)
+	if !ok {
+		return nil, fmt.Errorf("awaited pdfSplitRequest, got %T", request)
+	}
+	defer func() { _ = req.Input.Close() }()
+	logger := getLogger(ctx).With("fn", "pdfSplitEP")
+
+	tfh, err := readerToFile(req.Input, req.Input.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("error saving %q: %w", req.Input.Filename, err)
+	}
+	defer func() { _ = tfh.Cleanup() }()
+
+	dst, err := tempFilename("pdfsplit-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(dst)
+	logger.Info("splitPdfZip", "dst", dst, "pages", req.Pages, "outimg", req.OutImg, "imgsize", req.ImgSize)
+	if err = splitPdfZip(ctx, dst, tfh.Name(), req.Pages, req.OutImg, req.ImgSize); err != nil {
+		logger.Error("splitPdfZip", "dst", dst, "error", err)
+		return nil, err
+	}
+	return os.Open(dst)
+}
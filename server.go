@@ -10,6 +10,7 @@ package main
 import (
 	"bytes"
 	"context"
+	_ "embed"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -36,6 +37,11 @@ import (
 	kithttp "github.com/go-kit/kit/transport/http"
 )
 
+// openAPI is the OpenAPI description of the HTTP API, served at /openapi.json.
+//
+//go:embed openapi.json
+var openAPI []byte
+
 var (
 	defaultImageSize = "640x640"
 	self             = ""
@@ -60,6 +66,10 @@ func newHTTPServer(address string, saveReq bool) *http.Server {
 
 	//mux.Handle("/debug/pprof", pprof.Handler)
 	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) { metrics.WritePrometheus(w, true) })
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(openAPI)
+	})
 
 	H := func(path string, handleFunc http.HandlerFunc) {
 		mName := fmt.Sprintf("request_duration_seconds{method=%%q,handler=%q}", strings.Replace(path[1:], "/", "_", -1))
@@ -89,14 +99,29 @@ func newHTTPServer(address string, saveReq bool) *http.Server {
 			},
 		)
 	}
-	H("/pdf/merge", pdfMergeServer.ServeHTTP)
-	H("/email/convert", emailConvertServer.ServeHTTP)
-	H("/convert", emailConvertServer.ServeHTTP)
-	H("/outlook", outlookToEmailServer.ServeHTTP)
-	//H("/stem", stemServer.ServeHTTP)
+	admit := getAdmission()
+	H("/pdf/merge", admit.limit(pdfMergeServer.ServeHTTP))
+	H("/pdf/split", admit.limit(pdfSplitServer.ServeHTTP))
+	H("/pdf/fields", admit.limit(pdfFieldsServer.ServeHTTP))
+	H("/pdf/fill", admit.limit(pdfFillServer.ServeHTTP))
+	H("/email/convert", admit.limit(emailConvertServer.ServeHTTP))
+	H("/email/thread", admit.limit(emailThreadServer.ServeHTTP))
+	H("/convert", admit.limit(convertServer.ServeHTTP))
+	H("/outlook", admit.limit(outlookToEmailServer.ServeHTTP))
+	H("/jobs", admit.check(jobSubmitServer.ServeHTTP))
+	H("/jobs/", jobServer.ServeHTTP)
+	H("/stem", admit.limit(stemConvertServer.ServeHTTP))
 	mux.Handle("/_admin/stop", mkAdminStopHandler(s))
 	mux.Handle("/", http.DefaultServeMux)
 
+	if a, err := loadAuth(); err != nil {
+		logger.Error("loadAuth", "error", err)
+		s.Handler = authErrorHandler(err)
+	} else if a != nil {
+		s.Handler = a.authHandler(&mux)
+		s.TLSConfig = a.tlsConfig()
+	}
+
 	return s
 }
 
@@ -132,6 +157,9 @@ func prepareContext(ctx context.Context, r *http.Request) context.Context {
 	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
 		lgr = lgr.With(slog.String("ip", host))
 	}
+	if id := getIdentity(ctx); id != "" {
+		lgr = lgr.With(slog.String("identity", id))
+	}
 	ctx = zlog.NewSContext(ctx, lgr)
 	logAccept(ctx, r)
 	return ctx
@@ -172,6 +200,16 @@ func mkAdminStopHandler(s interface{ Shutdown(context.Context) error }) http.Han
 	})
 }
 
+// httpError is an error with a HTTP status code, used by kithttp.DefaultErrorEncoder.
+type httpError struct {
+	Err  error
+	Code int
+}
+
+func (e httpError) Error() string   { return e.Err.Error() }
+func (e httpError) Unwrap() error   { return e.Err }
+func (e httpError) StatusCode() int { return e.Code }
+
 type reqFile struct {
 	io.ReadCloser
 	multipart.FileHeader
@@ -231,37 +269,128 @@ func getOneRequestFile(ctx context.Context, r *http.Request) (reqFile, error) {
 	return f, nil
 }
 
-// getRequestFiles reads the files from the request, and calls readerToFile on them
+// getRequestFiles reads the files from the request, in upload order.
+// A file bigger than converter.MaxSize, more parts than converter.ConfUploadMaxParts,
+// or more than converter.ConfUploadMaxTotalSize bytes are rejected with 413.
+// The non-file form fields are added to r.Form.
+//
+// The bigger files are spooled into the request's working directory: close them all.
+// On error, the files read so far are closed.
 func getRequestFiles(r *http.Request) ([]reqFile, error) {
 	if r.Body != nil {
 		defer func() { _ = r.Body.Close() }()
 	}
-	err := r.ParseMultipartForm(1 << 20)
+	mr, err := r.MultipartReader()
 	if err != nil {
 		return nil, fmt.Errorf("cannot parse request as multipart-form: %w", err)
 	}
-	if r.MultipartForm == nil || len(r.MultipartForm.File) == 0 {
-		return nil, errors.New("no files?")
+	if r.Form == nil {
+		if err = r.ParseForm(); err != nil {
+			return nil, err
+		}
 	}
-	defer func() { _ = r.MultipartForm.RemoveAll() }()
 
-	files := make([]reqFile, 0, len(r.MultipartForm.File))
-	for _, fileHeaders := range r.MultipartForm.File {
-		for _, fileHeader := range fileHeaders {
-			rc, err := fileHeader.Open()
+	var files []reqFile
+	fail := func(err error) ([]reqFile, error) {
+		for _, f := range files {
+			_ = f.Close()
+		}
+		return nil, err
+	}
+	maxParts, maxTotal := *converter.ConfUploadMaxParts, *converter.ConfUploadMaxTotalSize
+	var parts int
+	var total int64
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fail(fmt.Errorf("cannot read next part: %w", err))
+		}
+		if parts++; maxParts > 0 && parts > maxParts {
+			_ = part.Close()
+			return fail(httpError{Code: http.StatusRequestEntityTooLarge,
+				Err: fmt.Errorf("more than %d parts", maxParts)})
+		}
+		if part.FileName() == "" {
+			var buf strings.Builder
+			_, err = io.Copy(&buf, io.LimitReader(part, 1<<20))
+			_ = part.Close()
 			if err != nil {
-				return nil, fmt.Errorf("error reading part %q: %w", fileHeader.Filename, err)
+				return fail(fmt.Errorf("error reading field %q: %w", part.FormName(), err))
 			}
-			f := reqFile{ReadCloser: rc, FileHeader: *fileHeader}
-			files = append(files, f)
+			r.Form.Add(part.FormName(), buf.String())
+			continue
+		}
+		allowed := int64(converter.MaxSize)
+		tooBig := fmt.Errorf("part %q is bigger than %d bytes", part.FileName(), converter.MaxSize)
+		if maxTotal > 0 && maxTotal-total < allowed {
+			allowed = max(0, maxTotal-total)
+			tooBig = fmt.Errorf("the files are bigger than %d bytes in total", maxTotal)
 		}
+		f, err := spoolPart(r.Context(), part, allowed)
+		_ = part.Close()
+		if err != nil {
+			return fail(fmt.Errorf("error reading part %q: %w", part.FileName(), err))
+		}
+		f.FileHeader = multipart.FileHeader{Filename: part.FileName(), Header: part.Header, Size: f.Size}
+		files = append(files, f)
+		if f.Size > allowed {
+			return fail(httpError{Code: http.StatusRequestEntityTooLarge, Err: tooBig})
+		}
+		total += f.Size
 	}
 	if len(files) == 0 {
-		return nil, errors.New("no files??")
+		return nil, errors.New("no files?")
 	}
 	return files, nil
 }
 
+// spoolPart reads r (at most limit+1 bytes, Size tells how many) into memory if it is small,
+// into a file of the working directory of ctx otherwise, which is removed by Close.
+func spoolPart(ctx context.Context, r io.Reader, limit int64) (reqFile, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, min(limit+1, converter.InMemorySize+1)))
+	if err != nil {
+		return reqFile{}, err
+	}
+	if n <= converter.InMemorySize || n > limit {
+		return reqFile{
+			FileHeader: multipart.FileHeader{Size: n},
+			ReadCloser: io.NopCloser(bytes.NewReader(buf.Bytes())),
+		}, nil
+	}
+	_, wd := converter.PrepareContext(ctx, "")
+	fh, err := os.CreateTemp(wd, "part-*")
+	if err != nil {
+		return reqFile{}, err
+	}
+	sf := spooledFile{File: fh}
+	if n, err = io.Copy(fh, io.MultiReader(&buf, io.LimitReader(r, limit+1-n))); err != nil {
+		_ = sf.Close()
+		return reqFile{}, err
+	}
+	return reqFile{
+		FileHeader: multipart.FileHeader{Size: n},
+		ReadCloser: struct {
+			io.Reader
+			io.Closer
+		}{io.NewSectionReader(fh, 0, n), sf},
+	}, nil
+}
+
+// spooledFile is a temporary file, removed by Close.
+type spooledFile struct {
+	*os.File
+}
+
+func (f spooledFile) Close() error {
+	err := f.File.Close()
+	_ = os.Remove(f.File.Name())
+	return err
+}
+
 type pendingFile interface {
 	Name() string
 	io.ReadWriteSeeker
@@ -5,12 +5,20 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
 	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tgulacsi/agostle/converter"
+	"github.com/tgulacsi/go/iohlp"
 
 	kithttp "github.com/go-kit/kit/transport/http"
 )
@@ -23,25 +31,143 @@ var stemConvertServer = kithttp.NewServer(
 	kithttp.ServerAfter(kithttp.SetContentType("application/json")),
 )
 
-var _ = stemConvertServer
+// rLanguage matches the hunspell dictionary names (en, en_US, hu-HU...).
+var rLanguage = regexp.MustCompile(`^[A-Za-z]{2,3}([_-][A-Za-z]{2})?$`)
 
-var errNotImplemented = errors.New("not implemented")
+type stemRequest struct {
+	Input       reqFile
+	ContentType string
+	Languages   []string
+}
 
+// stemConvertDecode reads the input and the languages (lang form values, or Content-Language).
+func stemConvertDecode(ctx context.Context, r *http.Request) (any, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	inp, err := getOneRequestFile(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	req := stemRequest{Input: inp, ContentType: inp.Header.Get("Content-Type")}
+	langs := r.Form["lang"]
+	if len(langs) == 0 {
+		langs = r.Header.Values("Content-Language")
+	}
+	for _, s := range langs {
+		for _, lang := range strings.Split(s, ",") {
+			if lang = strings.TrimSpace(lang); lang == "" || slices.Contains(req.Languages, lang) {
+				continue
+			}
+			if !rLanguage.MatchString(lang) {
+				_ = inp.Close()
+				return nil, httpError{Code: http.StatusBadRequest, Err: fmt.Errorf("bad lang %q", lang)}
+			}
+			req.Languages = append(req.Languages, lang)
+		}
+	}
+	if len(req.Languages) == 0 {
+		_ = inp.Close()
+		return nil, httpError{Code: http.StatusBadRequest, Err: errors.New("lang must be set")}
+	}
+	return req, nil
+}
+
+// stemConvertEP stems the text (or the text of the converted document),
+// returns a language -> word -> stems map.
 func stemConvertEP(ctx context.Context, request any) (response any, err error) {
-	_ = stem
-	return nil, errNotImplemented
+	req := request.(stemRequest)
+	defer func() { _ = req.Input.Close() }()
+	logger := getLogger(ctx).With("fn", "stemConvertEP")
+
+	sr, err := iohlp.MakeSectionReader(io.LimitReader(req.Input, converter.MaxSize), converter.InMemorySize)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read input file: %w", err)
+	}
+	var head [1024]byte
+	n, _ := sr.ReadAt(head[:], 0)
+	contentType := converter.FixContentType(head[:n], req.ContentType, req.Input.Filename)
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	logger.Info("stem", "contentType", contentType, "languages", req.Languages)
+
+	var text []byte
+	if mediaType == "text/plain" {
+		var r io.Reader = io.NewSectionReader(sr, 0, sr.Size())
+		if cs := params["charset"]; cs != "" {
+			r = converter.NewTextReader(ctx, r, cs)
+		}
+		if text, err = io.ReadAll(r); err != nil {
+			return nil, err
+		}
+	} else if text, err = documentText(ctx, io.NewSectionReader(sr, 0, sr.Size()), mediaType); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]map[string][]string, len(req.Languages))
+	for _, lang := range req.Languages {
+		pairs, err := stem(ctx, bytes.NewReader(text), lang)
+		if err != nil {
+			return nil, fmt.Errorf("stem %q: %w", lang, err)
+		}
+		m := make(map[string][]string, len(pairs))
+		for _, p := range pairs {
+			stems := m[p[0]]
+			if stems == nil {
+				stems = []string{}
+			}
+			if p[1] != "" && !slices.Contains(stems, p[1]) {
+				stems = append(stems, p[1])
+			}
+			m[p[0]] = stems
+		}
+		res[lang] = m
+	}
+	return res, nil
 }
-func stemConvertDecode(ctx context.Context, r *http.Request) (any, error) {
-	return nil, errNotImplemented
+
+// documentText converts the document to PDF, and returns the text of it.
+func documentText(ctx context.Context, r io.Reader, contentType string) ([]byte, error) {
+	files, err := converter.MailToPdfFiles(ctx, r, contentType)
+	defer func() {
+		for _, f := range files {
+			if f.File != nil {
+				_ = f.File.Close()
+			}
+		}
+	}()
+	var buf bytes.Buffer
+	var n int
+	for _, f := range files {
+		if f.Error != nil || !strings.HasSuffix(f.Filename, ".pdf") {
+			continue
+		}
+		if tErr := converter.PdfToText(ctx, &buf, f.Filename); tErr != nil {
+			err = errors.Join(err, tErr)
+			continue
+		}
+		buf.WriteByte('\n')
+		n++
+	}
+	if n == 0 {
+		if err == nil {
+			err = errors.New("no text found")
+		}
+		return nil, err
+	}
+	if err != nil {
+		getLogger(ctx).Warn("documentText", "error", err)
+	}
+	return buf.Bytes(), nil
 }
+
 func stemConvertEncode(ctx context.Context, w http.ResponseWriter, response any) error {
-	return errNotImplemented
+	return json.NewEncoder(w).Encode(response)
 }
 
 // stem the words in the io.Reader, using the given language, using hunspell.
 func stem(ctx context.Context, r io.Reader, language string) ([][2]string, error) {
-	if language == "" {
-		return nil, errors.New("language must be set")
+	if !rLanguage.MatchString(language) {
+		return nil, fmt.Errorf("bad language %q", language)
 	}
 	var buf, errBuf bytes.Buffer
 	cmd := exec.CommandContext(ctx, "hunspell", "-d", language, "-s")
@@ -0,0 +1,86 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+
+	"github.com/tgulacsi/agostle/converter"
+)
+
+// mailStreamResponse is converted while being encoded, as multipart/mixed.
+type mailStreamResponse struct {
+	input  io.Reader
+	Params convertParams
+}
+
+// mailStreamEncode writes each converted file as a part of a multipart/mixed response,
+// flushing them as soon as they are ready.
+//
+// Errors before the first part are returned (and encoded as usual),
+// later errors just abort the response.
+func mailStreamEncode(ctx context.Context, w http.ResponseWriter, resp mailStreamResponse) error {
+	logger := getLogger(ctx).With("fn", "mailStreamEncode")
+	// the encoder gets the request's context, not the one of emailConvertEP
+	ctx = converter.WithCoverPage(converter.WithHeaderOptions(ctx, resp.Params.Header), resp.Params.Cover)
+	ctx = converter.WithRawHeaders(ctx, resp.Params.RawHeaders)
+	ctx = converter.WithExtractLimits(converter.WithArchivePasswords(ctx, resp.Params.Passwords))
+	rc := http.NewResponseController(w)
+	mw := multipart.NewWriter(w)
+	var started bool
+	err := converter.MailToPdfStream(ctx, resp.input, resp.Params.ContentType,
+		resp.Params.Splitted, resp.Params.OutImg, resp.Params.ImgSize, resp.Params.Pages,
+		func(item converter.ArchFileItem) error {
+			r := io.Reader(item.File)
+			if item.File == nil {
+				fh, err := os.Open(item.Filename)
+				if err != nil {
+					return err
+				}
+				defer fh.Close()
+				r = fh
+			}
+			if !started {
+				started = true
+				w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+				w.Header().Del("Content-Length")
+				w.WriteHeader(http.StatusOK)
+			}
+			name := item.ArchiveName()
+			ct := mime.TypeByExtension(filepath.Ext(name))
+			if ct == "" {
+				ct = "application/octet-stream"
+			}
+			h := make(textproto.MIMEHeader, 2)
+			h.Set("Content-Type", ct)
+			h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+			pw, err := mw.CreatePart(h)
+			if err != nil {
+				return err
+			}
+			if _, err = io.Copy(pw, r); err != nil {
+				return err
+			}
+			if err = rc.Flush(); err != nil {
+				logger.Debug("flush", "error", err)
+			}
+			return nil
+		})
+	if !started {
+		return err
+	}
+	if err != nil {
+		logger.Error("MailToPdfStream", "error", err)
+		return nil
+	}
+	return mw.Close()
+}
@@ -0,0 +1,152 @@
+// Copyright 2026 The Agostle Authors. All rights reserved.
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/tgulacsi/agostle/converter"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// emailThreadServer serves /email/thread: the mails of a conversation are converted
+// into one PDF, in chronological order, with a bookmark for each.
+var emailThreadServer = kithttp.NewServer(
+	emailThreadEP,
+	emailThreadDecode,
+	convertEncode,
+	kithttp.ServerBefore(defaultBeforeFuncs...),
+)
+
+type emailThreadRequest struct {
+	Inputs   []reqFile
+	Header   converter.HeaderOptions
+	Collapse bool
+}
+
+func emailThreadDecode(ctx context.Context, r *http.Request) (any, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	inputs, err := getRequestFiles(r)
+	if err != nil {
+		for _, f := range inputs {
+			_ = f.Close()
+		}
+		return nil, err
+	}
+	return emailThreadRequest{
+		Inputs:   inputs,
+		Header:   getHeaderOptions(r),
+		Collapse: r.Form.Get("collapse") == "1",
+	}, nil
+}
+
+func emailThreadEP(ctx context.Context, request any) (response any, err error) {
+	req, ok := request.(emailThreadRequest)
+	if !ok {
+		return nil, fmt.Errorf("awaited emailThreadRequest, got %T", request)
+	}
+	defer func() {
+		for _, f := range req.Inputs {
+			_ = f.Close()
+		}
+	}()
+	var messages [][]byte
+	for _, f := range req.Inputs {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("read %q: %w", f.Filename, err)
+		}
+		if !isMboxInput(f.Header.Get("Content-Type"), f.Filename) {
+			messages = append(messages, b)
+			continue
+		}
+		if messages, err = appendMessages(messages, converter.MboxMessages(bytes.NewReader(b))); err != nil {
+			return nil, fmt.Errorf("read %q: %w", f.Filename, err)
+		}
+	}
+	if len(messages) == 0 {
+		return nil, httpError{Code: http.StatusBadRequest, Err: fmt.Errorf("no messages")}
+	}
+	ctx = converter.WithExtractLimits(converter.WithHeaderOptions(ctx, req.Header))
+	_, wd := converter.PrepareContext(ctx, "")
+	dst := filepath.Join(wd, "thread.pdf")
+	msgs, err := converter.ThreadToPdf(ctx, dst, messages, req.Collapse)
+	getLogger(ctx).Info("ThreadToPdf", "messages", len(msgs), "collapse", req.Collapse, "error", err)
+	if err != nil {
+		return nil, err
+	}
+	fh, err := os.Open(dst)
+	return convertResponse{content: fh, contentType: "application/pdf"}, err
+}
+
+// appendMessages appends the messages of the mailbox to messages.
+func appendMessages(messages [][]byte, mailbox iter.Seq2[[]byte, error]) ([][]byte, error) {
+	for b, err := range mailbox {
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, b)
+	}
+	return messages, nil
+}
+
+// threadToPdf converts the messages of the files (mails, mbox files or Maildir directories)
+// into one PDF, as a conversation.
+func threadToPdf(ctx context.Context, outfn string, inpfns []string, collapse bool) error {
+	var messages [][]byte
+	for _, fn := range inpfns {
+		var err error
+		if isDir(fn) {
+			if !converter.IsMaildir(fn) {
+				return fmt.Errorf("%s is not a Maildir (no cur or new subdirectory)", fn)
+			}
+			if messages, err = appendMessages(messages, converter.MaildirMessages(fn)); err != nil {
+				return fmt.Errorf("%s: %w", fn, err)
+			}
+			continue
+		}
+		input, err := openIn(fn)
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(io.LimitReader(input, converter.MaxSize))
+		_ = input.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+		if !isMboxInput("", fn) {
+			messages = append(messages, b)
+		} else if messages, err = appendMessages(messages, converter.MboxMessages(bytes.NewReader(b))); err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+	if outfn != "" && outfn != "-" {
+		_, err := converter.ThreadToPdf(ctx, outfn, messages, collapse)
+		return err
+	}
+	_, wd := converter.PrepareContext(ctx, "")
+	dst := filepath.Join(wd, "thread.pdf")
+	defer os.Remove(dst)
+	if _, err := converter.ThreadToPdf(ctx, dst, messages, collapse); err != nil {
+		return err
+	}
+	fh, err := os.Open(dst)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	_, err = io.Copy(os.Stdout, fh)
+	return err
+}